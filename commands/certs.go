@@ -0,0 +1,640 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/log"
+	"github.com/docker/machine/state"
+	"github.com/docker/machine/utils"
+)
+
+// certStatus describes a certificate's expiry relative to the warning window
+func certStatus(expiry time.Time, now time.Time, window time.Duration) string {
+	switch {
+	case expiry.Before(now):
+		return "expired"
+	case expiry.Before(now.Add(window)):
+		return "expiring"
+	}
+	return "ok"
+}
+
+func cmdCertsCheck(c *cli.Context) {
+	var (
+		now      = time.Now()
+		window   = time.Hour * 24 * time.Duration(c.Int("warning-days"))
+		problems = 0
+		renew    = []*libmachine.Host{}
+	)
+
+	machines, err := getHosts(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(machines) == 0 {
+		machines, err = getDefaultMcn(c).List()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	certInfo := getCertPathInfo(c)
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "CERTIFICATE\tEXPIRES\tSTATUS\tPATH")
+
+	check := func(name, path string) string {
+		expiry, err := utils.GetCertificateExpiry(path)
+		if err != nil {
+			problems++
+			fmt.Fprintf(w, "%s\t\t%s\t%s\n", name, err, path)
+			return ""
+		}
+
+		status := certStatus(expiry, now, window)
+		if status != "ok" {
+			problems++
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, expiry.Format(time.RFC3339), status, path)
+		return status
+	}
+
+	check("CA", certInfo.CaCertPath)
+	check("client", certInfo.ClientCertPath)
+
+	for _, host := range machines {
+		status := check(host.Name, host.HostOptions.AuthOptions.ServerCertPath)
+		if status == "" || status == "ok" || !c.Bool("renew") {
+			continue
+		}
+
+		if currentState, err := host.Driver.GetState(); err != nil || currentState != state.Running {
+			log.Warnf("%s is not running, its server certificate will be reissued when it is started", host.Name)
+			continue
+		}
+
+		renew = append(renew, host)
+		problems--
+	}
+
+	w.Flush()
+
+	if len(renew) > 0 {
+		log.Infof("Reissuing the server certificates of %d machine(s)...", len(renew))
+		runActionForeachMachine("configureAuth", renew)
+	}
+
+	if problems > 0 {
+		log.Fatalf("%d certificate(s) are expired, expiring within %d days or unreadable", problems, c.Int("warning-days"))
+	}
+}
+
+// getClientCertDir is where the client certificate issued for a user is kept
+func getClientCertDir(name string) string {
+	return filepath.Join(utils.GetMachineCertDir(), "clients", name)
+}
+
+// getClientCaPath is the CA which issued the client certificate of a user
+func getClientCaPath(name string) string {
+	return filepath.Join(utils.GetClientCaDir(), name+".pem")
+}
+
+// issueClientCert issues the client certificate of a user from a CA of its
+// own.  The CA is not signed by the machines' CA: the daemons trust that CA
+// for the server certificates, and would accept any certificate chaining to
+// it, so a revoked user could present their CA as an intermediate.  The CA
+// key is deleted once the certificate is issued.
+func issueClientCert(name, certDir string, certOptions utils.CertOptions) error {
+	caPath := getClientCaPath(name)
+	caKeyPath := filepath.Join(utils.GetClientCaDir(), name+"-key.pem")
+	defer os.Remove(caKeyPath)
+
+	if err := utils.GenerateCACertificate(caPath, caKeyPath, certOptions); err != nil {
+		return err
+	}
+
+	return utils.GenerateCert([]string{""}, filepath.Join(certDir, "cert.pem"), filepath.Join(certDir, "key.pem"), caPath, caKeyPath, certOptions)
+}
+
+func cmdCertsIssueClient(c *cli.Context) {
+	name := c.Args().First()
+	if name == "" {
+		cli.ShowCommandHelp(c, "issue-client")
+		log.Fatal("You must specify the name of the user")
+	}
+
+	if !libmachine.ValidateHostName(name) {
+		log.Fatalf("Invalid name %q; names may only contain letters, digits, dots and dashes", name)
+	}
+
+	certDir := getClientCertDir(name)
+	if _, err := os.Stat(certDir); err == nil {
+		log.Fatalf("A client certificate has already been issued for %s: %s", name, certDir)
+	}
+
+	certInfo := getCertPathInfo(c)
+
+	certOptions, err := getCertOptions(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	certOptions.Org = name
+
+	for _, dir := range []string{certDir, utils.GetClientCaDir()} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := issueClientCert(name, certDir, certOptions); err != nil {
+		os.RemoveAll(certDir)
+		os.Remove(getClientCaPath(name))
+		log.Fatalf("Error generating client certificate: %s", err)
+	}
+
+	// the user verifies the machines' server certificates with the CA
+	caCert, err := utils.ReadCACertificates(certInfo.CaCertPath, certInfo.CaChainPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(certDir, "ca.pem"), caCert, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("Client certificate for %s written to %s", name, certDir)
+
+	log.Infof("Adding the CA of %s to the machines...", name)
+	if err := reloadMachines(c); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("To use it, copy the directory to the user and point DOCKER_CERT_PATH at it")
+}
+
+func cmdCertsRevoke(c *cli.Context) {
+	name := c.Args().First()
+	if name == "" {
+		cli.ShowCommandHelp(c, "revoke")
+		log.Fatal("You must specify the name the certificate was issued for")
+	}
+
+	revocationList, err := auth.LoadRevocationList(utils.GetRevocationListPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	certDir := getClientCertDir(name)
+	caPath := getClientCaPath(name)
+	certPath := filepath.Join(certDir, "cert.pem")
+
+	switch {
+	case fileExists(caPath):
+		serial, err := utils.GetCertificateSerial(caPath)
+		if err != nil {
+			log.Fatalf("Error reading the client CA of %s: %s", name, err)
+		}
+
+		if revocationList.Revoke(name, serial.String()) {
+			if err := revocationList.Save(); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			log.Infof("The client certificate of %s was already revoked; updating the machines again", name)
+		}
+
+		if err := os.RemoveAll(certDir); err != nil {
+			log.Fatal(err)
+		}
+	case fileExists(certPath):
+		// certificates issued before each user had a CA of their own are
+		// signed by the CA, which the daemons have to keep trusting
+		serial, err := utils.GetCertificateSerial(certPath)
+		if err != nil {
+			log.Fatalf("Error reading the client certificate of %s: %s", name, err)
+		}
+
+		revocationList.Revoke(name, serial.String())
+		if err := revocationList.Save(); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := os.RemoveAll(certDir); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Fatalf("The client certificate of %s was issued by the CA itself; the machines only reject it once the CA is replaced with `%s certs rotate-ca`", name, c.App.Name)
+	default:
+		log.Fatalf("No client certificate has been issued for %s", name)
+	}
+
+	log.Infof("Removing the CA of %s from the machines...", name)
+	if err := reloadMachines(c); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("The client certificate of %s was revoked", name)
+}
+
+// reloadMachines uploads the CA bundle, which holds the CAs of the client
+// certificates which were not revoked, to every running machine and reloads
+// its daemon.  The swarm containers are restarted, as they only load the
+// certificates when they start.
+func reloadMachines(c *cli.Context) error {
+	machines, err := getDefaultMcn(c).List()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, host := range machines {
+		if host.HostOptions == nil || host.HostOptions.AuthOptions == nil || host.DriverName == "none" {
+			continue
+		}
+
+		if engineOptions := host.HostOptions.EngineOptions; engineOptions != nil && engineOptions.DisableTCP {
+			log.Debugf("%s does not listen on TCP, skipping", host.Name)
+			continue
+		}
+
+		if currentState, err := host.Driver.GetState(); err != nil || currentState != state.Running {
+			log.Warnf("%s is not running; once it is started, run `%s regenerate-certs %s` to update its CA bundle", host.Name, c.App.Name, host.Name)
+			continue
+		}
+
+		if err := host.ReloadCACertificates(); err != nil {
+			log.Errorf("%s: %s", host.Name, err)
+			failed++
+			continue
+		}
+
+		if swarmOptions := host.HostOptions.SwarmOptions; swarmOptions != nil && swarmOptions.IsSwarm {
+			if err := host.ConfigureSwarm(); err != nil {
+				log.Errorf("%s: error restarting swarm: %s", host.Name, err)
+				failed++
+				continue
+			}
+		}
+
+		log.Infof("%s: updated", host.Name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d machine(s) could not be updated; once they are fixed, run `%s regenerate-certs` for them", failed, c.App.Name)
+	}
+
+	return nil
+}
+
+func getCARotationPath() string {
+	return filepath.Join(utils.GetMachineCertDir(), "rotation.json")
+}
+
+// rotationPath returns the path next to path which holds the new or old
+// version of a certificate during a CA rotation, e.g. ca.new.pem.
+func rotationPath(path, version string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + version + ext
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// rotateMachines applies the current phase of the rotation to each machine
+// which has not completed it yet, recording the progress as it goes.  Only
+// the phases which reissue the server certificate restart the daemon; in
+// the others the CA bundle is uploaded and the daemon reloaded.
+func rotateMachines(rotation *libmachine.CARotation, machines []*libmachine.Host, trusted []string) error {
+	failed := 0
+
+	for i, host := range machines {
+		prefix := fmt.Sprintf("[%d/%d] %s", i+1, len(machines), host.Name)
+
+		if rotation.Done(host.Name) {
+			log.Infof("%s: done", prefix)
+			continue
+		}
+
+		if currentState, err := host.Driver.GetState(); err != nil || currentState != state.Running {
+			log.Errorf("%s: not running; start it and run the command again", prefix)
+			failed++
+			continue
+		}
+
+		log.Infof("%s: %s...", prefix, rotationPhaseDescriptions[rotation.Phase])
+
+		host.HostOptions.AuthOptions.TrustedCaCertPaths = trusted
+		if err := host.SaveConfig(); err != nil {
+			return err
+		}
+
+		configure := host.ReloadCACertificates
+		if rotation.Phase == libmachine.RotationReissue || rotation.Phase == libmachine.RotationRollback {
+			configure = host.ConfigureAuth
+		}
+
+		if err := configure(); err != nil {
+			log.Errorf("%s: %s", prefix, err)
+			failed++
+			continue
+		}
+
+		// the swarm containers only load the certificates when they start,
+		// and do not need the new CA before the certificates are reissued
+		if swarmOptions := host.HostOptions.SwarmOptions; swarmOptions != nil && swarmOptions.IsSwarm && rotation.Phase != libmachine.RotationTrust {
+			if err := host.ConfigureSwarm(); err != nil {
+				log.Errorf("%s: error restarting swarm: %s", prefix, err)
+				failed++
+				continue
+			}
+		}
+
+		if err := rotation.SetDone(host.Name); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d machine(s) could not be updated; fix them and run the command again to resume", failed)
+	}
+
+	return nil
+}
+
+var rotationPhaseDescriptions = map[string]string{
+	libmachine.RotationTrust:    "trusting the new CA",
+	libmachine.RotationReissue:  "reissuing the server certificate from the new CA",
+	libmachine.RotationDrop:     "dropping the old CA",
+	libmachine.RotationRollback: "restoring the old CA",
+}
+
+// getRotationMachines returns the machines which use the CA being rotated
+func getRotationMachines(c *cli.Context, caCertPath string) []*libmachine.Host {
+	machines, err := getDefaultMcn(c).List()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rotate := []*libmachine.Host{}
+	for _, host := range machines {
+		if host.HostOptions == nil || host.HostOptions.AuthOptions == nil || host.DriverName == "none" {
+			continue
+		}
+		if host.HostOptions.AuthOptions.CaCertPath != caCertPath {
+			log.Debugf("%s uses a different CA, skipping", host.Name)
+			continue
+		}
+		rotate = append(rotate, host)
+	}
+
+	return rotate
+}
+
+// isExternalCA reports whether the CA is an intermediate of another PKI or
+// signs through an external signer, and so cannot be replaced by machine
+func isExternalCA(c *cli.Context, certInfo libmachine.CertPathInfo) bool {
+	return certInfo.CaChainPath != "" || c.GlobalString("tls-signer-command") != "" || c.GlobalString("tls-signer-url") != ""
+}
+
+// reissueClientCerts gives the users the current CA to verify the machines
+// with.  Client certificates issued before each user had a CA of their own
+// are reissued from the current CA; those it has already issued are
+// skipped, so the reissue can be repeated after a failure.
+func reissueClientCerts(certInfo libmachine.CertPathInfo, certOptions utils.CertOptions) error {
+	dirs, err := ioutil.ReadDir(filepath.Join(utils.GetMachineCertDir(), "clients"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	caCert, err := ioutil.ReadFile(certInfo.CaCertPath)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		name := dir.Name()
+		certDir := getClientCertDir(name)
+		certPath := filepath.Join(certDir, "cert.pem")
+
+		// the CA is written first, so a certificate issued by the new CA
+		// always comes with it
+		if err := ioutil.WriteFile(filepath.Join(certDir, "ca.pem"), caCert, 0644); err != nil {
+			return err
+		}
+
+		if fileExists(getClientCaPath(name)) {
+			continue
+		}
+
+		if issued, err := utils.IsIssuedBy(certPath, certInfo.CaCertPath); err == nil && issued {
+			continue
+		}
+
+		certOptions.Org = name
+		if err := utils.GenerateCert([]string{""}, certPath, filepath.Join(certDir, "key.pem"), certInfo.CaCertPath, certInfo.CaKeyPath, certOptions); err != nil {
+			return fmt.Errorf("error reissuing the client certificate of %s: %s", name, err)
+		}
+
+		log.Infof("Reissued the client certificate of %s", name)
+	}
+
+	return nil
+}
+
+// swapCA puts the new CA in place of the old one, keeping the old CA and
+// client certificate for the rest of the rotation, and issues a new client
+// certificate.  Each step is skipped if it is already done, so the swap
+// can be repeated after a failure.
+func swapCA(certInfo libmachine.CertPathInfo, certOptions utils.CertOptions) error {
+	renames := []struct{ from, to string }{
+		{certInfo.CaCertPath, rotationPath(certInfo.CaCertPath, "old")},
+		{certInfo.CaKeyPath, rotationPath(certInfo.CaKeyPath, "old")},
+		{rotationPath(certInfo.CaCertPath, "new"), certInfo.CaCertPath},
+		{rotationPath(certInfo.CaKeyPath, "new"), certInfo.CaKeyPath},
+		{certInfo.ClientCertPath, rotationPath(certInfo.ClientCertPath, "old")},
+		{certInfo.ClientKeyPath, rotationPath(certInfo.ClientKeyPath, "old")},
+	}
+
+	for _, r := range renames {
+		if !fileExists(r.from) || fileExists(r.to) {
+			continue
+		}
+		if err := os.Rename(r.from, r.to); err != nil {
+			return err
+		}
+	}
+
+	if fileExists(certInfo.ClientCertPath) {
+		return nil
+	}
+
+	return utils.GenerateCert([]string{""}, certInfo.ClientCertPath, certInfo.ClientKeyPath, certInfo.CaCertPath, certInfo.CaKeyPath, certOptions)
+}
+
+// restoreCA puts the old CA and client certificate back in place
+func restoreCA(certInfo libmachine.CertPathInfo) error {
+	for _, path := range []string{certInfo.CaCertPath, certInfo.CaKeyPath, certInfo.ClientCertPath, certInfo.ClientKeyPath} {
+		old := rotationPath(path, "old")
+		if !fileExists(old) {
+			continue
+		}
+		if err := os.Rename(old, path); err != nil {
+			return err
+		}
+	}
+
+	return removeFiles(rotationPath(certInfo.CaCertPath, "new"), rotationPath(certInfo.CaKeyPath, "new"))
+}
+
+func removeFiles(paths ...string) error {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdCertsRotateCA(c *cli.Context) {
+	certInfo := getCertPathInfo(c)
+
+	if isExternalCA(c, certInfo) {
+		log.Fatal("Rotating a CA which is managed outside of machine is not supported")
+	}
+
+	certOptions, err := getCertOptions(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if certOptions.Org == "" {
+		certOptions.Org = utils.GetUsername()
+	}
+
+	rotation, err := libmachine.LoadCARotation(getCARotationPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	machines := getRotationMachines(c, certInfo.CaCertPath)
+
+	if c.Bool("rollback") {
+		if rotation == nil {
+			log.Fatal("There is no CA rotation in progress")
+		}
+
+		if rotation.Phase != libmachine.RotationRollback {
+			if err := restoreCA(certInfo); err != nil {
+				log.Fatalf("Error restoring the old CA: %s", err)
+			}
+
+			if err := reissueClientCerts(certInfo, certOptions); err != nil {
+				log.Fatal(err)
+			}
+			if err := rotation.SetPhase(libmachine.RotationRollback); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if err := rotateMachines(rotation, machines, nil); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := rotation.Remove(); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Info("The CA rotation was rolled back")
+		return
+	}
+
+	newCaCertPath := rotationPath(certInfo.CaCertPath, "new")
+	newCaKeyPath := rotationPath(certInfo.CaKeyPath, "new")
+	oldCaCertPath := rotationPath(certInfo.CaCertPath, "old")
+
+	switch {
+	case rotation == nil:
+		if !fileExists(certInfo.CaKeyPath) {
+			log.Fatalf("The CA key %s does not exist", certInfo.CaKeyPath)
+		}
+
+		log.Infof("Creating new CA: %s", newCaCertPath)
+		if err := utils.GenerateCACertificate(newCaCertPath, newCaKeyPath, certOptions); err != nil {
+			log.Fatalf("Error generating CA certificate: %s", err)
+		}
+
+		rotation = libmachine.NewCARotation(getCARotationPath())
+		if err := rotation.Save(); err != nil {
+			log.Fatal(err)
+		}
+	case rotation.Phase == libmachine.RotationRollback:
+		log.Fatal("A rollback of the CA rotation is in progress; run the command with --rollback to finish it")
+	default:
+		log.Infof("Resuming the CA rotation (phase: %s)", rotation.Phase)
+	}
+
+	if rotation.Phase == libmachine.RotationTrust {
+		if err := rotateMachines(rotation, machines, []string{newCaCertPath}); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := swapCA(certInfo, certOptions); err != nil {
+			log.Fatalf("Error replacing the CA: %s", err)
+		}
+
+		if err := reissueClientCerts(certInfo, certOptions); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := rotation.SetPhase(libmachine.RotationReissue); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if rotation.Phase == libmachine.RotationReissue {
+		if err := rotateMachines(rotation, machines, []string{oldCaCertPath}); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := rotation.SetPhase(libmachine.RotationDrop); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := rotateMachines(rotation, machines, nil); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := removeFiles(
+		oldCaCertPath,
+		rotationPath(certInfo.CaKeyPath, "old"),
+		rotationPath(certInfo.ClientCertPath, "old"),
+		rotationPath(certInfo.ClientKeyPath, "old"),
+	); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := rotation.Remove(); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Infof("The CA was rotated; give the users the new ca.pem in %s", filepath.Join(utils.GetMachineCertDir(), "clients"))
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/utils"
+)
+
+func TestCertStatus(t *testing.T) {
+	now := time.Now()
+	window := time.Hour * 24 * 30
+
+	for _, c := range []struct {
+		expiry   time.Time
+		expected string
+	}{
+		{now.Add(-time.Hour), "expired"},
+		{now.Add(time.Hour * 24 * 7), "expiring"},
+		{now.Add(time.Hour * 24 * 365), "ok"},
+	} {
+		if status := certStatus(c.expiry, now, window); status != c.expected {
+			t.Fatalf("expected status %s for %s; received %s", c.expected, c.expiry, status)
+		}
+	}
+}
+
+func TestRotationPath(t *testing.T) {
+	if p := rotationPath("/certs/ca-key.pem", "new"); p != "/certs/ca-key.new.pem" {
+		t.Fatalf("expected /certs/ca-key.new.pem; received %s", p)
+	}
+}
+
+func TestSwapAndRestoreCA(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	certInfo := libmachine.CertPathInfo{
+		CaCertPath:     filepath.Join(tmpDir, "ca.pem"),
+		CaKeyPath:      filepath.Join(tmpDir, "ca-key.pem"),
+		ClientCertPath: filepath.Join(tmpDir, "cert.pem"),
+		ClientKeyPath:  filepath.Join(tmpDir, "key.pem"),
+	}
+	opts := utils.CertOptions{Org: "test-org", KeySize: 1024}
+
+	if err := utils.GenerateCACertificate(certInfo.CaCertPath, certInfo.CaKeyPath, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.GenerateCert([]string{""}, certInfo.ClientCertPath, certInfo.ClientKeyPath, certInfo.CaCertPath, certInfo.CaKeyPath, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.GenerateCACertificate(rotationPath(certInfo.CaCertPath, "new"), rotationPath(certInfo.CaKeyPath, "new"), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	serial := func(path string) string {
+		s, err := utils.GetCertificateSerial(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.String()
+	}
+
+	oldCA := serial(certInfo.CaCertPath)
+	newCA := serial(rotationPath(certInfo.CaCertPath, "new"))
+	oldClient := serial(certInfo.ClientCertPath)
+
+	// swapping twice is the same as swapping once
+	for i := 0; i < 2; i++ {
+		if err := swapCA(certInfo, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if serial(certInfo.CaCertPath) != newCA || serial(rotationPath(certInfo.CaCertPath, "old")) != oldCA {
+		t.Fatal("expected the new CA in place and the old CA kept")
+	}
+
+	if serial(certInfo.ClientCertPath) == oldClient || serial(rotationPath(certInfo.ClientCertPath, "old")) != oldClient {
+		t.Fatal("expected a new client certificate and the old one kept")
+	}
+
+	if err := utils.ValidateCAChain(certInfo.ClientCertPath, certInfo.CaCertPath); err != nil {
+		t.Fatalf("expected the client certificate to be issued by the new CA: %s", err)
+	}
+
+	if err := restoreCA(certInfo); err != nil {
+		t.Fatal(err)
+	}
+
+	if serial(certInfo.CaCertPath) != oldCA || serial(certInfo.ClientCertPath) != oldClient {
+		t.Fatal("expected the old CA and client certificate to be restored")
+	}
+
+	for _, path := range []string{
+		rotationPath(certInfo.CaCertPath, "new"),
+		rotationPath(certInfo.CaCertPath, "old"),
+		rotationPath(certInfo.ClientCertPath, "old"),
+	} {
+		if fileExists(path) {
+			t.Fatalf("expected %s to be removed", path)
+		}
+	}
+}
@@ -31,6 +31,7 @@ import (
 
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/swarm"
 	"github.com/docker/machine/log"
 	"github.com/docker/machine/utils"
@@ -40,6 +41,7 @@ var (
 	ErrUnknownShell       = errors.New("Error: Unknown shell")
 	ErrNoMachineSpecified = errors.New("Error: Expected to get one or more machine names as arguments.")
 	ErrExpectedOneMachine = errors.New("Error: Expected one machine name as an argument.")
+	ErrNoDefaultMachine   = errors.New("Error: No machine name given, MACHINE_NAME is not set and there is no active machine; choose one with use.")
 )
 
 type machineConfig struct {
@@ -53,6 +55,7 @@ type machineConfig struct {
 	caKeyPath      string
 	serverKeyPath  string
 	AuthOptions    auth.AuthOptions
+	EngineOptions  engine.EngineOptions
 	SwarmOptions   swarm.SwarmOptions
 }
 
@@ -104,9 +107,13 @@ func getDefaultStore(rootPath, caCertPath, privateKeyPath string) (libmachine.St
 	), nil
 }
 
-func setupCertificates(caCertPath, caKeyPath, clientCertPath, clientKeyPath string) error {
-	org := utils.GetUsername()
-	bits := 2048
+// setupCertificates creates the CA and client certificate if they do not
+// exist.  With a signer, the CA certificate must be provided and the client
+// certificate is issued by the signer.
+func setupCertificates(caCertPath, caKeyPath, clientCertPath, clientKeyPath string, certOptions utils.CertOptions, signer utils.CertSigner) error {
+	if certOptions.Org == "" {
+		certOptions.Org = utils.GetUsername()
+	}
 
 	if _, err := os.Stat(utils.GetMachineCertDir()); err != nil {
 		if os.IsNotExist(err) {
@@ -118,7 +125,9 @@ func setupCertificates(caCertPath, caKeyPath, clientCertPath, clientKeyPath stri
 		}
 	}
 
-	if _, err := os.Stat(caCertPath); os.IsNotExist(err) {
+	if _, err := os.Stat(caCertPath); os.IsNotExist(err) && signer != nil {
+		log.Fatalf("The CA certificate %s does not exist.  It is required to verify the certificates issued by the signer.", caCertPath)
+	} else if os.IsNotExist(err) {
 		log.Infof("Creating CA: %s", caCertPath)
 
 		// check if the key path exists; if so, error
@@ -126,7 +135,7 @@ func setupCertificates(caCertPath, caKeyPath, clientCertPath, clientKeyPath stri
 			log.Fatalf("The CA key already exists.  Please remove it or specify a different key/cert.")
 		}
 
-		if err := utils.GenerateCACertificate(caCertPath, caKeyPath, org, bits); err != nil {
+		if err := utils.GenerateCACertificate(caCertPath, caKeyPath, certOptions); err != nil {
 			log.Infof("Error generating CA certificate: %s", err)
 		}
 	}
@@ -149,7 +158,11 @@ func setupCertificates(caCertPath, caKeyPath, clientCertPath, clientKeyPath stri
 			log.Fatalf("The client key already exists.  Please remove it or specify a different key/cert.")
 		}
 
-		if err := utils.GenerateCert([]string{""}, clientCertPath, clientKeyPath, caCertPath, caKeyPath, org, bits); err != nil {
+		if signer != nil {
+			if err := utils.GenerateCertWithSigner([]string{""}, clientCertPath, clientKeyPath, certOptions, signer); err != nil {
+				log.Fatalf("Error generating client certificate: %s", err)
+			}
+		} else if err := utils.GenerateCert([]string{""}, clientCertPath, clientKeyPath, caCertPath, caKeyPath, certOptions); err != nil {
 			log.Fatalf("Error generating client certificate: %s", err)
 		}
 	}
@@ -157,7 +170,65 @@ func setupCertificates(caCertPath, caKeyPath, clientCertPath, clientKeyPath stri
 	return nil
 }
 
-var sharedCreateFlags = []cli.Flag{
+// swarmFlags configure swarm on create and swarm add
+var swarmFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "swarm-master",
+		Usage: "Configure Machine to be a Swarm master",
+	},
+	cli.BoolFlag{
+		Name:  "swarm-replication",
+		Usage: "Run the Swarm master as one of several replicas electing a primary; needs a KV store discovery",
+	},
+	cli.StringFlag{
+		Name:  "swarm-discovery",
+		Usage: "Discovery service to use with Swarm",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "swarm-host",
+		Usage: "ip/socket to listen on for Swarm master",
+		Value: swarm.DefaultHost,
+	},
+	cli.StringFlag{
+		Name:  "swarm-addr",
+		Usage: "addr to advertise for Swarm: public, private or an IP[:port] (default: detect and use the machine IP)",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "swarm-cluster",
+		Usage: "Specify the name of the Swarm cluster to join; its discovery is found from the other machines in the cluster",
+	},
+	cli.StringFlag{
+		Name:  "swarm-strategy",
+		Usage: "Define a default scheduling strategy for Swarm",
+		Value: swarm.DefaultStrategy,
+	},
+	cli.IntFlag{
+		Name:  "swarm-heartbeat",
+		Usage: "Specify the Swarm discovery heartbeat in seconds (defaults to the Swarm default)",
+	},
+	cli.Float64Flag{
+		Name:  "swarm-overcommit",
+		Usage: "Specify the fraction of resources the Swarm master may overcommit, e.g. 0.05",
+	},
+	cli.StringSliceFlag{
+		Name:  "swarm-opt",
+		Usage: "Define arbitrary flags for the Swarm master in the form flag=value",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringFlag{
+		Name:  "swarm-image",
+		Usage: "Specify the Docker image to use for Swarm",
+		Value: swarm.DockerImage,
+	},
+	cli.StringFlag{
+		Name:  "swarm-image-archive",
+		Usage: "Specify a local tarball of the Swarm image (from docker save) to upload and load instead of pulling it",
+	},
+}
+
+var sharedCreateFlags = append(append([]cli.Flag{
 	cli.StringFlag{
 		Name: "driver, d",
 		Usage: fmt.Sprintf(
@@ -167,10 +238,49 @@ var sharedCreateFlags = []cli.Flag{
 		Value: "none",
 	},
 	cli.StringSliceFlag{
-		Name:  "engine-flag",
+		Name:  "engine-opt, engine-flag",
 		Usage: "Specify arbitrary flags to include with the created engine in the form flag=value",
 		Value: &cli.StringSlice{},
 	},
+	cli.StringSliceFlag{
+		Name:  "engine-env",
+		Usage: "Specify environment variables to set in the engine in the form KEY=value",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringSliceFlag{
+		Name:  "engine-dns",
+		Usage: "Specify DNS servers for the created engine to use",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringFlag{
+		Name:  "engine-graph-dir",
+		Usage: "Specify the root of the Docker runtime for the created engine",
+	},
+	cli.BoolFlag{
+		Name:  "engine-ipv6",
+		Usage: "Enable IPv6 networking in the created engine",
+	},
+	cli.StringFlag{
+		Name:  "engine-log-level",
+		Usage: "Specify the logging level for the created engine",
+	},
+	cli.BoolFlag{
+		Name:  "engine-selinux",
+		Usage: "Enable SELinux support in the created engine",
+	},
+	cli.StringFlag{
+		Name:  "engine-install-url",
+		Usage: "Specify the script used to install Docker, e.g. https://test.docker.com for release candidates",
+		Value: engine.DefaultInstallURL,
+	},
+	cli.StringFlag{
+		Name:  "engine-install-package",
+		Usage: "Specify a local Docker package (.deb) or static binary to upload and install instead of downloading Docker",
+	},
+	cli.StringFlag{
+		Name:  "engine-version",
+		Usage: "Specify the version of Docker to install, e.g. 1.6.2 (defaults to the latest)",
+	},
 	cli.StringSliceFlag{
 		Name:  "engine-insecure-registry",
 		Usage: "Specify insecure registries to allow with the created engine",
@@ -186,34 +296,55 @@ var sharedCreateFlags = []cli.Flag{
 		Usage: "Specify labels for the created engine",
 		Value: &cli.StringSlice{},
 	},
+	cli.BoolFlag{
+		Name:  "engine-no-driver-labels",
+		Usage: "Do not label the created engine with the region, instance type and resources the driver reports",
+	},
 	cli.StringFlag{
 		Name:  "engine-storage-driver",
 		Usage: "Specify a storage driver to use with the engine",
 	},
-	cli.BoolFlag{
-		Name:  "swarm",
-		Usage: "Configure Machine with Swarm",
+	cli.StringFlag{
+		Name:  "engine-bind-address",
+		Usage: fmt.Sprintf("Specify the address the engine listens on for TCP connections, or %q for the machine's private IP (defaults to all interfaces)", engine.BindPrivate),
+	},
+	cli.IntFlag{
+		Name:  "engine-port",
+		Usage: fmt.Sprintf("Specify the port the engine listens on for TCP connections (defaults to %d)", engine.DefaultPort),
 	},
 	cli.BoolFlag{
-		Name:  "swarm-master",
-		Usage: "Configure Machine to be a Swarm master",
+		Name:  "engine-no-tcp",
+		Usage: "Disable the engine's TCP socket; connect to it through an SSH tunnel with the tunnel command",
 	},
-	cli.StringFlag{
-		Name:  "swarm-discovery",
-		Usage: "Discovery service to use with Swarm",
-		Value: "",
+	cli.StringSliceFlag{
+		Name:  "tls-san",
+		Usage: "Specify extra IP addresses or DNS names to include in the machine's server certificate",
+		Value: &cli.StringSlice{},
 	},
-	cli.StringFlag{
-		Name:  "swarm-host",
-		Usage: "ip/socket to listen on for Swarm master",
-		Value: "tcp://0.0.0.0:3376",
+	cli.StringSliceFlag{
+		Name:  "hook-script",
+		Usage: "Specify a local script to upload and run with sudo in the form phase=path (phases: pre-install, post-auth, post-swarm)",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringSliceFlag{
+		Name:  "hook-file",
+		Usage: "Specify a local file to upload in the form phase=source:destination (phases: pre-install, post-auth, post-swarm)",
+		Value: &cli.StringSlice{},
 	},
+	cli.BoolFlag{
+		Name:  "cloud-init",
+		Usage: "Provision the machine using cloud-init user-data instead of SSH (amazonec2, digitalocean, google, openstack, rackspace)",
+	},
+	cli.BoolFlag{
+		Name:  "swarm",
+		Usage: "Configure Machine with Swarm",
+	},
+}, swarmFlags...),
 	cli.StringFlag{
-		Name:  "swarm-addr",
-		Usage: "addr to advertise for Swarm (default: detect and use the machine IP)",
-		Value: "",
+		Name:  "swarm-kv-store",
+		Usage: fmt.Sprintf("Run a KV store for the cluster's discovery on the machine (%s)", strings.Join(swarm.KVStoreNames(), ", ")),
 	},
-}
+)
 
 var Commands = []cli.Command{
 	{
@@ -221,18 +352,72 @@ var Commands = []cli.Command{
 		Usage:  "Print which machine is active",
 		Action: cmdActive,
 	},
+	{
+		Name:  "certs",
+		Usage: "Manage the TLS certificates used by machines",
+		Subcommands: []cli.Command{
+			{
+				Name:        "check",
+				Usage:       "Check when the CA, client and machine certificates expire",
+				Description: "Argument(s) are machine names; all machines are checked if none are given.",
+				Action:      cmdCertsCheck,
+				Flags: []cli.Flag{
+					cli.IntFlag{
+						Name:   "warning-days",
+						Usage:  "Warn about certificates which expire within this many days",
+						Value:  30,
+						EnvVar: "MACHINE_CERT_WARNING_DAYS",
+					},
+					cli.BoolFlag{
+						Name:  "renew",
+						Usage: "Reissue the server certificates of running machines which expire within the warning window",
+					},
+				},
+			},
+			{
+				Name:        "issue-client",
+				Usage:       "Issue a client certificate for a user from a CA of its own",
+				Description: "Argument is the name of the user.  The user's CA is added to the CA bundle of the running machines.",
+				Action:      cmdCertsIssueClient,
+			},
+			{
+				Name:        "rotate-ca",
+				Usage:       "Replace the CA and reissue the certificates of all machines",
+				Description: "Machines trust the old and new CA while their certificates are reissued.  An interrupted rotation is resumed by running the command again.",
+				Action:      cmdCertsRotateCA,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "rollback",
+						Usage: "Abort the rotation in progress and restore the old CA on all machines",
+					},
+				},
+			},
+			{
+				Name:        "revoke",
+				Usage:       "Revoke a user's client certificate",
+				Description: "Argument is the name the certificate was issued for.  The user's CA is removed from the CA bundle of the running machines, whose daemons are reloaded.",
+				Action:      cmdCertsRevoke,
+			},
+		},
+	},
 	{
 		Name:        "config",
 		Usage:       "Print the connection config for machine",
-		Description: "Argument is a machine name.",
+		Description: "Argument is a machine name; the default machine is used if it is omitted.",
 		Action:      cmdConfig,
 		Flags: []cli.Flag{
 			cli.BoolFlag{
 				Name:  "swarm",
-				Usage: "Display the Swarm config instead of the Docker daemon",
+				Usage: "Display the config of a healthy master of the machine's Swarm instead of the Docker daemon",
 			},
 		},
 	},
+	{
+		Name:        "config-show",
+		Usage:       "Show the option defaults set in config files and the environment",
+		Description: "Lists where the effective value of each option set outside the command line comes from.",
+		Action:      cmdConfigShow,
+	},
 	{
 		Flags: append(
 			drivers.GetCreateFlags(),
@@ -242,15 +427,27 @@ var Commands = []cli.Command{
 		Usage:  "Create a machine",
 		Action: cmdCreate,
 	},
+	{
+		Name:        "encrypt-store",
+		Usage:       "Encrypt the keys and machine configs in the store",
+		Description: "The passphrase is read from MACHINE_STORAGE_PASSPHRASE, or the key from --storage-key-file.",
+		Action:      cmdEncryptStore,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "decrypt",
+				Usage: "Decrypt the store instead",
+			},
+		},
+	},
 	{
 		Name:        "env",
 		Usage:       "Display the commands to set up the environment for the Docker client",
-		Description: "Argument is a machine name.",
+		Description: "Argument is a machine name; the default machine is used if it is omitted.",
 		Action:      cmdEnv,
 		Flags: []cli.Flag{
 			cli.BoolFlag{
 				Name:  "swarm",
-				Usage: "Display the Swarm config instead of the Docker daemon",
+				Usage: "Display the config of a healthy master of the machine's Swarm instead of the Docker daemon",
 			},
 			cli.StringFlag{
 				Name:  "shell",
@@ -265,7 +462,7 @@ var Commands = []cli.Command{
 	{
 		Name:        "inspect",
 		Usage:       "Inspect information about a machine",
-		Description: "Argument is a machine name.",
+		Description: "Argument is a machine name; the default machine is used if it is omitted.",
 		Action:      cmdInspect,
 		Flags: []cli.Flag{
 			cli.StringFlag{
@@ -278,7 +475,7 @@ var Commands = []cli.Command{
 	{
 		Name:        "ip",
 		Usage:       "Get the IP address of a machine",
-		Description: "Argument(s) are one or more machine names.",
+		Description: "Argument(s) are one or more machine names; the default machine is used if none are given.",
 		Action:      cmdIp,
 	},
 	{
@@ -331,33 +528,98 @@ var Commands = []cli.Command{
 	{
 		Name:        "ssh",
 		Usage:       "Log into or run a command on a machine with SSH.",
-		Description: "Arguments are [machine-name] [command]",
+		Description: "Arguments are [machine-name] [command]; the default machine gets a shell if none are given.",
 		Action:      cmdSsh,
 	},
 	{
 		Name:        "start",
 		Usage:       "Start a machine",
-		Description: "Argument(s) are one or more machine names.",
+		Description: "Argument(s) are one or more machine names; the default machine is used if none are given.",
 		Action:      cmdStart,
 	},
 	{
 		Name:        "stop",
 		Usage:       "Stop a machine",
-		Description: "Argument(s) are one or more machine names.",
+		Description: "Argument(s) are one or more machine names; the default machine is used if none are given.",
 		Action:      cmdStop,
 	},
+	{
+		Name:  "swarm",
+		Usage: "Manage the swarm membership of existing machines",
+		Subcommands: []cli.Command{
+			{
+				Name:        "add",
+				Usage:       "Add a machine to a swarm",
+				Description: "Argument is a machine name.",
+				Action:      cmdSwarmAdd,
+				Flags:       swarmFlags,
+			},
+			{
+				Name:        "promote",
+				Usage:       "Make a machine the master of its swarm, demoting the current master",
+				Description: "Argument is a machine name.",
+				Action:      cmdSwarmPromote,
+			},
+			{
+				Name:        "remove",
+				Usage:       "Remove a machine from its swarm",
+				Description: "Argument is a machine name.",
+				Action:      cmdSwarmRemove,
+			},
+			{
+				Name:        "status",
+				Usage:       "Show the swarm agents of the machines in a swarm",
+				Description: "Argument is the name of a machine in the swarm.",
+				Action:      cmdSwarmStatus,
+			},
+		},
+	},
+	{
+		Name:        "tls-check",
+		Usage:       "Diagnose TLS connection problems with a machine",
+		Description: "Argument is a machine name; the default machine is used if it is omitted.",
+		Action:      cmdTLSCheck,
+	},
+	{
+		Name:        "tunnel",
+		Usage:       "Forward the Docker socket of a machine created with --engine-no-tcp over SSH",
+		Description: "Argument is a machine name; the default machine is used if it is omitted.",
+		Action:      cmdTunnel,
+	},
 	{
 		Name:        "upgrade",
 		Usage:       "Upgrade a machine to the latest version of Docker",
 		Description: "Argument(s) are one or more machine names.",
 		Action:      cmdUpgrade,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "engine-version",
+				Usage: "Specify the version of Docker to upgrade (or downgrade) to instead of the latest",
+			},
+			cli.BoolFlag{
+				Name:  "latest",
+				Usage: "Clear the version the machine is pinned to and upgrade to the latest",
+			},
+		},
 	},
 	{
 		Name:        "url",
 		Usage:       "Get the URL of a machine",
-		Description: "Argument is a machine name.",
+		Description: "Argument is a machine name; the default machine is used if it is omitted.",
 		Action:      cmdUrl,
 	},
+	{
+		Name:        "use",
+		Usage:       "Make a machine the active machine",
+		Description: "Argument is a machine name.",
+		Action:      cmdUse,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "unset",
+				Usage: "Clear the active machine, falling back to the one DOCKER_HOST points at",
+			},
+		},
+	},
 }
 
 // machineCommand maps the command name to the corresponding machine command.
@@ -436,7 +698,11 @@ func runActionWithContext(actionName string, c *cli.Context) error {
 	}
 
 	if len(machines) == 0 {
-		log.Fatal(ErrNoMachineSpecified)
+		machine, err := loadMachine(getMachineName(c), c)
+		if err != nil {
+			return err
+		}
+		machines = append(machines, machine)
 	}
 
 	runActionForeachMachine(actionName, machines)
@@ -482,8 +748,32 @@ func loadMachine(name string, c *cli.Context) (*libmachine.Host, error) {
 	return host, nil
 }
 
+// getMachineName returns the machine named by the first argument or, if
+// there is none, the default machine: MACHINE_NAME, or the active machine.
+// The choice is reported on stderr, as the output of env, config, url and
+// ip is used by scripts.
+func getMachineName(c *cli.Context) string {
+	if name := c.Args().First(); name != "" {
+		return name
+	}
+
+	if name := os.Getenv("MACHINE_NAME"); name != "" {
+		fmt.Fprintf(os.Stderr, "No machine name given; using %s from MACHINE_NAME\n", name)
+		return name
+	}
+
+	host, err := getDefaultMcn(c).GetActive()
+	if err != nil {
+		log.Debugf("error getting the active machine: %s", err)
+		log.Fatal(ErrNoDefaultMachine)
+	}
+
+	fmt.Fprintf(os.Stderr, "No machine name given; using the active machine %s\n", host.Name)
+	return host.Name
+}
+
 func getHost(c *cli.Context) *libmachine.Host {
-	name := c.Args().First()
+	name := getMachineName(c)
 
 	defaultStore, err := getDefaultStore(
 		c.GlobalString("storage-path"),
@@ -506,6 +796,53 @@ func getHost(c *cli.Context) *libmachine.Host {
 	return host
 }
 
+// getSwarmMasterURL returns the URL of a healthy master of the swarm the
+// named machine is in
+func getSwarmMasterURL(c *cli.Context, name string) string {
+	mcn := getDefaultMcn(c)
+
+	host, err := mcn.Get(name)
+	if err != nil {
+		log.Fatalf("unable to load host: %v", err)
+	}
+
+	master, err := mcn.SwarmMaster(host)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if master.Name != host.Name {
+		log.Infof("Using the swarm master %s", master.Name)
+	}
+
+	swarmURL, err := master.GetSwarmURL()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return swarmURL
+}
+
+// getSwarmOptions returns the swarm options given by the swarm flags
+func getSwarmOptions(c *cli.Context) *swarm.SwarmOptions {
+	return &swarm.SwarmOptions{
+		IsSwarm:        c.Bool("swarm"),
+		Master:         c.Bool("swarm-master"),
+		Replication:    c.Bool("swarm-replication"),
+		Discovery:      c.String("swarm-discovery"),
+		Address:        c.String("swarm-addr"),
+		Host:           c.String("swarm-host"),
+		Cluster:        c.String("swarm-cluster"),
+		KVStore:        c.String("swarm-kv-store"),
+		Strategy:       c.String("swarm-strategy"),
+		Heartbeat:      c.Int("swarm-heartbeat"),
+		Overcommit:     c.Float64("swarm-overcommit"),
+		ArbitraryFlags: c.StringSlice("swarm-opt"),
+		Image:          c.String("swarm-image"),
+		ImageArchive:   c.String("swarm-image-archive"),
+	}
+}
+
 func getDefaultMcn(c *cli.Context) *libmachine.Machine {
 	certInfo := getCertPathInfo(c)
 	defaultStore, err := getDefaultStore(
@@ -526,7 +863,7 @@ func getDefaultMcn(c *cli.Context) *libmachine.Machine {
 }
 
 func getMachineConfig(c *cli.Context) (*machineConfig, error) {
-	name := c.Args().First()
+	name := getMachineName(c)
 	certInfo := getCertPathInfo(c)
 	defaultStore, err := getDefaultStore(
 		c.GlobalString("storage-path"),
@@ -573,10 +910,41 @@ func getMachineConfig(c *cli.Context) (*machineConfig, error) {
 		caCertPath:     caCert,
 		serverKeyPath:  serverKey,
 		AuthOptions:    *m.HostOptions.AuthOptions,
+		EngineOptions:  *m.HostOptions.EngineOptions,
 		SwarmOptions:   *m.HostOptions.SwarmOptions,
 	}, nil
 }
 
+// getCertOptions returns the key and certificate options given by the
+// global flags
+func getCertOptions(c *cli.Context) (utils.CertOptions, error) {
+	certOptions := utils.CertOptions{
+		Org:          c.GlobalString("tls-cert-org"),
+		KeyAlgorithm: c.GlobalString("tls-key-algorithm"),
+		KeySize:      c.GlobalInt("tls-key-size"),
+		ValidityDays: c.GlobalInt("tls-cert-validity"),
+	}
+
+	if err := certOptions.Validate(); err != nil {
+		return certOptions, err
+	}
+
+	return certOptions, nil
+}
+
+// getCertSigner returns the external signer given by the global flags, or
+// nil if certificates are signed with the local CA key.
+func getCertSigner(c *cli.Context) (utils.CertSigner, error) {
+	command := c.GlobalString("tls-signer-command")
+	url := c.GlobalString("tls-signer-url")
+
+	if command == "" && url == "" {
+		return nil, nil
+	}
+
+	return utils.NewCertSigner(command, url)
+}
+
 // getCertPaths returns the cert paths
 // codegangsta/cli will not set the cert paths if the storage-path
 // is set to something different so we cannot use the paths
@@ -607,6 +975,7 @@ func getCertPathInfo(c *cli.Context) libmachine.CertPathInfo {
 	return libmachine.CertPathInfo{
 		CaCertPath:     caCertPath,
 		CaKeyPath:      caKeyPath,
+		CaChainPath:    c.GlobalString("tls-ca-chain"),
 		ClientCertPath: clientCertPath,
 		ClientKeyPath:  clientKeyPath,
 	}
@@ -1,11 +1,13 @@
 package commands
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
 
+	"github.com/codegangsta/cli"
 	"github.com/docker/machine/drivers/fakedriver"
 	_ "github.com/docker/machine/drivers/none"
 	"github.com/docker/machine/libmachine"
@@ -220,3 +222,49 @@ func TestRunActionForeachMachine(t *testing.T) {
 		}
 	}
 }
+
+func TestGetMachineName(t *testing.T) {
+	defer cleanup()
+	defer os.Setenv("MACHINE_NAME", os.Getenv("MACHINE_NAME"))
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := getDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(host); err != nil {
+		t.Fatal(err)
+	}
+
+	globalSet := flag.NewFlagSet("test", 0)
+	globalSet.String("storage-path", store.GetPath(), "")
+
+	set := flag.NewFlagSet("url", 0)
+	set.Parse([]string{"other"})
+	if name := getMachineName(cli.NewContext(nil, set, globalSet)); name != "other" {
+		t.Fatalf("expected the machine given; received %s", name)
+	}
+
+	set = flag.NewFlagSet("url", 0)
+	set.Parse([]string{})
+	c := cli.NewContext(nil, set, globalSet)
+
+	os.Setenv("MACHINE_NAME", "from-env")
+	if name := getMachineName(c); name != "from-env" {
+		t.Fatalf("expected the machine in MACHINE_NAME; received %s", name)
+	}
+
+	os.Setenv("MACHINE_NAME", "")
+	os.Setenv("DOCKER_HOST", "")
+	if err := store.SetActive(host); err != nil {
+		t.Fatal(err)
+	}
+	if name := getMachineName(c); name != host.Name {
+		t.Fatalf("expected the active machine %s; received %s", host.Name, name)
+	}
+}
@@ -3,15 +3,15 @@ package commands
 import (
 	"fmt"
 	"net/url"
-	"strings"
 
 	"github.com/codegangsta/cli"
+	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/log"
 	"github.com/docker/machine/utils"
 )
 
 func cmdConfig(c *cli.Context) {
-	if len(c.Args()) != 1 {
+	if len(c.Args()) > 1 {
 		log.Fatal(ErrExpectedOneMachine)
 	}
 	cfg, err := getMachineConfig(c)
@@ -19,31 +19,14 @@ func cmdConfig(c *cli.Context) {
 		log.Fatal(err)
 	}
 
-	dockerHost, err := getHost(c).Driver.GetURL()
-	if err != nil {
-		log.Fatal(err)
+	if cfg.machineUrl == "" {
+		log.Fatalf("%s is not running. Please start this with %s start %s", cfg.machineName, c.App.Name, cfg.machineName)
 	}
 
-	if c.Bool("swarm") {
-		if !cfg.SwarmOptions.Master {
-			log.Fatalf("%s is not a swarm master", cfg.machineName)
-		}
-		u, err := url.Parse(cfg.SwarmOptions.Host)
-		if err != nil {
-			log.Fatal(err)
-		}
-		parts := strings.Split(u.Host, ":")
-		swarmPort := parts[1]
-
-		// get IP of machine to replace in case swarm host is 0.0.0.0
-		mUrl, err := url.Parse(dockerHost)
-		if err != nil {
-			log.Fatal(err)
-		}
-		mParts := strings.Split(mUrl.Host, ":")
-		machineIp := mParts[0]
+	dockerHost := cfg.machineUrl
 
-		dockerHost = fmt.Sprintf("tcp://%s:%s", machineIp, swarmPort)
+	if c.Bool("swarm") {
+		dockerHost = getSwarmMasterURL(c, cfg.machineName)
 	}
 
 	log.Debug(dockerHost)
@@ -68,12 +51,20 @@ func cmdConfig(c *cli.Context) {
 		if !valid {
 			log.Debugf("invalid certs detected; regenerating for %s", u.Host)
 
-			if err := runActionWithContext("configureAuth", c); err != nil {
+			host, err := loadMachine(cfg.machineName, c)
+			if err != nil {
 				log.Fatal(err)
 			}
+			runActionForeachMachine("configureAuth", []*libmachine.Host{host})
 		}
 	}
 
+	// the SSH tunnel to the daemon's unix socket needs no TLS
+	if cfg.EngineOptions.DisableTCP {
+		fmt.Printf("-H=%s", dockerHost)
+		return
+	}
+
 	fmt.Printf("--tlsverify --tlscacert=%q --tlscert=%q --tlskey=%q -H=%s",
 		cfg.caCertPath, cfg.clientCertPath, cfg.clientKeyPath, dockerHost)
 }
@@ -0,0 +1,434 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/utils"
+)
+
+// projectConfigFileName is the name of the per-project config file, looked
+// up in the working directory and its parents
+const projectConfigFileName = ".docker-machine"
+
+// loadedConfig holds the config files and environment variables the app's
+// option defaults were set from.  The app sets some environment variables
+// from its options before running a command, so config-show cannot read
+// them itself.
+var loadedConfig struct {
+	Files []*configFile
+	Env   map[string]string
+}
+
+// configFile holds option defaults read from a config file:
+//
+//	# ~/.docker/machine/config
+//	driver = virtualbox
+//	virtualbox-memory = 2048
+//	engine-insecure-registry = registry.local:5000
+//	engine-insecure-registry = registry.example.com:5000
+//
+// Keys are option names without the leading dashes.  Options which take a
+// list are given once per value; for the others the last value is used.
+// A missing file has no values.
+type configFile struct {
+	Path   string
+	Values map[string][]string
+	// Keys are the keys in the order they first appear
+	Keys []string
+}
+
+func readConfigFile(path string) (*configFile, error) {
+	cfg := &configFile{
+		Path:   path,
+		Values: map[string][]string{},
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(strings.TrimLeft(parts[0], "-"))
+		if len(parts) != 2 || key == "" {
+			return nil, fmt.Errorf("error reading %s: invalid line %d", path, n)
+		}
+
+		if _, ok := cfg.Values[key]; !ok {
+			cfg.Keys = append(cfg.Keys, key)
+		}
+		cfg.Values[key] = append(cfg.Values[key], strings.TrimSpace(parts[1]))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", path, err)
+	}
+
+	return cfg, nil
+}
+
+// getUserConfigFile returns the path of the config file in the storage
+// path, which is the one given on the command line if it is not empty
+func getUserConfigFile(storagePath string) string {
+	if storagePath == "" {
+		storagePath = utils.GetBaseDir()
+	}
+	return filepath.Join(storagePath, "config")
+}
+
+// scanGlobalArgs returns the global options given in args, by each of
+// their names, and the name of the command.  The config files are read
+// before the app parses the command line, which may set the storage path
+// they are in.
+func scanGlobalArgs(flags []cli.Flag, args []string) (map[string]string, string) {
+	byName := map[string]cli.Flag{}
+	for _, f := range flags {
+		names, _ := flagNames(f)
+		for _, name := range names {
+			byName[name] = f
+		}
+	}
+
+	values := map[string]string{}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return values, arg
+		}
+		if arg == "--" {
+			break
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		value := ""
+		hasValue := false
+		if n := strings.Index(name, "="); n >= 0 {
+			name, value, hasValue = name[:n], name[n+1:], true
+		}
+
+		f, ok := byName[name]
+		if !ok {
+			continue
+		}
+
+		switch f.(type) {
+		case cli.BoolFlag, cli.BoolTFlag:
+			continue
+		}
+
+		if !hasValue && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+
+		names, _ := flagNames(f)
+		for _, name := range names {
+			values[name] = value
+		}
+	}
+
+	return values, ""
+}
+
+// findProjectConfigFile returns the path of the project config file in dir
+// or the nearest of its parents, or an empty string if there is none
+func findProjectConfigFile(dir string) string {
+	for {
+		path := filepath.Join(dir, projectConfigFileName)
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadConfigFiles reads the project config file, if any, and the user
+// config file in the storage path, in order of precedence
+func loadConfigFiles(storagePath string) ([]*configFile, error) {
+	paths := []string{}
+
+	if wd, err := os.Getwd(); err == nil {
+		if path := findProjectConfigFile(wd); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	paths = append(paths, getUserConfigFile(storagePath))
+
+	files := []*configFile{}
+	for _, path := range paths {
+		cfg, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, cfg)
+	}
+
+	return files, nil
+}
+
+// configValue returns the values of the option with the given names from
+// the first file which sets it, and that file
+func configValue(files []*configFile, names []string) ([]string, *configFile) {
+	for _, cfg := range files {
+		for _, name := range names {
+			if values, ok := cfg.Values[name]; ok {
+				return values, cfg
+			}
+		}
+	}
+	return nil, nil
+}
+
+// flagNames returns the names of an option, the first being its long name,
+// and the environment variables it is read from
+func flagNames(f cli.Flag) ([]string, []string) {
+	var name, envVar string
+
+	switch f := f.(type) {
+	case cli.StringFlag:
+		name, envVar = f.Name, f.EnvVar
+	case cli.IntFlag:
+		name, envVar = f.Name, f.EnvVar
+	case cli.BoolFlag:
+		name, envVar = f.Name, f.EnvVar
+	case cli.BoolTFlag:
+		name, envVar = f.Name, f.EnvVar
+	case cli.StringSliceFlag:
+		name, envVar = f.Name, f.EnvVar
+	case cli.IntSliceFlag:
+		name, envVar = f.Name, f.EnvVar
+	case cli.DurationFlag:
+		name, envVar = f.Name, f.EnvVar
+	case cli.Float64Flag:
+		name, envVar = f.Name, f.EnvVar
+	case cli.GenericFlag:
+		name, envVar = f.Name, f.EnvVar
+	}
+
+	return splitNames(name), splitNames(envVar)
+}
+
+func splitNames(s string) []string {
+	names := []string{}
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// withConfigDefaults returns a copy of flags whose defaults are the values
+// in files.  The flag package appends list options given on the command
+// line to their default, so their values are instead set by the returned
+// function, which must run once the command line is parsed.
+func withConfigDefaults(flags []cli.Flag, files []*configFile) ([]cli.Flag, func(), error) {
+	result := make([]cli.Flag, len(flags))
+	lists := map[*cli.StringSlice][]string{}
+
+	for i, f := range flags {
+		result[i] = f
+
+		names, _ := flagNames(f)
+		values, cfg := configValue(files, names)
+		if cfg == nil {
+			continue
+		}
+		value := values[len(values)-1]
+
+		switch f := f.(type) {
+		case cli.StringFlag:
+			f.Value = value
+			result[i] = f
+		case cli.IntFlag:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid value %q for %s in %s: expected a number", value, names[0], cfg.Path)
+			}
+			f.Value = n
+			result[i] = f
+		case cli.BoolFlag, cli.BoolTFlag:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid value %q for %s in %s: expected true or false", value, names[0], cfg.Path)
+			}
+			result[i] = boolFlagWithDefault(f, b)
+		case cli.StringSliceFlag:
+			list := &cli.StringSlice{}
+			lists[list] = values
+			f.Value = list
+			result[i] = f
+		default:
+			return nil, nil, fmt.Errorf("%s cannot be set in %s", names[0], cfg.Path)
+		}
+	}
+
+	setLists := func() {
+		for list, values := range lists {
+			// an environment variable replaces the list the flag set
+			// parses into, leaving this one empty as well
+			if len(*list) == 0 {
+				*list = append(*list, values...)
+			}
+		}
+	}
+
+	return result, setLists, nil
+}
+
+// boolFlagWithDefault returns the boolean option f with the default value,
+// BoolFlag defaulting to false and BoolTFlag to true
+func boolFlagWithDefault(f cli.Flag, value bool) cli.Flag {
+	var name, usage, envVar string
+
+	switch f := f.(type) {
+	case cli.BoolFlag:
+		name, usage, envVar = f.Name, f.Usage, f.EnvVar
+	case cli.BoolTFlag:
+		name, usage, envVar = f.Name, f.Usage, f.EnvVar
+	}
+
+	if value {
+		return cli.BoolTFlag{Name: name, Usage: usage, EnvVar: envVar}
+	}
+	return cli.BoolFlag{Name: name, Usage: usage, EnvVar: envVar}
+}
+
+// configurableFlags returns the options which can be set in the config
+// files by long name: the global options and those of create
+func configurableFlags(app *cli.App) map[string]cli.Flag {
+	flags := map[string]cli.Flag{}
+
+	addFlags := func(fs []cli.Flag) {
+		for _, f := range fs {
+			if names, _ := flagNames(f); len(names) > 0 {
+				flags[names[0]] = f
+			}
+		}
+	}
+
+	addFlags(app.Flags)
+	for _, cmd := range app.Commands {
+		if cmd.HasName("create") {
+			addFlags(cmd.Flags)
+		}
+	}
+
+	return flags
+}
+
+// unknownConfigKeys returns a warning for each key in files which is not
+// the name of one of flags, as it is ignored
+func unknownConfigKeys(flags map[string]cli.Flag, files []*configFile) []string {
+	known := map[string]bool{}
+	for _, f := range flags {
+		names, _ := flagNames(f)
+		for _, name := range names {
+			known[name] = true
+		}
+	}
+
+	warnings := []string{}
+	for _, cfg := range files {
+		for _, key := range cfg.Keys {
+			if !known[key] {
+				warnings = append(warnings, fmt.Sprintf("%s: unknown option %q; only the global options and those of create can be set", cfg.Path, key))
+			}
+		}
+	}
+
+	return warnings
+}
+
+// ApplyConfigDefaults makes the values in the project and user config
+// files the defaults of the global options and those of create, which
+// environment variables and the command line override.  Other commands
+// are left alone, so that e.g. swarm = true only affects create; keys which
+// are not one of these options are reported on stderr.  args is the
+// command line, which is scanned for the storage path.
+func ApplyConfigDefaults(app *cli.App, args []string) error {
+	globals, command := scanGlobalArgs(app.Flags, args)
+
+	files, err := loadConfigFiles(globals["storage-path"])
+	if err != nil {
+		return err
+	}
+
+	// config-show reports them itself
+	if command != "config-show" {
+		for _, warning := range unknownConfigKeys(configurableFlags(app), files) {
+			fmt.Fprintln(os.Stderr, warning)
+		}
+	}
+
+	loadedConfig.Files = files
+	loadedConfig.Env = map[string]string{}
+	for _, f := range configurableFlags(app) {
+		_, envVars := flagNames(f)
+		for _, envVar := range envVars {
+			if value := os.Getenv(envVar); value != "" {
+				loadedConfig.Env[envVar] = value
+			}
+		}
+	}
+
+	flags, setLists, err := withConfigDefaults(app.Flags, files)
+	if err != nil {
+		return err
+	}
+	app.Flags = flags
+
+	before := app.Before
+	app.Before = func(c *cli.Context) error {
+		setLists()
+		if before != nil {
+			return before(c)
+		}
+		return nil
+	}
+
+	commands := make([]cli.Command, len(app.Commands))
+	copy(commands, app.Commands)
+
+	for i, cmd := range commands {
+		if !cmd.HasName("create") {
+			continue
+		}
+
+		flags, setCreateLists, err := withConfigDefaults(cmd.Flags, files)
+		if err != nil {
+			return err
+		}
+
+		action := cmd.Action
+		commands[i].Flags = flags
+		commands[i].Action = func(c *cli.Context) {
+			setCreateLists()
+			action(c)
+		}
+	}
+	app.Commands = commands
+
+	return nil
+}
@@ -0,0 +1,345 @@
+package commands
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codegangsta/cli"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "config")
+	data := `# defaults
+driver = virtualbox
+--virtualbox-memory=2048
+
+; registries
+engine-insecure-registry = a:5000
+engine-insecure-registry = b:5000
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"driver":                   {"virtualbox"},
+		"virtualbox-memory":        {"2048"},
+		"engine-insecure-registry": {"a:5000", "b:5000"},
+	}
+	if !reflect.DeepEqual(cfg.Values, expected) {
+		t.Fatalf("expected %v; received %v", expected, cfg.Values)
+	}
+
+	expectedKeys := []string{"driver", "virtualbox-memory", "engine-insecure-registry"}
+	if !reflect.DeepEqual(cfg.Keys, expectedKeys) {
+		t.Fatalf("expected keys %v; received %v", expectedKeys, cfg.Keys)
+	}
+
+	cfg, err = readConfigFile(filepath.Join(tmpDir, "missing"))
+	if err != nil || len(cfg.Values) != 0 {
+		t.Fatalf("expected no values from a missing file; received %v, %v", cfg, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("[default]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readConfigFile(path); err == nil {
+		t.Fatal("expected error with an invalid line")
+	}
+}
+
+func TestFindProjectConfigFile(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dir := filepath.Join(tmpDir, "project", "src", "app")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if path := findProjectConfigFile(dir); path != "" {
+		t.Fatalf("expected no project config file; received %s", path)
+	}
+
+	path := filepath.Join(tmpDir, "project", projectConfigFileName)
+	if err := ioutil.WriteFile(path, []byte("driver = none\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if found := findProjectConfigFile(dir); found != path {
+		t.Fatalf("expected %s; received %s", path, found)
+	}
+}
+
+var testConfigFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "driver, d",
+		EnvVar: "MACHINE_TEST_DRIVER",
+		Value:  "none",
+	},
+	cli.IntFlag{
+		Name: "memory",
+	},
+	cli.BoolFlag{
+		Name: "swarm",
+	},
+	cli.BoolTFlag{
+		Name: "provision",
+	},
+	cli.StringSliceFlag{
+		Name:  "registry",
+		Value: &cli.StringSlice{},
+	},
+}
+
+var testConfigFiles = []*configFile{
+	{
+		Path: "project",
+		Values: map[string][]string{
+			"d": {"virtualbox"},
+		},
+	},
+	{
+		Path: "user",
+		Values: map[string][]string{
+			"driver":    {"amazonec2"},
+			"memory":    {"2048"},
+			"swarm":     {"true"},
+			"provision": {"false"},
+			"registry":  {"a:5000", "b:5000"},
+		},
+	},
+}
+
+func parseWithConfigDefaults(t *testing.T, files []*configFile, args ...string) *cli.Context {
+	flags, setLists, err := withConfigDefaults(testConfigFlags, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := flag.NewFlagSet("test", 0)
+	for _, f := range flags {
+		f.Apply(set)
+	}
+
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	setLists()
+
+	return cli.NewContext(nil, set, set)
+}
+
+func TestWithConfigDefaults(t *testing.T) {
+	c := parseWithConfigDefaults(t, testConfigFiles)
+
+	if driver := c.String("driver"); driver != "virtualbox" {
+		t.Fatalf("expected the project file's driver virtualbox; received %s", driver)
+	}
+
+	if memory := c.Int("memory"); memory != 2048 {
+		t.Fatalf("expected memory 2048; received %d", memory)
+	}
+
+	if !c.Bool("swarm") {
+		t.Fatal("expected swarm to default to true")
+	}
+
+	if c.Bool("provision") {
+		t.Fatal("expected provision to default to false")
+	}
+
+	expected := []string{"a:5000", "b:5000"}
+	if registries := c.StringSlice("registry"); !reflect.DeepEqual(registries, expected) {
+		t.Fatalf("expected registries %v; received %v", expected, registries)
+	}
+
+	os.Setenv("MACHINE_TEST_DRIVER", "google")
+	defer os.Setenv("MACHINE_TEST_DRIVER", "")
+
+	c = parseWithConfigDefaults(t, testConfigFiles)
+
+	if driver := c.String("driver"); driver != "google" {
+		t.Fatalf("expected the environment's driver google; received %s", driver)
+	}
+
+	c = parseWithConfigDefaults(t, testConfigFiles, "--driver", "digitalocean", "--swarm=false", "--registry", "c:5000")
+
+	if driver := c.String("driver"); driver != "digitalocean" {
+		t.Fatalf("expected the command line's driver digitalocean; received %s", driver)
+	}
+
+	if c.Bool("swarm") {
+		t.Fatal("expected swarm to be disabled by the command line")
+	}
+
+	expected = []string{"c:5000"}
+	if registries := c.StringSlice("registry"); !reflect.DeepEqual(registries, expected) {
+		t.Fatalf("expected registries %v; received %v", expected, registries)
+	}
+}
+
+func TestWithConfigDefaultsInvalidValue(t *testing.T) {
+	files := []*configFile{
+		{
+			Path: "user",
+			Values: map[string][]string{
+				"memory": {"lots"},
+			},
+		},
+	}
+
+	if _, _, err := withConfigDefaults(testConfigFlags, files); err == nil {
+		t.Fatal("expected error with an invalid number")
+	}
+}
+
+func TestGetConfigSources(t *testing.T) {
+	flags := map[string]cli.Flag{}
+	for _, f := range testConfigFlags {
+		names, _ := flagNames(f)
+		flags[names[0]] = f
+	}
+
+	env := map[string]string{
+		"MACHINE_TEST_DRIVER": "google",
+	}
+
+	sources := getConfigSources(flags, env, testConfigFiles)
+
+	expected := []configSource{
+		{Option: "driver", Value: "google", Source: "MACHINE_TEST_DRIVER", Overrides: []string{"project", "user"}},
+		{Option: "memory", Value: "2048", Source: "user"},
+		{Option: "provision", Value: "false", Source: "user"},
+		{Option: "registry", Value: "a:5000, b:5000", Source: "user"},
+		{Option: "swarm", Value: "true", Source: "user"},
+	}
+
+	if !reflect.DeepEqual(sources, expected) {
+		t.Fatalf("expected %v; received %v", expected, sources)
+	}
+}
+
+func TestApplyConfigDefaults(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// the storage path on the command line wins over the environment
+	os.Setenv("MACHINE_STORAGE_PATH", filepath.Join(tmpDir, "other"))
+	defer os.Setenv("MACHINE_STORAGE_PATH", "")
+
+	if err := ioutil.WriteFile(getUserConfigFile(tmpDir), []byte("swarm = true\nmemory = 2048\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	swarm := map[string]bool{}
+	swarmAction := func(c *cli.Context) {
+		swarm[c.Command.Name] = c.Bool("swarm")
+	}
+
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.IntFlag{Name: "memory"},
+		cli.StringFlag{Name: "s, storage-path"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:   "create",
+			Flags:  []cli.Flag{cli.BoolFlag{Name: "swarm"}},
+			Action: swarmAction,
+		},
+		{
+			Name:   "env",
+			Flags:  []cli.Flag{cli.BoolFlag{Name: "swarm"}},
+			Action: swarmAction,
+		},
+	}
+
+	memory := 0
+	app.Before = func(c *cli.Context) error {
+		memory = c.GlobalInt("memory")
+		return nil
+	}
+
+	if err := ApplyConfigDefaults(app, []string{"docker-machine", "-s", tmpDir, "create"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, command := range []string{"create", "env"} {
+		app.Run([]string{"docker-machine", "-s", tmpDir, command})
+	}
+
+	if memory != 2048 {
+		t.Fatalf("expected the global option memory to be 2048; received %d", memory)
+	}
+
+	if !swarm["create"] {
+		t.Fatal("expected swarm to default to true for create")
+	}
+
+	if swarm["env"] {
+		t.Fatal("expected the config file to leave the swarm option of env alone")
+	}
+}
+
+func TestScanGlobalArgs(t *testing.T) {
+	flags := []cli.Flag{
+		cli.BoolFlag{Name: "D, debug"},
+		cli.StringFlag{Name: "s, storage-path"},
+		cli.StringFlag{Name: "tls-ca-cert"},
+	}
+
+	for _, c := range []struct {
+		args        []string
+		storagePath string
+		command     string
+	}{
+		{[]string{"docker-machine", "ls"}, "", "ls"},
+		{[]string{"docker-machine", "--storage-path", "/store", "ls"}, "/store", "ls"},
+		{[]string{"docker-machine", "-D", "-s", "/store", "create", "-s", "/other"}, "/store", "create"},
+		{[]string{"docker-machine", "--tls-ca-cert=/ca.pem", "--storage-path=/store", "env"}, "/store", "env"},
+		{[]string{"docker-machine", "--tls-ca-cert", "ls"}, "", ""},
+	} {
+		values, command := scanGlobalArgs(flags, c.args)
+		if values["storage-path"] != c.storagePath || values["s"] != c.storagePath || command != c.command {
+			t.Fatalf("%v: expected storage path %q and command %q; received %q and %q", c.args, c.storagePath, c.command, values["storage-path"], command)
+		}
+	}
+}
+
+func TestUnknownConfigKeys(t *testing.T) {
+	flags := map[string]cli.Flag{
+		"driver": cli.StringFlag{Name: "d, driver"},
+	}
+	files := []*configFile{
+		{Path: "user", Keys: []string{"d", "driver", "format"}},
+	}
+
+	warnings := unknownConfigKeys(flags, files)
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], `user: unknown option "format"`) {
+		t.Fatalf("expected a warning for format only; received %v", warnings)
+	}
+}
@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/log"
+)
+
+// configSource is where the effective value of an option comes from
+type configSource struct {
+	Option string
+	Value  string
+	Source string
+	// Overrides are the sources with a value the effective one replaces
+	Overrides []string
+}
+
+// getConfigSources returns the sources of the options set by a variable in
+// env or in files, which are in order of precedence, sorted by option
+func getConfigSources(flags map[string]cli.Flag, env map[string]string, files []*configFile) []configSource {
+	options := []string{}
+	for option := range flags {
+		options = append(options, option)
+	}
+	sort.Strings(options)
+
+	sources := []configSource{}
+	for _, option := range options {
+		names, envVars := flagNames(flags[option])
+		source := configSource{Option: option}
+
+		for _, envVar := range envVars {
+			if value := env[envVar]; value != "" {
+				source.Value = value
+				source.Source = envVar
+				break
+			}
+		}
+
+		for _, cfg := range files {
+			values, found := configValue([]*configFile{cfg}, names)
+			if found == nil {
+				continue
+			}
+
+			if source.Source != "" {
+				source.Overrides = append(source.Overrides, cfg.Path)
+				continue
+			}
+
+			if _, isList := flags[option].(cli.StringSliceFlag); isList {
+				source.Value = strings.Join(values, ", ")
+			} else {
+				source.Value = values[len(values)-1]
+			}
+			source.Source = cfg.Path
+		}
+
+		if source.Source != "" {
+			sources = append(sources, source)
+		}
+	}
+
+	return sources
+}
+
+func cmdConfigShow(c *cli.Context) {
+	if len(c.Args()) > 0 {
+		log.Fatal("Error: Too many arguments given.")
+	}
+
+	files := loadedConfig.Files
+	flags := configurableFlags(c.App)
+
+	for _, warning := range unknownConfigKeys(flags, files) {
+		log.Warn(warning)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "OPTION\tVALUE\tSOURCE")
+
+	for _, source := range getConfigSources(flags, loadedConfig.Env, files) {
+		from := source.Source
+		if len(source.Overrides) > 0 {
+			from = fmt.Sprintf("%s (overrides %s)", from, strings.Join(source.Overrides, ", "))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", source.Option, source.Value, from)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/codegangsta/cli"
+)
+
+func TestCmdConfigShow(t *testing.T) {
+	stdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	files, env := loadedConfig.Files, loadedConfig.Env
+	defer func() {
+		os.Stdout = stdout
+		loadedConfig.Files, loadedConfig.Env = files, env
+	}()
+
+	loadedConfig.Files = []*configFile{
+		{
+			Path: "project",
+			Values: map[string][]string{
+				"driver": {"virtualbox"},
+				"format": {"{{.Name}}"},
+			},
+			Keys: []string{"driver", "format"},
+		},
+		{
+			Path: "user",
+			Values: map[string][]string{
+				"driver":   {"amazonec2"},
+				"memory":   {"2048"},
+				"registry": {"a:5000", "b:5000"},
+			},
+			Keys: []string{"driver", "memory", "registry"},
+		},
+	}
+	loadedConfig.Env = map[string]string{
+		"MACHINE_TEST_DRIVER": "google",
+	}
+
+	outStr := make(chan string)
+
+	go func() {
+		var testOutput bytes.Buffer
+		io.Copy(&testOutput, r)
+		outStr <- testOutput.String()
+	}()
+
+	set := flag.NewFlagSet("config-show", 0)
+	set.Parse([]string{})
+	c := cli.NewContext(nil, set, set)
+	c.App = &cli.App{
+		Name: "docker-machine-test",
+		Commands: []cli.Command{
+			{
+				Name:  "create",
+				Flags: testConfigFlags,
+			},
+			{
+				Name: "inspect",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "format"},
+				},
+			},
+		},
+	}
+	cmdConfigShow(c)
+
+	w.Close()
+
+	out := <-outStr
+
+	// format is only an option of inspect, which the files do not set
+	if !strings.Contains(out, `project: unknown option "format"`) {
+		t.Fatalf("expected a warning for the unknown option format; received %q", out)
+	}
+
+	for _, key := range []string{"driver", "memory", "registry"} {
+		if strings.Contains(out, "unknown option \""+key+"\"") {
+			t.Fatalf("expected no warning for %s; received %q", key, out)
+		}
+	}
+
+	lines := map[string][]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			lines[fields[0]] = fields[1:]
+		}
+	}
+
+	expected := map[string]string{
+		"driver":   "google MACHINE_TEST_DRIVER (overrides project, user)",
+		"memory":   "2048 user",
+		"registry": "a:5000, b:5000 user",
+	}
+	for option, fields := range expected {
+		if received := strings.Join(lines[option], " "); received != fields {
+			t.Fatalf("expected %s to be shown as %q; received %q", option, fields, received)
+		}
+	}
+
+	if _, ok := lines["format"]; ok {
+		t.Fatalf("expected format not to be shown; received %q", out)
+	}
+}
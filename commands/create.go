@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/docker/machine/log"
@@ -11,7 +12,7 @@ import (
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/engine"
-	"github.com/docker/machine/libmachine/swarm"
+	"github.com/docker/machine/libmachine/hooks"
 	"github.com/docker/machine/utils"
 )
 
@@ -37,14 +38,32 @@ func cmdCreate(c *cli.Context) {
 
 	certInfo := getCertPathInfo(c)
 
+	certOptions, err := getCertOptions(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signer, err := getCertSigner(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	if err := setupCertificates(
 		certInfo.CaCertPath,
 		certInfo.CaKeyPath,
 		certInfo.ClientCertPath,
-		certInfo.ClientKeyPath); err != nil {
+		certInfo.ClientKeyPath,
+		certOptions,
+		signer); err != nil {
 		log.Fatalf("Error generating certificates: %s", err)
 	}
 
+	if certInfo.CaChainPath != "" {
+		if err := utils.ValidateCAChain(certInfo.CaCertPath, certInfo.CaChainPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	defaultStore, err := getDefaultStore(
 		c.GlobalString("storage-path"),
 		certInfo.CaCertPath,
@@ -59,30 +78,78 @@ func cmdCreate(c *cli.Context) {
 		log.Fatal(err)
 	}
 
+	// fail early rather than after the machine has been created
+	for _, localPath := range []string{c.String("engine-install-package"), c.String("swarm-image-archive")} {
+		if localPath == "" {
+			continue
+		}
+		if _, err := os.Stat(localPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	hookOptions, err := hooks.NewHookOptions(c.StringSlice("hook-script"), c.StringSlice("hook-file"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	hostOptions := &libmachine.HostOptions{
+		CloudInit: c.Bool("cloud-init"),
 		AuthOptions: &auth.AuthOptions{
-			CaCertPath:     certInfo.CaCertPath,
-			PrivateKeyPath: certInfo.CaKeyPath,
-			ClientCertPath: certInfo.ClientCertPath,
-			ClientKeyPath:  certInfo.ClientKeyPath,
-			ServerCertPath: filepath.Join(utils.GetMachineDir(), name, "server.pem"),
-			ServerKeyPath:  filepath.Join(utils.GetMachineDir(), name, "server-key.pem"),
+			CaCertPath:       certInfo.CaCertPath,
+			PrivateKeyPath:   certInfo.CaKeyPath,
+			ClientCertPath:   certInfo.ClientCertPath,
+			ClientKeyPath:    certInfo.ClientKeyPath,
+			ServerCertPath:   filepath.Join(utils.GetMachineDir(), name, "server.pem"),
+			ServerKeyPath:    filepath.Join(utils.GetMachineDir(), name, "server-key.pem"),
+			ServerCertSANs:   c.StringSlice("tls-san"),
+			KeyAlgorithm:     certOptions.KeyAlgorithm,
+			KeySize:          certOptions.KeySize,
+			CertValidityDays: certOptions.ValidityDays,
+			CaChainPath:      certInfo.CaChainPath,
+			SignerCommand:    c.GlobalString("tls-signer-command"),
+			SignerURL:        c.GlobalString("tls-signer-url"),
+			// an empty org defaults to the machine name for server certs
+			CertOrg: c.GlobalString("tls-cert-org"),
 		},
 		EngineOptions: &engine.EngineOptions{
-			ArbitraryFlags:   c.StringSlice("engine-flag"),
-			InsecureRegistry: c.StringSlice("engine-insecure-registry"),
-			Labels:           c.StringSlice("engine-label"),
-			RegistryMirror:   c.StringSlice("engine-registry-mirror"),
-			StorageDriver:    c.String("engine-storage-driver"),
-			TlsVerify:        true,
-		},
-		SwarmOptions: &swarm.SwarmOptions{
-			IsSwarm:   c.Bool("swarm"),
-			Master:    c.Bool("swarm-master"),
-			Discovery: c.String("swarm-discovery"),
-			Address:   c.String("swarm-addr"),
-			Host:      c.String("swarm-host"),
+			ArbitraryFlags:      c.StringSlice("engine-opt"),
+			BindAddress:         c.String("engine-bind-address"),
+			DisableTCP:          c.Bool("engine-no-tcp"),
+			DisableDriverLabels: c.Bool("engine-no-driver-labels"),
+			Dns:                 c.StringSlice("engine-dns"),
+			Env:                 c.StringSlice("engine-env"),
+			GraphDir:            c.String("engine-graph-dir"),
+			InsecureRegistry:    c.StringSlice("engine-insecure-registry"),
+			InstallPackage:      c.String("engine-install-package"),
+			InstallURL:          c.String("engine-install-url"),
+			Ipv6:                c.Bool("engine-ipv6"),
+			Labels:              c.StringSlice("engine-label"),
+			LogLevel:            c.String("engine-log-level"),
+			Port:                c.Int("engine-port"),
+			RegistryMirror:      c.StringSlice("engine-registry-mirror"),
+			SelinuxEnabled:      c.Bool("engine-selinux"),
+			StorageDriver:       c.String("engine-storage-driver"),
+			Version:             c.String("engine-version"),
 		},
+		HookOptions:  hookOptions,
+		SwarmOptions: getSwarmOptions(c),
+	}
+
+	if err := hostOptions.EngineOptions.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := hostOptions.SwarmOptions.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	if hostOptions.EngineOptions.DisableTCP && hostOptions.SwarmOptions.IsSwarm {
+		log.Fatal("Swarm requires the engine's TCP socket; --engine-no-tcp cannot be used with --swarm")
+	}
+
+	if hostOptions.EngineOptions.BindAddress == engine.BindPrivate && hostOptions.CloudInit {
+		log.Fatal("--engine-bind-address=private is not supported with --cloud-init; give the IP instead")
 	}
 
 	_, err = mcn.Create(name, driver, hostOptions, c)
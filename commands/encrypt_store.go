@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/log"
+	"github.com/docker/machine/utils"
+)
+
+// getStoreSecretFiles returns the CA key and, for each machine, its config,
+// credentials and the server and SSH keys kept in the machine's directory.  Client keys
+// are read by the Docker client and are left alone.
+func getStoreSecretFiles(c *cli.Context) []string {
+	files := []string{getCertPathInfo(c).CaKeyPath}
+
+	machines, err := getDefaultMcn(c).List()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, host := range machines {
+		files = append(files, filepath.Join(host.StorePath, "config.json"), host.CredentialsPath())
+
+		keys := []string{host.Driver.GetSSHKeyPath()}
+		if host.HostOptions != nil && host.HostOptions.AuthOptions != nil {
+			keys = append(keys, host.HostOptions.AuthOptions.ServerKeyPath)
+		}
+
+		// keys outside the store, such as the generic driver's, belong to
+		// the user
+		for _, key := range keys {
+			if key != "" && strings.HasPrefix(key, host.StorePath+string(filepath.Separator)) {
+				files = append(files, key)
+			}
+		}
+	}
+
+	return files
+}
+
+func cmdEncryptStore(c *cli.Context) {
+	if !utils.StorageEncryptionEnabled() {
+		log.Fatal("Set MACHINE_STORAGE_PASSPHRASE or --storage-key-file to the secret the store is encrypted with")
+	}
+
+	convert, verb := utils.EncryptFile, "Encrypted"
+	if c.Bool("decrypt") {
+		convert, verb = utils.DecryptFile, "Decrypted"
+	}
+
+	converted := 0
+	for _, file := range getStoreSecretFiles(c) {
+		changed, err := convert(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			log.Fatal(err)
+		}
+
+		if changed {
+			log.Debugf("%s %s", verb, file)
+			converted++
+		}
+	}
+
+	log.Infof("%s %d file(s)", verb, converted)
+}
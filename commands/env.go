@@ -5,12 +5,12 @@ import (
 	"fmt"
 	"net/url"
 	"os"
-	"strings"
 	"text/template"
 
 	"github.com/docker/machine/log"
 
 	"github.com/codegangsta/cli"
+	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/utils"
 )
 
@@ -19,7 +19,7 @@ const (
 )
 
 var (
-	improperEnvArgsError = errors.New("Error: Expected either one machine name, or -u flag to unset the variables in the arguments.")
+	improperEnvArgsError = errors.New("Error: Expected at most one machine name, or -u flag to unset the variables in the arguments.")
 )
 
 type ShellConfig struct {
@@ -33,7 +33,7 @@ type ShellConfig struct {
 }
 
 func cmdEnv(c *cli.Context) {
-	if len(c.Args()) != 1 && !c.Bool("unset") {
+	if len(c.Args()) > 1 {
 		log.Fatal(improperEnvArgsError)
 	}
 	userShell := c.String("shell")
@@ -102,25 +102,7 @@ func cmdEnv(c *cli.Context) {
 
 	dockerHost := cfg.machineUrl
 	if c.Bool("swarm") {
-		if !cfg.SwarmOptions.Master {
-			log.Fatalf("%s is not a swarm master", cfg.machineName)
-		}
-		u, err := url.Parse(cfg.SwarmOptions.Host)
-		if err != nil {
-			log.Fatal(err)
-		}
-		parts := strings.Split(u.Host, ":")
-		swarmPort := parts[1]
-
-		// get IP of machine to replace in case swarm host is 0.0.0.0
-		mUrl, err := url.Parse(cfg.machineUrl)
-		if err != nil {
-			log.Fatal(err)
-		}
-		mParts := strings.Split(mUrl.Host, ":")
-		machineIp := mParts[0]
-
-		dockerHost = fmt.Sprintf("tcp://%s:%s", machineIp, swarmPort)
+		dockerHost = getSwarmMasterURL(c, cfg.machineName)
 	}
 
 	u, err := url.Parse(cfg.machineUrl)
@@ -143,9 +125,11 @@ func cmdEnv(c *cli.Context) {
 		if !valid {
 			log.Debugf("invalid certs detected; regenerating for %s", u.Host)
 
-			if err := runActionWithContext("configureAuth", c); err != nil {
+			host, err := loadMachine(cfg.machineName, c)
+			if err != nil {
 				log.Fatal(err)
 			}
+			runActionForeachMachine("configureAuth", []*libmachine.Host{host})
 		}
 	}
 
@@ -156,6 +140,13 @@ func cmdEnv(c *cli.Context) {
 		UsageHint:       usageHint,
 	}
 
+	// the SSH tunnel to the daemon's unix socket needs no TLS
+	if cfg.EngineOptions.DisableTCP {
+		shellCfg.DockerCertPath = ""
+		shellCfg.DockerTLSVerify = ""
+		shellCfg.UsageHint = fmt.Sprintf("# Keep a tunnel to the daemon open with: %s tunnel %s\n%s", c.App.Name, cfg.machineName, usageHint)
+	}
+
 	switch userShell {
 	case "fish":
 		shellCfg.Prefix = "set -x "
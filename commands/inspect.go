@@ -6,6 +6,7 @@ import (
 	"os"
 	"text/template"
 
+	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/log"
 
 	"github.com/codegangsta/cli"
@@ -22,6 +23,19 @@ var funcMap = template.FuncMap{
 	},
 }
 
+// inspectHost adds the details which are not stored in the host's config
+type inspectHost struct {
+	*libmachine.Host
+	CertExpiry libmachine.CertExpiry
+}
+
+func newInspectHost(host *libmachine.Host) inspectHost {
+	return inspectHost{
+		Host:       host,
+		CertExpiry: host.GetCertExpiry(),
+	}
+}
+
 func cmdInspect(c *cli.Context) {
 	tmplString := c.String("format")
 	if tmplString != "" {
@@ -31,7 +45,7 @@ func cmdInspect(c *cli.Context) {
 			log.Fatalf("Template parsing error: %v\n", err)
 		}
 
-		jsonHost, err := json.Marshal(getHost(c))
+		jsonHost, err := json.Marshal(newInspectHost(getHost(c)))
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -45,7 +59,7 @@ func cmdInspect(c *cli.Context) {
 		}
 		os.Stderr.Write([]byte{'\n'})
 	} else {
-		prettyJSON, err := json.MarshalIndent(getHost(c), "", "    ")
+		prettyJSON, err := json.MarshalIndent(newInspectHost(getHost(c)), "", "    ")
 		if err != nil {
 			log.Fatal(err)
 		}
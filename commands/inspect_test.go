@@ -19,7 +19,7 @@ import (
 
 func TestCmdInspectFormat(t *testing.T) {
 	actual, host := runInspectCommand(t, []string{"test-a"})
-	expected, _ := json.MarshalIndent(host, "", "    ")
+	expected, _ := json.MarshalIndent(newInspectHost(host), "", "    ")
 	assert.Equal(t, string(expected), actual)
 
 	actual, _ = runInspectCommand(t, []string{"--format", "{{.DriverName}}", "test-a"})
@@ -7,6 +7,10 @@ import (
 )
 
 func cmdKill(c *cli.Context) {
+	if len(c.Args()) == 0 {
+		log.Fatal(ErrNoMachineSpecified)
+	}
+
 	if err := runActionWithContext("kill", c); err != nil {
 		log.Fatal(err)
 	}
@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/state"
 )
 
 func cmdLs(c *cli.Context) {
@@ -27,26 +30,39 @@ func cmdLs(c *cli.Context) {
 		return
 	}
 
-	swarmMasters := make(map[string]string)
-	swarmInfo := make(map[string]string)
-
 	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
-	fmt.Fprintln(w, "NAME\tACTIVE\tDRIVER\tSTATE\tURL\tSWARM")
+	fmt.Fprintln(w, "NAME\tACTIVE\tDRIVER\tSTATE\tURL\tSWARM\tDOCKER\tCERTS")
 
-	for _, host := range hostList {
-		swarmOptions := host.HostOptions.SwarmOptions
-		if swarmOptions.Master {
-			swarmMasters[swarmOptions.Discovery] = host.Name
-		}
+	items := libmachine.GetHostListItems(hostList)
+
+	sortHostListItemsByName(items)
 
-		if swarmOptions.Discovery != "" {
-			swarmInfo[host.Name] = swarmOptions.Discovery
+	// the machine recorded by use takes precedence over DOCKER_HOST, and
+	// like it is not active while stopped
+	activeName, err := mcn.GetActiveName()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if activeName != "" {
+		for i := range items {
+			items[i].Active = items[i].Name == activeName && items[i].State != state.Stopped
 		}
 	}
 
-	items := libmachine.GetHostListItems(hostList)
+	// the masters of each discovery, the primary of replicated ones first
+	swarmMasters := make(map[string][]string)
+	for _, item := range items {
+		if !item.SwarmOptions.Master || item.SwarmOptions.Discovery == "" {
+			continue
+		}
 
-	sortHostListItemsByName(items)
+		discovery := item.SwarmOptions.Discovery
+		if item.SwarmRole == "primary" {
+			swarmMasters[discovery] = append([]string{fmt.Sprintf("%s (primary)", item.Name)}, swarmMasters[discovery]...)
+		} else {
+			swarmMasters[discovery] = append(swarmMasters[discovery], item.Name)
+		}
+	}
 
 	for _, item := range items {
 		activeString := ""
@@ -57,14 +73,25 @@ func cmdLs(c *cli.Context) {
 		swarmInfo := ""
 
 		if item.SwarmOptions.Discovery != "" {
-			swarmInfo = swarmMasters[item.SwarmOptions.Discovery]
+			swarmInfo = strings.Join(swarmMasters[item.SwarmOptions.Discovery], ", ")
 			if item.SwarmOptions.Master {
 				swarmInfo = fmt.Sprintf("%s (master)", swarmInfo)
 			}
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
-			item.Name, activeString, item.DriverName, item.State, item.URL, swarmInfo)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			item.Name, activeString, item.DriverName, item.State, item.URL, swarmInfo, item.DockerVersion, formatCertExpiry(item.CertExpiry))
 	}
 
 	w.Flush()
 }
+
+// formatCertExpiry shows when the first of a machine's certificates expires
+func formatCertExpiry(expiry time.Time) string {
+	switch {
+	case expiry.IsZero():
+		return ""
+	case expiry.Before(time.Now()):
+		return "expired"
+	}
+	return expiry.Format("2006-01-02")
+}
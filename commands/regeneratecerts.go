@@ -6,6 +6,10 @@ import (
 )
 
 func cmdRegenerateCerts(c *cli.Context) {
+	if len(c.Args()) == 0 {
+		log.Fatal(ErrNoMachineSpecified)
+	}
+
 	force := c.Bool("force")
 	if force || confirmInput("Regenerate TLS machine certs?  Warning: this is irreversible.") {
 		log.Infof("Regenerating TLS certificates")
@@ -7,6 +7,10 @@ import (
 )
 
 func cmdRestart(c *cli.Context) {
+	if len(c.Args()) == 0 {
+		log.Fatal(ErrNoMachineSpecified)
+	}
+
 	if err := runActionWithContext("restart", c); err != nil {
 		log.Fatal(err)
 	}
@@ -18,11 +18,7 @@ func cmdSsh(c *cli.Context) {
 		err    error
 	)
 
-	if len(c.Args()) == 0 {
-		log.Fatal("Error: Please specify a machine name.")
-	}
-
-	name := c.Args().First()
+	name := getMachineName(c)
 
 	certInfo := getCertPathInfo(c)
 	defaultStore, err := getDefaultStore(
@@ -53,7 +49,7 @@ func cmdSsh(c *cli.Context) {
 		}
 	}
 
-	if len(c.Args()) == 1 {
+	if len(c.Args()) <= 1 {
 		err = host.CreateSSHShell()
 	} else {
 		var (
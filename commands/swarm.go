@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/log"
+)
+
+func cmdSwarmAdd(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		log.Fatal(ErrExpectedOneMachine)
+	}
+
+	host := getHost(c)
+	swarmOptions := getSwarmOptions(c)
+
+	log.Infof("Adding %s to the swarm...", host.Name)
+	if err := getDefaultMcn(c).AddToSwarm(host, *swarmOptions); err != nil {
+		log.Fatalf("Error adding %s to the swarm: %s", host.Name, err)
+	}
+}
+
+func cmdSwarmRemove(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		log.Fatal(ErrExpectedOneMachine)
+	}
+
+	host := getHost(c)
+
+	log.Infof("Removing %s from the swarm...", host.Name)
+	if err := getDefaultMcn(c).RemoveFromSwarm(host); err != nil {
+		log.Fatalf("Error removing %s from the swarm: %s", host.Name, err)
+	}
+}
+
+func cmdSwarmPromote(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		log.Fatal(ErrExpectedOneMachine)
+	}
+
+	host := getHost(c)
+
+	log.Infof("Promoting %s to swarm master...", host.Name)
+	if err := getDefaultMcn(c).PromoteSwarmMaster(host); err != nil {
+		log.Fatalf("Error promoting %s: %s", host.Name, err)
+	}
+}
+
+func cmdSwarmStatus(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		log.Fatal(ErrExpectedOneMachine)
+	}
+
+	host := getHost(c)
+
+	members, err := getDefaultMcn(c).SwarmMembers(host)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tROLE\tSTATE\tAGENT\tMASTER")
+
+	for _, member := range members {
+		role := "node"
+		if member.HostOptions.SwarmOptions.Master {
+			role = "master"
+		}
+
+		state, err := member.Driver.GetState()
+		if err != nil {
+			log.Errorf("error getting state for host %s: %s", member.Name, err)
+		}
+
+		agent, master := "-", "-"
+		if status, err := member.GetSwarmStatus(); err != nil {
+			log.Debugf("error getting the swarm status of %s: %s", member.Name, err)
+		} else {
+			agent, master = status.Agent, status.Master
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", member.Name, role, state, agent, master)
+	}
+
+	w.Flush()
+}
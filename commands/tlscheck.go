@@ -0,0 +1,304 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/log"
+	"github.com/docker/machine/utils"
+)
+
+const (
+	tlsCheckOK      = "ok"
+	tlsCheckWarning = "warning"
+	tlsCheckError   = "error"
+
+	// certificates are issued valid from 5 minutes in the past, so a
+	// machine whose clock is further behind rejects them
+	maxClockSkew = time.Minute * 5
+)
+
+type tlsCheckResult struct {
+	status  string
+	message string
+	fix     string
+}
+
+func describeCert(cert *x509.Certificate) string {
+	return fmt.Sprintf("subject=%s issuer=%s serial=%s valid=%s..%s",
+		cert.Subject, cert.Issuer, cert.SerialNumber,
+		cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+}
+
+// checkServerCert checks the chain the daemon presented is issued by the CA,
+// covers the machine's IP and is within its validity period.  regenerate is
+// the command suggested to fix a bad certificate.
+func checkServerCert(regenerate string, chain []*x509.Certificate, caPool *x509.CertPool, ip string, now time.Time) []tlsCheckResult {
+	if len(chain) == 0 {
+		return []tlsCheckResult{{tlsCheckError, "The daemon did not present a certificate", regenerate}}
+	}
+
+	results := []tlsCheckResult{}
+	leaf := chain[0]
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	// the validity period is checked separately
+	verifyTime := now
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		verifyTime = leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) / 2)
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         caPool,
+		Intermediates: intermediates,
+		CurrentTime:   verifyTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		results = append(results, tlsCheckResult{tlsCheckError, fmt.Sprintf("The server certificate is not issued by the CA the client trusts: %s", err), regenerate})
+	} else {
+		results = append(results, tlsCheckResult{tlsCheckOK, "The server certificate is issued by the CA the client trusts", ""})
+	}
+
+	if err := leaf.VerifyHostname(ip); err != nil {
+		results = append(results, tlsCheckResult{tlsCheckError, fmt.Sprintf("The server certificate is not valid for the machine's IP %s (valid for %s)", ip, strings.Join(certHosts(leaf), ", ")), regenerate})
+	} else {
+		results = append(results, tlsCheckResult{tlsCheckOK, fmt.Sprintf("The server certificate is valid for the machine's IP %s", ip), ""})
+	}
+
+	switch {
+	case now.Before(leaf.NotBefore):
+		results = append(results, tlsCheckResult{tlsCheckError, fmt.Sprintf("The server certificate is not valid until %s", leaf.NotBefore.Format(time.RFC3339)), "Check the local clock"})
+	case now.After(leaf.NotAfter):
+		results = append(results, tlsCheckResult{tlsCheckError, fmt.Sprintf("The server certificate expired on %s", leaf.NotAfter.Format(time.RFC3339)), regenerate})
+	case now.Add(libmachine.CertRenewalWindow).After(leaf.NotAfter):
+		results = append(results, tlsCheckResult{tlsCheckWarning, fmt.Sprintf("The server certificate expires on %s", leaf.NotAfter.Format(time.RFC3339)), regenerate})
+	default:
+		results = append(results, tlsCheckResult{tlsCheckOK, fmt.Sprintf("The server certificate is valid until %s", leaf.NotAfter.Format(time.RFC3339)), ""})
+	}
+
+	return results
+}
+
+func certHosts(cert *x509.Certificate) []string {
+	hosts := []string{}
+	for _, ip := range cert.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	return append(hosts, cert.DNSNames...)
+}
+
+// checkClockSkew checks the machine's clock against the local one
+func checkClockSkew(skew time.Duration) tlsCheckResult {
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+
+	fix := "Synchronize the clocks, e.g. with ntpd"
+
+	// certificates are issued with the local time, so a machine whose
+	// clock is behind sees new ones as not yet valid, and one whose clock
+	// is ahead sees them expire early
+	direction := "ahead of"
+	consequence := "it will reject certificates as expired before they expire"
+	if skew < 0 {
+		direction = "behind"
+		consequence = "it will reject newly issued certificates as not yet valid"
+	}
+
+	switch {
+	case abs >= maxClockSkew:
+		return tlsCheckResult{tlsCheckError, fmt.Sprintf("The machine's clock is %s %s the local clock; %s", abs, direction, consequence), fix}
+	case abs >= time.Minute:
+		return tlsCheckResult{tlsCheckWarning, fmt.Sprintf("The machine's clock is %s %s the local clock", abs, direction), fix}
+	}
+
+	return tlsCheckResult{tlsCheckOK, fmt.Sprintf("The machine's clock is within %s of the local clock", time.Minute), ""}
+}
+
+// getClockSkew returns how far the machine's clock is ahead of the local one
+func getClockSkew(d drivers.Driver) (time.Duration, error) {
+	before := time.Now()
+	output, err := drivers.RunSSHCommandFromDriver(d, "date +%s")
+	if err != nil {
+		return 0, err
+	}
+	after := time.Now()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(output.Stdout); err != nil {
+		return 0, err
+	}
+
+	seconds, err := strconv.ParseInt(strings.TrimSpace(buf.String()), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output of date: %s", buf.String())
+	}
+
+	local := before.Add(after.Sub(before) / 2)
+	skew := time.Unix(seconds, 0).Sub(local)
+	return skew / time.Second * time.Second, nil
+}
+
+func readCertificateFile(path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func cmdTLSCheck(c *cli.Context) {
+	if len(c.Args()) > 1 {
+		log.Fatal(ErrExpectedOneMachine)
+	}
+
+	host := getHost(c)
+
+	// the daemon is only reached through an SSH tunnel to its unix socket
+	if host.HostOptions.EngineOptions.DisableTCP {
+		fmt.Printf("%s: TLS not used (unix socket via SSH)\n", host.Name)
+		return
+	}
+
+	now := time.Now()
+	regenerate := fmt.Sprintf("%s regenerate-certs %s", c.App.Name, host.Name)
+	results := []tlsCheckResult{}
+
+	dockerURL, err := host.GetURL()
+	if err != nil {
+		log.Fatalf("Error getting the URL of %s: %s", host.Name, err)
+	}
+
+	u, err := url.Parse(dockerURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ip, err := host.Driver.GetIP()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the files the Docker client uses, see env
+	caCertPath := filepath.Join(host.StorePath, "ca.pem")
+	clientCertPath := filepath.Join(host.StorePath, "cert.pem")
+	clientKeyPath := filepath.Join(host.StorePath, "key.pem")
+
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caCert) {
+		log.Fatalf("No certificates found in %s", caCertPath)
+	}
+
+	clientCert, err := ioutil.ReadFile(clientCertPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	clientKey, err := ioutil.ReadFile(clientKeyPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	chain, probeErr := utils.ProbeTLS(u.Host, clientCert, clientKey)
+
+	fmt.Printf("Server certificate chain presented by %s:\n", u.Host)
+	for i, cert := range chain {
+		fmt.Printf("  %d %s\n", i, describeCert(cert))
+	}
+	fmt.Println()
+
+	if probeErr != nil {
+		results = append(results, tlsCheckResult{tlsCheckError, fmt.Sprintf("Unable to make a request to the daemon: %s", probeErr), regenerate})
+	} else {
+		results = append(results, tlsCheckResult{tlsCheckOK, "The daemon accepted the client certificate", ""})
+	}
+
+	if len(chain) > 0 || probeErr == nil {
+		results = append(results, checkServerCert(regenerate, chain, caPool, ip, now)...)
+	}
+
+	if len(chain) > 0 {
+		if stored, err := readCertificateFile(host.HostOptions.AuthOptions.ServerCertPath); err == nil && stored.SerialNumber.Cmp(chain[0].SerialNumber) != 0 {
+			results = append(results, tlsCheckResult{tlsCheckWarning, fmt.Sprintf("The daemon presents a different certificate than %s", host.HostOptions.AuthOptions.ServerCertPath), regenerate})
+		}
+	}
+
+	if cert, err := readCertificateFile(clientCertPath); err != nil {
+		results = append(results, tlsCheckResult{tlsCheckError, fmt.Sprintf("Unable to read the client certificate: %s", err), regenerate})
+	} else if now.After(cert.NotAfter) {
+		results = append(results, tlsCheckResult{tlsCheckError, fmt.Sprintf("The client certificate expired on %s", cert.NotAfter.Format(time.RFC3339)), "Replace the client certificate in the machine cert dir and run " + regenerate})
+	}
+
+	if host.DriverName != "none" {
+		if skew, err := getClockSkew(host.Driver); err != nil {
+			results = append(results, tlsCheckResult{tlsCheckWarning, fmt.Sprintf("Unable to read the machine's clock over SSH: %s", err), ""})
+		} else {
+			results = append(results, checkClockSkew(skew))
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tCHECK")
+
+	errors := 0
+	fixes := []string{}
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\n", r.status, r.message)
+		if r.status == tlsCheckError {
+			errors++
+		}
+		if r.status != tlsCheckOK && r.fix != "" && !containsString(fixes, r.fix) {
+			fixes = append(fixes, r.fix)
+		}
+	}
+	w.Flush()
+
+	if len(fixes) > 0 {
+		fmt.Println("\nSuggested fixes:")
+		for _, fix := range fixes {
+			fmt.Printf("  %s\n", fix)
+		}
+	}
+
+	if errors > 0 {
+		log.Fatalf("%d TLS check(s) failed for %s", errors, host.Name)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/utils"
+)
+
+func checkStatuses(results []tlsCheckResult) []string {
+	statuses := []string{}
+	for _, r := range results {
+		statuses = append(statuses, r.status)
+	}
+	return statuses
+}
+
+func TestCheckServerCert(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	opts := utils.CertOptions{Org: "test-org", KeySize: 1024}
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "ca-key.pem")
+	otherCaCertPath := filepath.Join(tmpDir, "other-ca.pem")
+	otherCaKeyPath := filepath.Join(tmpDir, "other-ca-key.pem")
+	serverCertPath := filepath.Join(tmpDir, "server.pem")
+	serverKeyPath := filepath.Join(tmpDir, "server-key.pem")
+
+	if err := utils.GenerateCACertificate(caCertPath, caKeyPath, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.GenerateCACertificate(otherCaCertPath, otherCaKeyPath, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.GenerateCert([]string{"10.0.0.1"}, serverCertPath, serverKeyPath, caCertPath, caKeyPath, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	serverCert, err := readCertificateFile(serverCertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := func(path string) *x509.CertPool {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := x509.NewCertPool()
+		p.AppendCertsFromPEM(data)
+		return p
+	}
+
+	chain := []*x509.Certificate{serverCert}
+	now := time.Now()
+
+	for _, c := range []struct {
+		name     string
+		chain    []*x509.Certificate
+		caPool   *x509.CertPool
+		ip       string
+		now      time.Time
+		expected []string
+	}{
+		{"ok", chain, pool(caCertPath), "10.0.0.1", now, []string{tlsCheckOK, tlsCheckOK, tlsCheckOK}},
+		{"ip mismatch", chain, pool(caCertPath), "10.0.0.2", now, []string{tlsCheckOK, tlsCheckError, tlsCheckOK}},
+		{"ca mismatch", chain, pool(otherCaCertPath), "10.0.0.1", now, []string{tlsCheckError, tlsCheckOK, tlsCheckOK}},
+		{"expiring", chain, pool(caCertPath), "10.0.0.1", serverCert.NotAfter.Add(-time.Hour), []string{tlsCheckOK, tlsCheckOK, tlsCheckWarning}},
+		{"expired", chain, pool(caCertPath), "10.0.0.1", serverCert.NotAfter.Add(time.Hour), []string{tlsCheckOK, tlsCheckOK, tlsCheckError}},
+		{"no certificate", nil, pool(caCertPath), "10.0.0.1", now, []string{tlsCheckError}},
+	} {
+		statuses := checkStatuses(checkServerCert("docker-machine regenerate-certs test", c.chain, c.caPool, c.ip, c.now))
+		if len(statuses) != len(c.expected) {
+			t.Fatalf("%s: expected %v; received %v", c.name, c.expected, statuses)
+		}
+		for i := range statuses {
+			if statuses[i] != c.expected[i] {
+				t.Fatalf("%s: expected %v; received %v", c.name, c.expected, statuses)
+			}
+		}
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	for _, c := range []struct {
+		skew     time.Duration
+		expected string
+	}{
+		{time.Second * 3, tlsCheckOK},
+		{-time.Minute * 2, tlsCheckWarning},
+		{time.Minute * 10, tlsCheckError},
+		{-time.Hour, tlsCheckError},
+	} {
+		if r := checkClockSkew(c.skew); r.status != c.expected {
+			t.Fatalf("expected %s for a skew of %s; received %s", c.expected, c.skew, r.status)
+		}
+	}
+}
+
+func TestCheckClockSkewDirection(t *testing.T) {
+	if r := checkClockSkew(-time.Hour); strings.Index(r.message, "behind") == -1 || strings.Index(r.message, "not yet valid") == -1 {
+		t.Fatalf("expected a machine behind to reject certificates as not yet valid; received %q", r.message)
+	}
+
+	if r := checkClockSkew(time.Hour); strings.Index(r.message, "ahead of") == -1 || strings.Index(r.message, "not yet valid") != -1 {
+		t.Fatalf("expected a machine ahead to reject certificates as expired; received %q", r.message)
+	}
+}
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/log"
+)
+
+func cmdTunnel(c *cli.Context) {
+	if len(c.Args()) > 1 {
+		log.Fatal(ErrExpectedOneMachine)
+	}
+
+	host := getHost(c)
+
+	if !host.HostOptions.EngineOptions.DisableTCP {
+		log.Fatalf("%s has a TCP socket; connect to it directly, see %s env %s", host.Name, c.App.Name, host.Name)
+	}
+
+	log.Infof("Forwarding %s to the Docker daemon of %s; press Ctrl-C to close the tunnel", host.DockerSocketPath(), host.Name)
+	log.Infof("To connect Docker to it, run: %s", fmt.Sprintf("eval \"$(%s env %s)\"", c.App.Name, host.Name))
+
+	if err := host.ForwardDockerSocket(); err != nil {
+		log.Fatalf("Error forwarding the Docker socket of %s: %s", host.Name, err)
+	}
+}
@@ -7,7 +7,37 @@ import (
 )
 
 func cmdUpgrade(c *cli.Context) {
-	if err := runActionWithContext("upgrade", c); err != nil {
+	machines, err := getHosts(c)
+	if err != nil {
 		log.Fatal(err)
 	}
+
+	if len(machines) == 0 {
+		log.Fatal(ErrNoMachineSpecified)
+	}
+
+	version := c.String("engine-version")
+	if version != "" && c.Bool("latest") {
+		log.Fatal("Error: --engine-version and --latest cannot be used together.")
+	}
+
+	// an explicit version pins the machine to it; a pinned machine keeps
+	// its version until it is cleared with --latest
+	for _, machine := range machines {
+		engineOptions := machine.HostOptions.EngineOptions
+
+		switch {
+		case version != "":
+			engineOptions.Version = version
+		case c.Bool("latest"):
+			if engineOptions.Version != "" {
+				log.Infof("Unpinning %s from Docker %s", machine.Name, engineOptions.Version)
+			}
+			engineOptions.Version = ""
+		case engineOptions.Version != "":
+			log.Infof("%s is pinned to Docker %s; use --latest to upgrade it to the latest version", machine.Name, engineOptions.Version)
+		}
+	}
+
+	runActionForeachMachine("upgrade", machines)
 }
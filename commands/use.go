@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/log"
+)
+
+func cmdUse(c *cli.Context) {
+	mcn := getDefaultMcn(c)
+
+	if c.Bool("unset") {
+		if len(c.Args()) > 0 {
+			log.Fatal("Error: Too many arguments given.")
+		}
+
+		if err := mcn.SetActive(nil); err != nil {
+			log.Fatalf("Error clearing the active machine: %s", err)
+		}
+		return
+	}
+
+	if len(c.Args()) != 1 {
+		log.Fatal(ErrExpectedOneMachine)
+	}
+
+	host := getHost(c)
+
+	if err := mcn.SetActive(host); err != nil {
+		log.Fatalf("Error setting the active machine: %s", err)
+	}
+
+	log.Infof("%s is now the active machine", host.Name)
+	log.Infof("To point Docker at it, run: %s", fmt.Sprintf("eval \"$(%s env %s)\"", c.App.Name, host.Name))
+}
@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/swarm"
+)
+
+func runUseCommand(args []string) string {
+	stdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	outStr := make(chan string)
+
+	go func() {
+		var testOutput bytes.Buffer
+		io.Copy(&testOutput, r)
+		outStr <- testOutput.String()
+	}()
+
+	set := flag.NewFlagSet("use", 0)
+	set.Bool("unset", false, "")
+	set.Parse(args)
+	c := cli.NewContext(nil, set, set)
+	c.App = &cli.App{
+		Name: "docker-machine-test",
+	}
+	cmdUse(c)
+
+	w.Close()
+
+	return <-outStr
+}
+
+func TestCmdUse(t *testing.T) {
+	os.Setenv("MACHINE_STORAGE_PATH", TestStoreDir)
+	defer os.Setenv("MACHINE_STORAGE_PATH", "")
+
+	if err := clearHosts(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	mcn, err := libmachine.New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostOptions := &libmachine.HostOptions{
+		EngineOptions: &engine.EngineOptions{},
+		SwarmOptions:  &swarm.SwarmOptions{},
+		AuthOptions:   &auth.AuthOptions{},
+	}
+
+	for _, name := range []string{"test-a", "test-b"} {
+		if _, err := mcn.Create(name, "none", hostOptions, getTestDriverFlags()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := runUseCommand([]string{"test-b"})
+	if !strings.Contains(out, "eval \"$(docker-machine-test env test-b)\"") {
+		t.Fatalf("expected the env command for test-b; received %q", out)
+	}
+
+	active, err := mcn.GetActiveName()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if active != "test-b" {
+		t.Fatalf("expected test-b to be active; received %q", active)
+	}
+
+	runUseCommand([]string{"test-a"})
+	if active, err = mcn.GetActiveName(); err != nil {
+		t.Fatal(err)
+	}
+
+	if active != "test-a" {
+		t.Fatalf("expected test-a to be active; received %q", active)
+	}
+
+	runUseCommand([]string{"--unset"})
+	if active, err = mcn.GetActiveName(); err != nil {
+		t.Fatal(err)
+	}
+
+	if active != "" {
+		t.Fatalf("expected no active machine after --unset; received %q", active)
+	}
+
+	// unsetting again is not an error
+	runUseCommand([]string{"--unset"})
+}
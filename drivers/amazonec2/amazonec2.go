@@ -6,15 +6,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/url"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/drivers/amazonec2/amz"
+	"github.com/docker/machine/libmachine/swarm"
 	"github.com/docker/machine/log"
 	"github.com/docker/machine/provider"
 	"github.com/docker/machine/ssh"
@@ -38,9 +36,9 @@ var (
 
 type Driver struct {
 	Id                  string
-	AccessKey           string
-	SecretKey           string
-	SessionToken        string
+	AccessKey           string `json:"-"`
+	SecretKey           string `json:"-"`
+	SessionToken        string `json:"-"`
 	Region              string
 	AMI                 string
 	SSHKeyID            int
@@ -70,8 +68,26 @@ type Driver struct {
 	RequestSpotInstance bool
 	SpotPrice           string
 	PrivateIPOnly       bool
+	userData            []byte
+	credentialsLoaded   bool
 }
 
+var (
+	accessKeyCredential = drivers.Credential{
+		Name:   "amazonec2-access-key",
+		EnvVar: "AWS_ACCESS_KEY_ID",
+	}
+	secretKeyCredential = drivers.Credential{
+		Name:   "amazonec2-secret-key",
+		EnvVar: "AWS_SECRET_ACCESS_KEY",
+	}
+	sessionTokenCredential = drivers.Credential{
+		Name:     "amazonec2-session-token",
+		EnvVar:   "AWS_SESSION_TOKEN",
+		Optional: true,
+	}
+)
+
 func init() {
 	drivers.Register(driverName, &drivers.RegisteredDriver{
 		New:            NewDriver,
@@ -187,12 +203,93 @@ func (d *Driver) GetProviderType() provider.ProviderType {
 	return provider.Remote
 }
 
+// AuthorizePort opens the ports in the machine's security group, skipping
+// those which are open already
 func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
-	return nil
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
+	group, err := d.getClient().GetSecurityGroupById(d.SecurityGroupId)
+	if err != nil {
+		return err
+	}
+
+	if group == nil {
+		return fmt.Errorf("security group %s not found", d.SecurityGroupId)
+	}
+
+	perms := []amz.IpPermission{}
+	for _, p := range portPermissions(ports) {
+		if !hasPermission(group, p) {
+			perms = append(perms, p)
+		}
+	}
+
+	if len(perms) == 0 {
+		return nil
+	}
+
+	log.Debugf("authorizing group %s with permissions: %v", group.GroupName, perms)
+	return d.getClient().AuthorizeSecurityGroup(d.SecurityGroupId, perms)
 }
 
+// DeauthorizePort closes the ports in the machine's security group.  The
+// group may be shared by other machines.
 func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
-	return nil
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
+	group, err := d.getClient().GetSecurityGroupById(d.SecurityGroupId)
+	if err != nil {
+		return err
+	}
+
+	if group == nil {
+		return nil
+	}
+
+	perms := []amz.IpPermission{}
+	for _, p := range portPermissions(ports) {
+		if hasPermission(group, p) {
+			perms = append(perms, p)
+		}
+	}
+
+	if len(perms) == 0 {
+		return nil
+	}
+
+	log.Debugf("revoking permissions from group %s: %v", group.GroupName, perms)
+	return d.getClient().RevokeSecurityGroup(d.SecurityGroupId, perms)
+}
+
+func portPermissions(ports []*drivers.Port) []amz.IpPermission {
+	perms := []amz.IpPermission{}
+	for _, p := range ports {
+		protocol := p.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+
+		perms = append(perms, amz.IpPermission{
+			IpProtocol: protocol,
+			FromPort:   p.Port,
+			ToPort:     p.Port,
+			IpRange:    ipRange,
+		})
+	}
+	return perms
+}
+
+func hasPermission(group *amz.SecurityGroup, perm amz.IpPermission) bool {
+	for _, p := range group.IpPermissions {
+		if p.IpProtocol == perm.IpProtocol && p.FromPort == perm.FromPort && p.ToPort == perm.ToPort {
+			return true
+		}
+	}
+	return false
 }
 
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
@@ -228,12 +325,8 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.SSHPort = 22
 	d.PrivateIPOnly = flags.Bool("amazonec2-private-address-only")
 
-	if d.AccessKey == "" {
-		return fmt.Errorf("amazonec2 driver requires the --amazonec2-access-key option")
-	}
-
-	if d.SecretKey == "" {
-		return fmt.Errorf("amazonec2 driver requires the --amazonec2-secret-key option")
+	if err := d.loadCredentials(); err != nil {
+		return err
 	}
 
 	if d.SubnetId == "" && d.VpcId == "" {
@@ -241,18 +334,12 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	}
 
 	if d.isSwarmMaster() {
-		u, err := url.Parse(d.SwarmHost)
+		listenAddr, err := swarm.ParseAddress(d.SwarmHost, swarm.DefaultPort)
 		if err != nil {
 			return fmt.Errorf("error parsing swarm host: %s", err)
 		}
 
-		parts := strings.Split(u.Host, ":")
-		port, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return err
-		}
-
-		swarmPort = port
+		swarmPort = listenAddr.Port
 	}
 
 	return nil
@@ -315,7 +402,16 @@ func (d *Driver) checkPrereqs() error {
 	return nil
 }
 
+func (d *Driver) SetUserData(userData []byte) error {
+	d.userData = userData
+	return nil
+}
+
 func (d *Driver) PreCreateCheck() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	return d.checkPrereqs()
 }
 
@@ -333,6 +429,10 @@ func (d *Driver) instanceIpAvailable() bool {
 }
 
 func (d *Driver) Create() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	if err := d.checkPrereqs(); err != nil {
 		return err
 	}
@@ -357,7 +457,7 @@ func (d *Driver) Create() error {
 	log.Debugf("launching instance in subnet %s", d.SubnetId)
 	var instance amz.EC2Instance
 	if d.RequestSpotInstance {
-		spotInstanceRequestId, err := d.getClient().RequestSpotInstances(d.AMI, d.InstanceType, d.Zone, 1, d.SecurityGroupId, d.KeyName, d.SubnetId, bdm, d.IamInstanceProfile, d.SpotPrice)
+		spotInstanceRequestId, err := d.getClient().RequestSpotInstances(d.AMI, d.InstanceType, d.Zone, 1, d.SecurityGroupId, d.KeyName, d.SubnetId, bdm, d.IamInstanceProfile, d.SpotPrice, d.userData)
 		if err != nil {
 			return fmt.Errorf("Error request spot instance: %s", err)
 		}
@@ -378,7 +478,7 @@ func (d *Driver) Create() error {
 			return fmt.Errorf("Error get instance: %s", err)
 		}
 	} else {
-		inst, err := d.getClient().RunInstance(d.AMI, d.InstanceType, d.Zone, 1, 1, d.SecurityGroupId, d.KeyName, d.SubnetId, bdm, d.IamInstanceProfile, d.PrivateIPOnly)
+		inst, err := d.getClient().RunInstance(d.AMI, d.InstanceType, d.Zone, 1, 1, d.SecurityGroupId, d.KeyName, d.SubnetId, bdm, d.IamInstanceProfile, d.PrivateIPOnly, d.userData)
 		if err != nil {
 			return fmt.Errorf("Error launching instance: %s", err)
 		}
@@ -427,6 +527,16 @@ func (d *Driver) GetURL() (string, error) {
 	return fmt.Sprintf("tcp://%s:%d", ip, dockerPort), nil
 }
 
+// GetEngineLabels describes the instance for swarm scheduling
+func (d *Driver) GetEngineLabels() (map[string]string, error) {
+	return map[string]string{
+		"region":       d.Region,
+		"zone":         d.Region + d.Zone,
+		"instancetype": d.InstanceType,
+		"disk":         fmt.Sprintf("%d", d.RootSize),
+	}, nil
+}
+
 func (d *Driver) GetIP() (string, error) {
 	inst, err := d.getInstance()
 	if err != nil {
@@ -440,6 +550,15 @@ func (d *Driver) GetIP() (string, error) {
 	return inst.IpAddress, nil
 }
 
+func (d *Driver) GetPrivateIP() (string, error) {
+	inst, err := d.getInstance()
+	if err != nil {
+		return "", err
+	}
+
+	return inst.PrivateIpAddress, nil
+}
+
 func (d *Driver) GetState() (state.State, error) {
 	inst, err := d.getInstance()
 	if err != nil {
@@ -484,6 +603,10 @@ func (d *Driver) GetSSHUsername() string {
 }
 
 func (d *Driver) Start() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	if err := d.getClient().StartInstance(d.InstanceId); err != nil {
 		return err
 	}
@@ -496,6 +619,10 @@ func (d *Driver) Start() error {
 }
 
 func (d *Driver) Stop() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	if err := d.getClient().StopInstance(d.InstanceId, false); err != nil {
 		return err
 	}
@@ -503,6 +630,9 @@ func (d *Driver) Stop() error {
 }
 
 func (d *Driver) Remove() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
 
 	if err := d.terminate(); err != nil {
 		return fmt.Errorf("unable to terminate instance: %s", err)
@@ -517,6 +647,10 @@ func (d *Driver) Remove() error {
 }
 
 func (d *Driver) Restart() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	if err := d.getClient().RestartInstance(d.InstanceId); err != nil {
 		return fmt.Errorf("unable to restart instance: %s", err)
 	}
@@ -524,12 +658,39 @@ func (d *Driver) Restart() error {
 }
 
 func (d *Driver) Kill() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	if err := d.getClient().StopInstance(d.InstanceId, true); err != nil {
 		return err
 	}
 	return nil
 }
 
+// loadCredentials resolves the credentials, which are not stored in the
+// config.  It is called by all the methods which use the EC2 API.
+func (d *Driver) loadCredentials() error {
+	if d.credentialsLoaded {
+		return nil
+	}
+
+	if err := drivers.ResolveCredential(&d.AccessKey, accessKeyCredential); err != nil {
+		return err
+	}
+
+	if err := drivers.ResolveCredential(&d.SecretKey, secretKeyCredential); err != nil {
+		return err
+	}
+
+	if err := drivers.ResolveCredential(&d.SessionToken, sessionTokenCredential); err != nil {
+		return err
+	}
+
+	d.credentialsLoaded = true
+	return nil
+}
+
 func (d *Driver) getClient() *amz.EC2 {
 	auth := amz.GetAuth(d.AccessKey, d.SecretKey, d.SessionToken)
 	return amz.NewEC2(auth, d.Region)
@@ -540,6 +701,10 @@ func (d *Driver) GetSSHKeyPath() string {
 }
 
 func (d *Driver) getInstance() (*amz.EC2Instance, error) {
+	if err := d.loadCredentials(); err != nil {
+		return nil, err
+	}
+
 	instance, err := d.getClient().GetInstance(d.InstanceId)
 	if err != nil {
 		return nil, err
@@ -1,8 +1,10 @@
 package amazonec2
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/docker/machine/drivers/amazonec2/amz"
@@ -231,3 +233,40 @@ func TestValidateAwsRegionInvalid(t *testing.T) {
 		}
 	}
 }
+
+func TestCredentialsNotStored(t *testing.T) {
+	d, err := getTestDriver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"AccessKey", "SecretKey", "SessionToken"} {
+		if strings.Contains(string(data), key) {
+			t.Fatalf("expected %s not to be stored; received %s", key, data)
+		}
+	}
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "access-from-env")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret-from-env")
+	defer os.Setenv("AWS_ACCESS_KEY_ID", "")
+	defer os.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	loaded := &Driver{}
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loaded.loadCredentials(); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.AccessKey != "access-from-env" || loaded.SecretKey != "secret-from-env" {
+		t.Fatalf("expected the credentials to be read from the environment; received %q and %q", loaded.AccessKey, loaded.SecretKey)
+	}
+}
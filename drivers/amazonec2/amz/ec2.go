@@ -173,7 +173,7 @@ func (e *EC2) awsApiCall(v url.Values) (*http.Response, error) {
 	return resp, nil
 }
 
-func (e *EC2) RunInstance(amiId string, instanceType string, zone string, minCount int, maxCount int, securityGroup string, keyName string, subnetId string, bdm *BlockDeviceMapping, role string, privateIPOnly bool) (EC2Instance, error) {
+func (e *EC2) RunInstance(amiId string, instanceType string, zone string, minCount int, maxCount int, securityGroup string, keyName string, subnetId string, bdm *BlockDeviceMapping, role string, privateIPOnly bool, userData []byte) (EC2Instance, error) {
 	instance := Instance{}
 	v := url.Values{}
 	v.Set("Action", "RunInstances")
@@ -196,6 +196,10 @@ func (e *EC2) RunInstance(amiId string, instanceType string, zone string, minCou
 		v.Set("IamInstanceProfile.Name", role)
 	}
 
+	if len(userData) > 0 {
+		v.Set("UserData", base64.StdEncoding.EncodeToString(userData))
+	}
+
 	if bdm != nil {
 		v.Set("BlockDeviceMapping.0.DeviceName", bdm.DeviceName)
 		v.Set("BlockDeviceMapping.0.VirtualName", bdm.VirtualName)
@@ -229,7 +233,7 @@ func (e *EC2) RunInstance(amiId string, instanceType string, zone string, minCou
 	return instance.info, nil
 }
 
-func (e *EC2) RequestSpotInstances(amiId string, instanceType string, zone string, instanceCount int, securityGroup string, keyName string, subnetId string, bdm *BlockDeviceMapping, role string, spotPrice string) (string, error) {
+func (e *EC2) RequestSpotInstances(amiId string, instanceType string, zone string, instanceCount int, securityGroup string, keyName string, subnetId string, bdm *BlockDeviceMapping, role string, spotPrice string, userData []byte) (string, error) {
 	v := url.Values{}
 	v.Set("Action", "RequestSpotInstances")
 	v.Set("LaunchSpecification.ImageId", amiId)
@@ -247,6 +251,10 @@ func (e *EC2) RequestSpotInstances(amiId string, instanceType string, zone strin
 		v.Set("LaunchSpecification.IamInstanceProfile.Name", role)
 	}
 
+	if len(userData) > 0 {
+		v.Set("LaunchSpecification.UserData", base64.StdEncoding.EncodeToString(userData))
+	}
+
 	if bdm != nil {
 		v.Set("LaunchSpecification.BlockDeviceMapping.0.DeviceName", bdm.DeviceName)
 		v.Set("LaunchSpecification.BlockDeviceMapping.0.VirtualName", bdm.VirtualName)
@@ -451,6 +459,26 @@ func (e *EC2) AuthorizeSecurityGroup(groupId string, permissions []IpPermission)
 	return nil
 }
 
+func (e *EC2) RevokeSecurityGroup(groupId string, permissions []IpPermission) error {
+	v := url.Values{}
+	v.Set("Action", "RevokeSecurityGroupIngress")
+	v.Set("GroupId", groupId)
+
+	for index, perm := range permissions {
+		n := index + 1 // amazon starts counting from 1 not 0
+		v.Set(fmt.Sprintf("IpPermissions.%d.IpProtocol", n), perm.IpProtocol)
+		v.Set(fmt.Sprintf("IpPermissions.%d.FromPort", n), strconv.Itoa(perm.FromPort))
+		v.Set(fmt.Sprintf("IpPermissions.%d.ToPort", n), strconv.Itoa(perm.ToPort))
+		v.Set(fmt.Sprintf("IpPermissions.%d.IpRanges.1.CidrIp", n), perm.IpRange)
+	}
+	resp, err := e.awsApiCall(v)
+	if err != nil {
+		return fmt.Errorf("Error making API call to revoke security group ingress: %s", err)
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
 func (e *EC2) DeleteSecurityGroup(groupId string) error {
 	v := url.Values{}
 	v.Set("Action", "DeleteSecurityGroup")
@@ -24,11 +24,11 @@ type Driver struct {
 	IPAddress               string
 	MachineName             string
 	SubscriptionID          string
-	SubscriptionCert        string
+	SubscriptionCert        string `json:"-"`
 	PublishSettingsFilePath string
 	Location                string
 	Size                    string
-	UserPassword            string
+	UserPassword            string `json:"-"`
 	Image                   string
 	SSHUser                 string
 	SSHPort                 int
@@ -41,6 +41,11 @@ type Driver struct {
 	storePath               string
 }
 
+var subscriptionCertCredential = drivers.Credential{
+	Name:   "azure-subscription-cert",
+	EnvVar: "AZURE_SUBSCRIPTION_CERT",
+}
+
 func init() {
 	drivers.Register("azure", &drivers.RegisteredDriver{
 		New:            NewDriver,
@@ -178,8 +183,14 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 		d.PublishSettingsFilePath = publishSettings
 	}
 
-	if (d.SubscriptionID == "" || d.SubscriptionCert == "") && d.PublishSettingsFilePath == "" {
-		return errors.New("Please specify azure subscription params using options: --azure-subscription-id and --azure-subscription-cert or --azure-publish-settings-file")
+	if d.PublishSettingsFilePath == "" {
+		if d.SubscriptionID == "" {
+			return errors.New("Please specify azure subscription params using options: --azure-subscription-id and --azure-subscription-cert or --azure-publish-settings-file")
+		}
+
+		if err := drivers.ResolveCredential(&d.SubscriptionCert, subscriptionCertCredential); err != nil {
+			return err
+		}
 	}
 
 	if image == "" {
@@ -198,6 +209,10 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.SSHUser = username
 	d.UserPassword = flags.String("azure-password")
 	d.DockerPort = flags.Int("azure-docker-port")
+	// endpoints cannot be added once the VM is created
+	if enginePort := flags.Int("engine-port"); enginePort != 0 {
+		d.DockerPort = enginePort
+	}
 	d.SSHPort = flags.Int("azure-ssh-port")
 	d.SwarmMaster = flags.Bool("swarm-master")
 	d.SwarmHost = flags.String("swarm-host")
@@ -264,6 +279,14 @@ func (d *Driver) GetURL() (string, error) {
 	return url, nil
 }
 
+// GetEngineLabels describes the VM for swarm scheduling
+func (d *Driver) GetEngineLabels() (map[string]string, error) {
+	return map[string]string{
+		"region":       d.Location,
+		"instancetype": d.Size,
+	}, nil
+}
+
 func (d *Driver) GetIP() (string, error) {
 	return d.getHostname(), nil
 }
@@ -407,6 +430,12 @@ func (d *Driver) setUserSubscription() error {
 	if d.PublishSettingsFilePath != "" {
 		return azure.ImportPublishSettingsFile(d.PublishSettingsFilePath)
 	}
+
+	// the subscription cert is not stored in the config
+	if err := drivers.ResolveCredential(&d.SubscriptionCert, subscriptionCertCredential); err != nil {
+		return err
+	}
+
 	return azure.ImportPublishSettings(d.SubscriptionID, d.SubscriptionCert)
 }
 
@@ -0,0 +1,203 @@
+package drivers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/docker/machine/utils"
+)
+
+// Credential is a secret a driver needs, such as an API key or password.
+// Drivers never store credentials in the machine's config; they are given
+// as create flags, and resolved through a CredentialProvider when the
+// machine is used later.
+type Credential struct {
+	// Name is the name of the create flag the secret is given with, e.g.
+	// amazonec2-secret-key.  It is also its key in the credentials file.
+	Name string
+
+	// EnvVar is the environment variable the secret is read from
+	EnvVar string
+
+	// Optional credentials may be left unset
+	Optional bool
+}
+
+// CredentialProvider resolves the secrets drivers ask for
+type CredentialProvider interface {
+	// GetCredential returns the secret, or an empty string if the provider
+	// does not have it
+	GetCredential(c Credential) (string, error)
+}
+
+// EnvCredentialProvider reads credentials from their environment variable
+type EnvCredentialProvider struct{}
+
+func (p EnvCredentialProvider) GetCredential(c Credential) (string, error) {
+	if c.EnvVar == "" {
+		return "", nil
+	}
+	return os.Getenv(c.EnvVar), nil
+}
+
+// FileCredentialProvider reads credentials from a profile in an INI style
+// credentials file:
+//
+//	[default]
+//	amazonec2-access-key = AKIA...
+//	amazonec2-secret-key = ...
+//
+// A missing file has no credentials.
+type FileCredentialProvider struct {
+	Path    string
+	Profile string
+}
+
+func (p FileCredentialProvider) GetCredential(c Credential) (string, error) {
+	f, err := os.Open(p.Path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	profile := ""
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			profile = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("error reading %s: invalid line %d", p.Path, n)
+		}
+
+		if profile == p.Profile && strings.TrimSpace(parts[0]) == c.Name {
+			return strings.TrimSpace(parts[1]), nil
+		}
+	}
+
+	return "", scanner.Err()
+}
+
+// HelperCredentialProvider runs a helper command with the credential name
+// as its argument and reads the secret from stdout, so that secrets can be
+// kept in a password manager or keychain.  Empty output means the helper
+// does not have the credential.
+type HelperCredentialProvider struct {
+	Command string
+}
+
+func (p HelperCredentialProvider) GetCredential(c Credential) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := helperCommand(p.Command, c.Name)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running credential helper %q: %s: %s", p.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// helperCommand returns the command running the helper through the shell
+// with the credential name as its argument
+func helperCommand(command, name string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command+" "+name)
+	}
+	return exec.Command("/bin/sh", "-c", command+` "$1"`, "sh", name)
+}
+
+// ChainCredentialProvider asks each provider in turn and returns the first
+// secret found
+type ChainCredentialProvider []CredentialProvider
+
+func (p ChainCredentialProvider) GetCredential(c Credential) (string, error) {
+	for _, provider := range p {
+		value, err := provider.GetCredential(c)
+		if err != nil {
+			return "", err
+		}
+
+		if value != "" {
+			return value, nil
+		}
+	}
+
+	return "", nil
+}
+
+// GetCredentialsFile returns the path of the credentials file
+func GetCredentialsFile() string {
+	if path := os.Getenv("MACHINE_CREDENTIALS_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join(utils.GetBaseDir(), "credentials")
+}
+
+// getCredentialsProfile returns the profile of the credentials file which
+// is used, set by MACHINE_CREDENTIALS_PROFILE
+func getCredentialsProfile() string {
+	if profile := os.Getenv("MACHINE_CREDENTIALS_PROFILE"); profile != "" {
+		return profile
+	}
+	return "default"
+}
+
+// DefaultCredentialProvider looks credentials up in the environment, then
+// the profile set by MACHINE_CREDENTIALS_PROFILE (default "default") in the
+// credentials file, then the helper set by MACHINE_CREDENTIAL_HELPER.
+func DefaultCredentialProvider() CredentialProvider {
+	providers := ChainCredentialProvider{
+		EnvCredentialProvider{},
+		FileCredentialProvider{
+			Path:    GetCredentialsFile(),
+			Profile: getCredentialsProfile(),
+		},
+	}
+
+	if helper := os.Getenv("MACHINE_CREDENTIAL_HELPER"); helper != "" {
+		providers = append(providers, HelperCredentialProvider{helper})
+	}
+
+	return providers
+}
+
+// ResolveCredential sets value from the default provider if it is not set
+// yet, e.g. because the driver was loaded from the machine's config.
+func ResolveCredential(value *string, c Credential) error {
+	if *value != "" {
+		return nil
+	}
+
+	secret, err := DefaultCredentialProvider().GetCredential(c)
+	if err != nil {
+		return err
+	}
+
+	// a credential given as a create flag is not stored with the machine,
+	// so later commands have to find it through a provider
+	if secret == "" && !c.Optional {
+		return fmt.Errorf("%s is not set; it is not stored with the machine, so set the %s environment variable, add %s to the [%s] profile of the credentials file %s or configure a credential helper with MACHINE_CREDENTIAL_HELPER", c.Name, c.EnvVar, c.Name, getCredentialsProfile(), GetCredentialsFile())
+	}
+
+	*value = secret
+	return nil
+}
@@ -0,0 +1,138 @@
+package drivers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+var testCredential = Credential{
+	Name:   "foo-api-key",
+	EnvVar: "FOO_API_KEY",
+}
+
+func TestFileCredentialProvider(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "credentials")
+	data := `# credentials
+[default]
+foo-api-key = default-key
+
+[staging]
+foo-other = other
+foo-api-key=staging-key
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for profile, expected := range map[string]string{
+		"default": "default-key",
+		"staging": "staging-key",
+		"missing": "",
+	} {
+		value, err := FileCredentialProvider{path, profile}.GetCredential(testCredential)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value != expected {
+			t.Fatalf("expected %q for profile %s; received %q", expected, profile, value)
+		}
+	}
+
+	value, err := FileCredentialProvider{filepath.Join(tmpDir, "missing"), "default"}.GetCredential(testCredential)
+	if err != nil || value != "" {
+		t.Fatalf("expected no credential from a missing file; received %q, %v", value, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("[default]\nfoo-api-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (FileCredentialProvider{path, "default"}).GetCredential(testCredential); err == nil {
+		t.Fatal("expected error with an invalid line")
+	}
+}
+
+func TestHelperCredentialProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the helper is a POSIX shell function")
+	}
+
+	value, err := HelperCredentialProvider{`f() { [ "$1" = foo-api-key ] && echo helper-key; true; }; f`}.GetCredential(testCredential)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "helper-key" {
+		t.Fatalf("expected helper-key; received %q", value)
+	}
+
+	if _, err := (HelperCredentialProvider{"false"}).GetCredential(testCredential); err == nil {
+		t.Fatal("expected error when the helper fails")
+	}
+}
+
+func TestResolveCredential(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "credentials")
+	if err := ioutil.WriteFile(path, []byte("[default]\nfoo-api-key = file-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("MACHINE_CREDENTIALS_FILE", path)
+	defer os.Setenv("MACHINE_CREDENTIALS_FILE", "")
+
+	// a value given as a flag is kept
+	value := "flag-key"
+	if err := ResolveCredential(&value, testCredential); err != nil || value != "flag-key" {
+		t.Fatalf("expected flag-key; received %q, %v", value, err)
+	}
+
+	// the environment comes before the file
+	os.Setenv("FOO_API_KEY", "env-key")
+	value = ""
+	if err := ResolveCredential(&value, testCredential); err != nil || value != "env-key" {
+		t.Fatalf("expected env-key; received %q, %v", value, err)
+	}
+	os.Setenv("FOO_API_KEY", "")
+
+	value = ""
+	if err := ResolveCredential(&value, testCredential); err != nil || value != "file-key" {
+		t.Fatalf("expected file-key; received %q, %v", value, err)
+	}
+
+	// the helper is asked last
+	os.Setenv("MACHINE_CREDENTIAL_HELPER", "echo helper-key-for")
+	defer os.Setenv("MACHINE_CREDENTIAL_HELPER", "")
+
+	missing := Credential{Name: "foo-secret", EnvVar: "FOO_SECRET"}
+	value = ""
+	if err := ResolveCredential(&value, missing); err != nil || value != "helper-key-for foo-secret" {
+		t.Fatalf("expected helper-key-for foo-secret; received %q, %v", value, err)
+	}
+
+	os.Setenv("MACHINE_CREDENTIAL_HELPER", "")
+	value = ""
+	if err := ResolveCredential(&value, missing); err == nil {
+		t.Fatal("expected error when the credential is not found")
+	}
+
+	missing.Optional = true
+	if err := ResolveCredential(&value, missing); err != nil {
+		t.Fatalf("expected no error for an optional credential; received %s", err)
+	}
+}
@@ -17,7 +17,7 @@ import (
 )
 
 type Driver struct {
-	AccessToken       string
+	AccessToken       string `json:"-"`
 	DropletID         int
 	DropletName       string
 	Image             string
@@ -38,6 +38,12 @@ type Driver struct {
 	SwarmHost         string
 	SwarmDiscovery    string
 	storePath         string
+	userData          []byte
+}
+
+var accessTokenCredential = drivers.Credential{
+	Name:   "digitalocean-access-token",
+	EnvVar: "DIGITALOCEAN_ACCESS_TOKEN",
 }
 
 func init() {
@@ -154,14 +160,23 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.SSHUser = "root"
 	d.SSHPort = 22
 
-	if d.AccessToken == "" {
-		return fmt.Errorf("digitalocean driver requires the --digitalocean-access-token option")
+	if err := d.loadCredentials(); err != nil {
+		return err
 	}
 
 	return nil
 }
 
+func (d *Driver) SetUserData(userData []byte) error {
+	d.userData = userData
+	return nil
+}
+
 func (d *Driver) PreCreateCheck() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	client := d.getClient()
 	regions, _, err := client.Regions.List(nil)
 	if err != nil {
@@ -177,6 +192,10 @@ func (d *Driver) PreCreateCheck() error {
 }
 
 func (d *Driver) Create() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	log.Infof("Creating SSH key...")
 
 	key, err := d.createSSHKey()
@@ -199,6 +218,7 @@ func (d *Driver) Create() error {
 		PrivateNetworking: d.PrivateNetworking,
 		Backups:           d.Backups,
 		SSHKeys:           []interface{}{d.SSHKeyID},
+		UserData:          string(d.userData),
 	}
 
 	newDroplet, _, err := client.Droplets.Create(createRequest)
@@ -264,6 +284,14 @@ func (d *Driver) GetURL() (string, error) {
 	return fmt.Sprintf("tcp://%s:2376", ip), nil
 }
 
+// GetEngineLabels describes the droplet for swarm scheduling
+func (d *Driver) GetEngineLabels() (map[string]string, error) {
+	return map[string]string{
+		"region":       d.Region,
+		"instancetype": d.Size,
+	}, nil
+}
+
 func (d *Driver) GetIP() (string, error) {
 	if d.IPAddress == "" {
 		return "", fmt.Errorf("IP address is not set")
@@ -271,7 +299,34 @@ func (d *Driver) GetIP() (string, error) {
 	return d.IPAddress, nil
 }
 
+func (d *Driver) GetPrivateIP() (string, error) {
+	if !d.PrivateNetworking {
+		return "", nil
+	}
+
+	if err := d.loadCredentials(); err != nil {
+		return "", err
+	}
+
+	droplet, _, err := d.getClient().Droplets.Get(d.DropletID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, network := range droplet.Droplet.Networks.V4 {
+		if network.Type == "private" {
+			return network.IPAddress, nil
+		}
+	}
+
+	return "", nil
+}
+
 func (d *Driver) GetState() (state.State, error) {
+	if err := d.loadCredentials(); err != nil {
+		return state.Error, err
+	}
+
 	droplet, _, err := d.getClient().Droplets.Get(d.DropletID)
 	if err != nil {
 		return state.Error, err
@@ -288,16 +343,28 @@ func (d *Driver) GetState() (state.State, error) {
 }
 
 func (d *Driver) Start() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	_, _, err := d.getClient().DropletActions.PowerOn(d.DropletID)
 	return err
 }
 
 func (d *Driver) Stop() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	_, _, err := d.getClient().DropletActions.Shutdown(d.DropletID)
 	return err
 }
 
 func (d *Driver) Remove() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	client := d.getClient()
 	if resp, err := client.Keys.DeleteByID(d.SSHKeyID); err != nil {
 		if resp.StatusCode == 404 {
@@ -317,15 +384,29 @@ func (d *Driver) Remove() error {
 }
 
 func (d *Driver) Restart() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	_, _, err := d.getClient().DropletActions.Reboot(d.DropletID)
 	return err
 }
 
 func (d *Driver) Kill() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	_, _, err := d.getClient().DropletActions.PowerOff(d.DropletID)
 	return err
 }
 
+// loadCredentials resolves the access token, which is not stored in the
+// config.  It is called by all the methods which use the API.
+func (d *Driver) loadCredentials() error {
+	return drivers.ResolveCredential(&d.AccessToken, accessTokenCredential)
+}
+
 func (d *Driver) getClient() *godo.Client {
 	t := &oauth.Transport{
 		Token: &oauth.Token{AccessToken: d.AccessToken},
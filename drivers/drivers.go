@@ -3,6 +3,7 @@ package drivers
 import (
 	"errors"
 	"fmt"
+	"io"
 	"sort"
 
 	"github.com/codegangsta/cli"
@@ -86,6 +87,32 @@ type Driver interface {
 	Stop() error
 }
 
+// PrivateIPDriver is implemented by drivers for providers which give hosts
+// a private IP address in addition to the one returned by GetIP.  It is
+// optional; the address is included in the host's server certificate.
+type PrivateIPDriver interface {
+	// GetPrivateIP returns the private IP address of the host, or an empty
+	// string if it has none
+	GetPrivateIP() (string, error)
+}
+
+// EngineLabelDriver is implemented by drivers which describe the host they
+// create, e.g. for swarm constraints.  It is optional; the labels are added
+// to the daemon unless disabled.
+type EngineLabelDriver interface {
+	// GetEngineLabels returns labels such as region, zone, instancetype,
+	// memory (in MB), cpus and disk (in GB); empty values are left out
+	GetEngineLabels() (map[string]string, error)
+}
+
+// UserDataDriver is implemented by drivers which can pass a user-data
+// document (such as a cloud-init config) to the host when it is created.
+// It is optional; only drivers implementing it support cloud-init provisioning.
+type UserDataDriver interface {
+	// SetUserData sets the user-data to pass to the host on Create
+	SetUserData(userData []byte) error
+}
+
 // RegisteredDriver is used to register a driver with the Register function.
 // It has two attributes:
 // - New: a function that returns a new driver given a path to store host
@@ -174,6 +201,12 @@ type DriverOptions interface {
 }
 
 func RunSSHCommandFromDriver(d Driver, args string) (ssh.Output, error) {
+	return RunSSHCommandWithInputFromDriver(d, args, nil)
+}
+
+// RunSSHCommandWithInputFromDriver runs the command with its stdin read
+// from input, e.g. to stream a file to the host.
+func RunSSHCommandWithInputFromDriver(d Driver, args string, input io.Reader) (ssh.Output, error) {
 	var output ssh.Output
 
 	host, err := d.GetSSHHostname()
@@ -198,7 +231,7 @@ func RunSSHCommandFromDriver(d Driver, args string) (ssh.Output, error) {
 		return output, err
 	}
 
-	return client.Run(args)
+	return client.RunWithInput(args, input)
 }
 
 func MachineInState(d Driver, desiredState state.State) func() bool {
@@ -2,8 +2,10 @@ package exoscale
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"text/template"
@@ -19,8 +21,8 @@ import (
 
 type Driver struct {
 	URL              string
-	ApiKey           string
-	ApiSecretKey     string
+	ApiKey           string `json:"-"`
+	ApiSecretKey     string `json:"-"`
 	InstanceProfile  string
 	DiskSize         int
 	Image            string
@@ -40,6 +42,17 @@ type Driver struct {
 	storePath        string
 }
 
+var (
+	apiKeyCredential = drivers.Credential{
+		Name:   "exoscale-api-key",
+		EnvVar: "EXOSCALE_API_KEY",
+	}
+	apiSecretKeyCredential = drivers.Credential{
+		Name:   "exoscale-api-secret-key",
+		EnvVar: "EXOSCALE_API_SECRET",
+	}
+)
+
 func init() {
 	drivers.Register("exoscale", &drivers.RegisteredDriver{
 		New:            NewDriver,
@@ -108,7 +121,37 @@ func NewDriver(machineName string, storePath string, caCert string, privateKey s
 	return &Driver{MachineName: machineName, storePath: storePath, CaCertPath: caCert, PrivateKeyPath: privateKey}, nil
 }
 
+// AuthorizePort adds rules for the ports to the machine's security group,
+// which may be shared by other machines
 func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
+	group, err := getSecurityGroup(client, d.SecurityGroup)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range ports {
+		protocol := strings.ToUpper(p.Protocol)
+		if group.allows(protocol, p.Port) {
+			continue
+		}
+
+		log.Debugf("authorizing port %d/%s in security group %s", p.Port, protocol, d.SecurityGroup)
+		rule := egoscale.SecurityGroupRule{
+			SecurityGroupId: group.Id,
+			Cidr:            "0.0.0.0/0",
+			Protocol:        protocol,
+			Port:            p.Port,
+		}
+		if _, err := client.CreateIngressRule(rule); err != nil {
+			return fmt.Errorf("error authorizing port %d in security group %s: %s", p.Port, d.SecurityGroup, err)
+		}
+	}
+
 	return nil
 }
 
@@ -161,8 +204,8 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	if d.URL == "" {
 		d.URL = "https://api.exoscale.ch/compute"
 	}
-	if d.ApiKey == "" || d.ApiSecretKey == "" {
-		return fmt.Errorf("Please specify an API key (--exoscale-api-key) and an API secret key (--exoscale-api-secret-key).")
+	if _, err := d.getClient(); err != nil {
+		return err
 	}
 
 	return nil
@@ -176,6 +219,15 @@ func (d *Driver) GetURL() (string, error) {
 	return fmt.Sprintf("tcp://%s:2376", ip), nil
 }
 
+// GetEngineLabels describes the instance for swarm scheduling
+func (d *Driver) GetEngineLabels() (map[string]string, error) {
+	return map[string]string{
+		"zone":         d.AvailabilityZone,
+		"instancetype": d.InstanceProfile,
+		"disk":         fmt.Sprintf("%d", d.DiskSize),
+	}, nil
+}
+
 func (d *Driver) GetIP() (string, error) {
 	if d.IPAddress == "" {
 		return "", fmt.Errorf("IP address is not set")
@@ -184,7 +236,11 @@ func (d *Driver) GetIP() (string, error) {
 }
 
 func (d *Driver) GetState() (state.State, error) {
-	client := egoscale.NewClient(d.URL, d.ApiKey, d.ApiSecretKey)
+	client, err := d.getClient()
+	if err != nil {
+		return state.Error, err
+	}
+
 	vm, err := client.GetVirtualMachine(d.Id)
 	if err != nil {
 		return state.Error, err
@@ -220,7 +276,11 @@ func (d *Driver) PreCreateCheck() error {
 
 func (d *Driver) Create() error {
 	log.Infof("Querying exoscale for the requested parameters...")
-	client := egoscale.NewClient(d.URL, d.ApiKey, d.ApiSecretKey)
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
 	topology, err := client.GetTopology()
 	if err != nil {
 		return err
@@ -347,7 +407,11 @@ func (d *Driver) Start() error {
 		return nil
 	}
 
-	client := egoscale.NewClient(d.URL, d.ApiKey, d.ApiSecretKey)
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
 	svmresp, err := client.StartVirtualMachine(d.Id)
 	if err != nil {
 		return err
@@ -369,7 +433,11 @@ func (d *Driver) Stop() error {
 		return nil
 	}
 
-	client := egoscale.NewClient(d.URL, d.ApiKey, d.ApiSecretKey)
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
 	svmresp, err := client.StopVirtualMachine(d.Id)
 	if err != nil {
 		return err
@@ -382,7 +450,11 @@ func (d *Driver) Stop() error {
 }
 
 func (d *Driver) Remove() error {
-	client := egoscale.NewClient(d.URL, d.ApiKey, d.ApiSecretKey)
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
 	dvmresp, err := client.DestroyVirtualMachine(d.Id)
 	if err != nil {
 		return err
@@ -403,7 +475,11 @@ func (d *Driver) Restart() error {
 		return fmt.Errorf("Host is stopped, use start command to start it")
 	}
 
-	client := egoscale.NewClient(d.URL, d.ApiKey, d.ApiSecretKey)
+	client, err := d.getClient()
+	if err != nil {
+		return err
+	}
+
 	svmresp, err := client.RebootVirtualMachine(d.Id)
 	if err != nil {
 		return err
@@ -468,3 +544,65 @@ resize_rootfs: true
 	}
 	return buffer.String(), nil
 }
+
+// securityGroup is a security group with its ingress rules, which the
+// client's ListSecurityGroupsResponse leaves out
+type securityGroup struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	IngressRule []struct {
+		Protocol  string `json:"protocol"`
+		StartPort int    `json:"startport"`
+		EndPort   int    `json:"endport"`
+		Cidr      string `json:"cidr"`
+	} `json:"ingressrule"`
+}
+
+// allows reports whether the group has a rule opening the port to anyone
+func (g *securityGroup) allows(protocol string, port int) bool {
+	for _, rule := range g.IngressRule {
+		if strings.EqualFold(rule.Protocol, protocol) && rule.Cidr == "0.0.0.0/0" && rule.StartPort <= port && port <= rule.EndPort {
+			return true
+		}
+	}
+	return false
+}
+
+func getSecurityGroup(client *egoscale.Client, name string) (*securityGroup, error) {
+	params := url.Values{}
+	params.Set("securitygroupname", name)
+
+	resp, err := client.Request("listSecurityGroups", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var r struct {
+		SecurityGroups []*securityGroup `json:"securitygroup"`
+	}
+	if err := json.Unmarshal(resp, &r); err != nil {
+		return nil, err
+	}
+
+	for _, group := range r.SecurityGroups {
+		if group.Name == name {
+			return group, nil
+		}
+	}
+
+	return nil, fmt.Errorf("security group %s not found", name)
+}
+
+// getClient returns an API client, resolving the API keys, which are not
+// stored in the config
+func (d *Driver) getClient() (*egoscale.Client, error) {
+	if err := drivers.ResolveCredential(&d.ApiKey, apiKeyCredential); err != nil {
+		return nil, err
+	}
+
+	if err := drivers.ResolveCredential(&d.ApiSecretKey, apiSecretKeyCredential); err != nil {
+		return nil, err
+	}
+
+	return egoscale.NewClient(d.URL, d.ApiKey, d.ApiSecretKey), nil
+}
@@ -3,10 +3,12 @@ package google
 import (
 	"fmt"
 	"io/ioutil"
-	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/libmachine/swarm"
 	"github.com/docker/machine/log"
 	"github.com/docker/machine/ssh"
 	raw "google.golang.org/api/compute/v1"
@@ -101,17 +103,15 @@ func (c *ComputeUtil) createFirewallRule() error {
 	}
 
 	if c.SwarmMaster {
-		u, err := url.Parse(c.SwarmHost)
+		listenAddr, err := swarm.ParseAddress(c.SwarmHost, swarm.DefaultPort)
 		if err != nil {
 			return fmt.Errorf("error authorizing port for swarm: %s", err)
 		}
 
-		parts := strings.Split(u.Host, ":")
-		swarmPort := parts[1]
 		allowed = append(allowed, &raw.FirewallAllowed{
 			IPProtocol: "tcp",
 			Ports: []string{
-				swarmPort,
+				strconv.Itoa(listenAddr.Port),
 			},
 		})
 	}
@@ -132,6 +132,48 @@ func (c *ComputeUtil) createFirewallRule() error {
 	return c.waitForGlobalOp(op.Name)
 }
 
+// authorizePorts adds the ports missing from the firewall rule to it
+func (c *ComputeUtil) authorizePorts(ports []*drivers.Port) error {
+	rule, err := c.firewallRule()
+	if err != nil {
+		return err
+	}
+
+	allowed := map[string]bool{}
+	for _, a := range rule.Allowed {
+		for _, p := range a.Ports {
+			allowed[a.IPProtocol+"/"+p] = true
+		}
+	}
+
+	missing := false
+	for _, p := range ports {
+		port := strconv.Itoa(p.Port)
+		if allowed[p.Protocol+"/"+port] {
+			continue
+		}
+
+		rule.Allowed = append(rule.Allowed, &raw.FirewallAllowed{
+			IPProtocol: p.Protocol,
+			Ports: []string{
+				port,
+			},
+		})
+		missing = true
+	}
+
+	if !missing {
+		return nil
+	}
+
+	log.Infof("Updating firewall rule.")
+	op, err := c.service.Firewalls.Update(c.project, firewallRule, rule).Do()
+	if err != nil {
+		return err
+	}
+	return c.waitForGlobalOp(op.Name)
+}
+
 // instance retrieves the instance.
 func (c *ComputeUtil) instance() (*raw.Instance, error) {
 	return c.service.Instances.Get(c.project, c.zone, c.instanceName).Do()
@@ -191,6 +233,16 @@ func (c *ComputeUtil) createInstance(d *Driver) error {
 	} else {
 		instance.Disks[0].Source = c.zoneURL + "/disks/" + c.instanceName + "-disk"
 	}
+	if len(d.userData) > 0 {
+		instance.Metadata = &raw.Metadata{
+			Items: []*raw.MetadataItems{
+				{
+					Key:   "user-data",
+					Value: string(d.userData),
+				},
+			},
+		}
+	}
 	op, err := c.service.Instances.Insert(c.project, c.zone, instance).Do()
 
 	if err != nil {
@@ -213,7 +265,7 @@ func (c *ComputeUtil) createInstance(d *Driver) error {
 		return err
 	}
 	log.Infof("Uploading SSH Key")
-	op, err = c.service.Instances.SetMetadata(c.project, c.zone, c.instanceName, &raw.Metadata{
+	metadata := &raw.Metadata{
 		Fingerprint: instance.Metadata.Fingerprint,
 		Items: []*raw.MetadataItems{
 			{
@@ -221,7 +273,15 @@ func (c *ComputeUtil) createInstance(d *Driver) error {
 				Value: c.userName + ":" + string(sshKey) + "\n",
 			},
 		},
-	}).Do()
+	}
+	// SetMetadata replaces all items, so keep the user-data around
+	if len(d.userData) > 0 {
+		metadata.Items = append(metadata.Items, &raw.MetadataItems{
+			Key:   "user-data",
+			Value: string(d.userData),
+		})
+	}
+	op, err = c.service.Instances.SetMetadata(c.project, c.zone, c.instanceName, metadata).Do()
 	if err != nil {
 		return err
 	}
@@ -31,6 +31,7 @@ type Driver struct {
 	SwarmMaster    bool
 	SwarmHost      string
 	SwarmDiscovery string
+	userData       []byte
 }
 
 func init() {
@@ -103,8 +104,15 @@ func NewDriver(machineName string, storePath string, caCert string, privateKey s
 	}, nil
 }
 
+// AuthorizePort opens the ports in the firewall rule, which is shared by
+// all machines
 func (d *Driver) AuthorizePort(ports []*drivers.Port) error {
-	return nil
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return err
+	}
+
+	return c.authorizePorts(ports)
 }
 
 func (d *Driver) DeauthorizePort(ports []*drivers.Port) error {
@@ -172,6 +180,11 @@ func (d *Driver) initApis() (*ComputeUtil, error) {
 	return newComputeUtil(d)
 }
 
+func (d *Driver) SetUserData(userData []byte) error {
+	d.userData = userData
+	return nil
+}
+
 func (d *Driver) PreCreateCheck() error {
 	return nil
 }
@@ -207,6 +220,15 @@ func (d *Driver) GetURL() (string, error) {
 	return url, nil
 }
 
+// GetEngineLabels describes the instance for swarm scheduling
+func (d *Driver) GetEngineLabels() (map[string]string, error) {
+	return map[string]string{
+		"zone":         d.Zone,
+		"instancetype": d.MachineType,
+		"disk":         fmt.Sprintf("%d", d.DiskSize),
+	}, nil
+}
+
 // GetIP returns the IP address of the GCE instance.
 func (d *Driver) GetIP() (string, error) {
 	c, err := newComputeUtil(d)
@@ -216,6 +238,24 @@ func (d *Driver) GetIP() (string, error) {
 	return c.ip()
 }
 
+func (d *Driver) GetPrivateIP() (string, error) {
+	c, err := newComputeUtil(d)
+	if err != nil {
+		return "", err
+	}
+
+	instance, err := c.instance()
+	if err != nil {
+		return "", err
+	}
+
+	if len(instance.NetworkInterfaces) == 0 {
+		return "", fmt.Errorf("instance %s has no network interface", d.MachineName)
+	}
+
+	return instance.NetworkInterfaces[0].NetworkIP, nil
+}
+
 // GetState returns a docker.hosts.state.State value representing the current state of the host.
 func (d *Driver) GetState() (state.State, error) {
 	c, err := newComputeUtil(d)
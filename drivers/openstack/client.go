@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/log"
 	"github.com/docker/machine/version"
 	"github.com/rackspace/gophercloud"
@@ -56,6 +57,7 @@ func (c *GenericClient) CreateInstance(d *Driver) (string, error) {
 		FlavorRef:      d.FlavorId,
 		ImageRef:       d.ImageId,
 		SecurityGroups: d.SecurityGroups,
+		UserData:       d.userData,
 	}
 	if d.NetworkId != "" {
 		serverOpts.Networks = []servers.Network{
@@ -406,6 +408,11 @@ func (c *GenericClient) Authenticate(d *Driver) error {
 		"TenantID":   d.TenantId,
 	}).Debug("Authenticating...")
 
+	// the password is not stored in the config
+	if err := drivers.ResolveCredential(&d.Password, passwordCredential); err != nil {
+		return err
+	}
+
 	opts := gophercloud.AuthOptions{
 		IdentityEndpoint: d.AuthUrl,
 		DomainID:         d.DomainID,
@@ -22,7 +22,7 @@ type Driver struct {
 	DomainID         string
 	DomainName       string
 	Username         string
-	Password         string
+	Password         string `json:"-"`
 	TenantName       string
 	TenantId         string
 	Region           string
@@ -49,6 +49,12 @@ type Driver struct {
 	SwarmHost        string
 	SwarmDiscovery   string
 	client           Client
+	userData         []byte
+}
+
+var passwordCredential = drivers.Credential{
+	Name:   "openstack-password",
+	EnvVar: "OS_PASSWORD",
 }
 
 func init() {
@@ -277,6 +283,14 @@ func (d *Driver) GetURL() (string, error) {
 	return fmt.Sprintf("tcp://%s:2376", ip), nil
 }
 
+// GetEngineLabels describes the instance for swarm scheduling
+func (d *Driver) GetEngineLabels() (map[string]string, error) {
+	return map[string]string{
+		"region":       d.Region,
+		"instancetype": d.FlavorName,
+	}, nil
+}
+
 func (d *Driver) GetIP() (string, error) {
 	if d.IPAddress != "" {
 		return d.IPAddress, nil
@@ -309,6 +323,30 @@ func (d *Driver) GetIP() (string, error) {
 	return "", fmt.Errorf("No IP found for the machine")
 }
 
+func (d *Driver) GetPrivateIP() (string, error) {
+	// without a floating IP the fixed address is the one from GetIP
+	if d.FloatingIpPool == "" {
+		return "", nil
+	}
+
+	if err := d.initCompute(); err != nil {
+		return "", err
+	}
+
+	addresses, err := d.client.GetInstanceIpAddresses(d)
+	if err != nil {
+		return "", err
+	}
+
+	for _, a := range addresses {
+		if a.AddressType == Fixed {
+			return a.Address, nil
+		}
+	}
+
+	return "", nil
+}
+
 func (d *Driver) GetState() (state.State, error) {
 	log.WithField("MachineId", d.MachineId).Debug("Get status for OpenStack instance...")
 	if err := d.initCompute(); err != nil {
@@ -342,6 +380,11 @@ func (d *Driver) GetState() (state.State, error) {
 	return state.None, nil
 }
 
+func (d *Driver) SetUserData(userData []byte) error {
+	d.userData = userData
+	return nil
+}
+
 func (d *Driver) PreCreateCheck() error {
 	return nil
 }
@@ -444,8 +487,8 @@ func (d *Driver) checkConfig() error {
 	if d.Username == "" {
 		return fmt.Errorf(errorMandatoryEnvOrOption, "Username", "OS_USERNAME", "--openstack-username")
 	}
-	if d.Password == "" {
-		return fmt.Errorf(errorMandatoryEnvOrOption, "Password", "OS_PASSWORD", "--openstack-password")
+	if err := drivers.ResolveCredential(&d.Password, passwordCredential); err != nil {
+		return err
 	}
 	if d.TenantName == "" && d.TenantId == "" {
 		return fmt.Errorf(errorMandatoryTenantNameOrId)
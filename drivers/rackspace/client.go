@@ -3,6 +3,7 @@ package rackspace
 import (
 	"fmt"
 
+	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/drivers/openstack"
 	"github.com/docker/machine/log"
 	"github.com/docker/machine/version"
@@ -31,6 +32,11 @@ func (c *Client) Authenticate(d *openstack.Driver) error {
 		"Username": d.Username,
 	}).Debug("Authenticating to Rackspace.")
 
+	// the API key is not stored in the config
+	if err := drivers.ResolveCredential(&c.driver.APIKey, apiKeyCredential); err != nil {
+		return err
+	}
+
 	apiKey := c.driver.APIKey
 	opts := gophercloud.AuthOptions{
 		Username: d.Username,
@@ -13,7 +13,12 @@ import (
 type Driver struct {
 	*openstack.Driver
 
-	APIKey string
+	APIKey string `json:"-"`
+}
+
+var apiKeyCredential = drivers.Credential{
+	Name:   "rackspace-api-key",
+	EnvVar: "OS_API_KEY",
 }
 
 func init() {
@@ -133,8 +138,8 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	if d.Username == "" {
 		return missingEnvOrOption("Username", "OS_USERNAME", "--rackspace-username")
 	}
-	if d.APIKey == "" {
-		return missingEnvOrOption("API key", "OS_API_KEY", "--rackspace-api-key")
+	if err := drivers.ResolveCredential(&d.APIKey, apiKeyCredential); err != nil {
+		return err
 	}
 
 	if d.ImageId == "" {
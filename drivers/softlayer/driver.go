@@ -3,7 +3,6 @@ package softlayer
 import (
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"regexp"
 	"time"
@@ -20,6 +19,11 @@ const (
 	ApiEndpoint = "https://api.softlayer.com/rest/v3"
 )
 
+var apiKeyCredential = drivers.Credential{
+	Name:   "softlayer-api-key",
+	EnvVar: "SOFTLAYER_API_KEY",
+}
+
 type Driver struct {
 	storePath      string
 	IPAddress      string
@@ -104,10 +108,6 @@ func (d *Driver) GetProviderType() provider.ProviderType {
 }
 
 func GetCreateFlags() []cli.Flag {
-	// Set hourly billing to true by default since codegangsta cli doesn't take default bool values
-	if os.Getenv("SOFTLAYER_HOURLY_BILLING") == "" {
-		os.Setenv("SOFTLAYER_HOURLY_BILLING", "true")
-	}
 	return []cli.Flag{
 		cli.IntFlag{
 			EnvVar: "SOFTLAYER_MEMORY",
@@ -163,7 +163,8 @@ func GetCreateFlags() []cli.Flag {
 			Usage:  "softlayer api endpoint to use",
 			Value:  ApiEndpoint,
 		},
-		cli.BoolFlag{
+		// BoolTFlag is true by default.
+		cli.BoolTFlag{
 			EnvVar: "SOFTLAYER_HOURLY_BILLING",
 			Name:   "softlayer-hourly-billing",
 			Usage:  "set hourly billing for machine - on by default",
@@ -228,8 +229,8 @@ func validateDeviceConfig(c *deviceConfig) error {
 }
 
 func validateClientConfig(c *Client) error {
-	if c.ApiKey == "" {
-		return fmt.Errorf("Missing required setting - --softlayer-api-key")
+	if err := drivers.ResolveCredential(&c.ApiKey, apiKeyCredential); err != nil {
+		return err
 	}
 
 	if c.User == "" {
@@ -308,6 +309,14 @@ func (d *Driver) GetIP() (string, error) {
 	}
 }
 
+func (d *Driver) GetPrivateIP() (string, error) {
+	// GetIP already returns the private address on private networks
+	if d.deviceConfig != nil && d.deviceConfig.PrivateNet == true {
+		return "", nil
+	}
+	return d.getClient().VirtualGuest().GetPrivateIp(d.Id)
+}
+
 func (d *Driver) GetState() (state.State, error) {
 	s, err := d.getClient().VirtualGuest().PowerState(d.Id)
 	if err != nil {
@@ -7,11 +7,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+
+	"github.com/docker/machine/drivers"
 )
 
 type Client struct {
 	User     string
-	ApiKey   string
+	ApiKey   string `json:"-"`
 	Endpoint string
 }
 
@@ -94,6 +96,11 @@ func (c *Client) newRequest(method, uri string, body interface{}) ([]byte, error
 		req    *http.Request
 	)
 
+	// the API key is not stored in the config
+	if err := drivers.ResolveCredential(&c.ApiKey, apiKeyCredential); err != nil {
+		return nil, err
+	}
+
 	if body != nil {
 		bodyJson, err := json.Marshal(body)
 		if err != nil {
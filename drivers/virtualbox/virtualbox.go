@@ -489,6 +489,20 @@ func (d *Driver) setMachineNameIfNotSet() {
 	}
 }
 
+// GetEngineLabels describes the VM for swarm scheduling
+func (d *Driver) GetEngineLabels() (map[string]string, error) {
+	cpus := d.CPU
+	if cpus < 1 {
+		cpus = int(runtime.NumCPU())
+	}
+
+	return map[string]string{
+		"memory": strconv.Itoa(d.Memory),
+		"cpus":   strconv.Itoa(cpus),
+		"disk":   strconv.Itoa(d.DiskSize / 1024),
+	}, nil
+}
+
 func (d *Driver) GetIP() (string, error) {
 	// DHCP is used to get the IP, so virtualbox hosts don't have IPs unless
 	// they are running
@@ -24,7 +24,7 @@ import (
 type Driver struct {
 	IPAddress      string
 	UserName       string
-	UserPassword   string
+	UserPassword   string `json:"-"`
 	ComputeID      string
 	VDCID          string
 	OrgVDCNet      string
@@ -48,6 +48,11 @@ type Driver struct {
 	storePath      string
 }
 
+var passwordCredential = drivers.Credential{
+	Name:   "vmwarevcloudair-password",
+	EnvVar: "VCLOUDAIR_PASSWORD",
+}
+
 func init() {
 	drivers.Register("vmwarevcloudair", &drivers.RegisteredDriver{
 		New:            NewDriver,
@@ -202,10 +207,14 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.SwarmDiscovery = flags.String("swarm-discovery")
 
 	// Check for required Params
-	if d.UserName == "" || d.UserPassword == "" || d.VDCID == "" || d.PublicIP == "" {
+	if d.UserName == "" || d.VDCID == "" || d.PublicIP == "" {
 		return fmt.Errorf("Please specify vcloudair mandatory params using options: -vmwarevcloudair-username -vmwarevcloudair-password -vmwarevcloudair-vdcid and -vmwarevcloudair-publicip")
 	}
 
+	if err := drivers.ResolveCredential(&d.UserPassword, passwordCredential); err != nil {
+		return err
+	}
+
 	// If ComputeID is not set we're using a VPC, hence setting ComputeID = VDCID
 	if flags.String("vmwarevcloudair-computeid") == "" {
 		d.ComputeID = flags.String("vmwarevcloudair-vdcid")
@@ -257,7 +266,7 @@ func (d *Driver) GetState() (state.State, error) {
 
 	log.Debug("Connecting to vCloud Air to fetch vApp Status...")
 	// Authenticate to vCloud Air
-	v, err := p.Authenticate(d.UserName, d.UserPassword, d.ComputeID, d.VDCID)
+	v, err := d.authenticate(p)
 	if err != nil {
 		return state.Error, err
 	}
@@ -304,7 +313,7 @@ func (d *Driver) Create() error {
 
 	log.Infof("Connecting to vCloud Air...")
 	// Authenticate to vCloud Air
-	v, err := p.Authenticate(d.UserName, d.UserPassword, d.ComputeID, d.VDCID)
+	v, err := d.authenticate(p)
 	if err != nil {
 		return err
 	}
@@ -431,7 +440,7 @@ func (d *Driver) Remove() error {
 
 	log.Infof("Connecting to vCloud Air...")
 	// Authenticate to vCloud Air
-	v, err := p.Authenticate(d.UserName, d.UserPassword, d.ComputeID, d.VDCID)
+	v, err := d.authenticate(p)
 	if err != nil {
 		return err
 	}
@@ -509,7 +518,7 @@ func (d *Driver) Start() error {
 
 	log.Infof("Connecting to vCloud Air...")
 	// Authenticate to vCloud Air
-	v, err := p.Authenticate(d.UserName, d.UserPassword, d.ComputeID, d.VDCID)
+	v, err := d.authenticate(p)
 	if err != nil {
 		return err
 	}
@@ -553,7 +562,7 @@ func (d *Driver) Stop() error {
 
 	log.Infof("Connecting to vCloud Air...")
 	// Authenticate to vCloud Air
-	v, err := p.Authenticate(d.UserName, d.UserPassword, d.ComputeID, d.VDCID)
+	v, err := d.authenticate(p)
 	if err != nil {
 		return err
 	}
@@ -598,7 +607,7 @@ func (d *Driver) Restart() error {
 
 	log.Infof("Connecting to vCloud Air...")
 	// Authenticate to vCloud Air
-	v, err := p.Authenticate(d.UserName, d.UserPassword, d.ComputeID, d.VDCID)
+	v, err := d.authenticate(p)
 	if err != nil {
 		return err
 	}
@@ -653,7 +662,7 @@ func (d *Driver) Kill() error {
 
 	log.Infof("Connecting to vCloud Air...")
 	// Authenticate to vCloud Air
-	v, err := p.Authenticate(d.UserName, d.UserPassword, d.ComputeID, d.VDCID)
+	v, err := d.authenticate(p)
 	if err != nil {
 		return err
 	}
@@ -712,3 +721,13 @@ func (d *Driver) createSSHKey() (string, error) {
 func (d *Driver) publicSSHKeyPath() string {
 	return d.GetSSHKeyPath() + ".pub"
 }
+
+// authenticate logs in to vCloud Air, resolving the password, which is not
+// stored in the config
+func (d *Driver) authenticate(p *govcloudair.Client) (govcloudair.Vdc, error) {
+	if err := drivers.ResolveCredential(&d.UserPassword, passwordCredential); err != nil {
+		return govcloudair.Vdc{}, err
+	}
+
+	return p.Authenticate(d.UserName, d.UserPassword, d.ComputeID, d.VDCID)
+}
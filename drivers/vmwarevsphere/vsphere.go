@@ -47,7 +47,7 @@ type Driver struct {
 	Boot2DockerURL string
 	IP             string
 	Username       string
-	Password       string
+	Password       string `json:"-"`
 	Network        string
 	Datastore      string
 	Datacenter     string
@@ -64,6 +64,11 @@ type Driver struct {
 	storePath string
 }
 
+var passwordCredential = drivers.Credential{
+	Name:   "vmwarevsphere-password",
+	EnvVar: "VSPHERE_PASSWORD",
+}
+
 func init() {
 	drivers.Register("vmwarevsphere", &drivers.RegisteredDriver{
 		New:            NewDriver,
@@ -239,6 +244,10 @@ func (d *Driver) GetIP() (string, error) {
 }
 
 func (d *Driver) GetState() (state.State, error) {
+	if err := d.loadCredentials(); err != nil {
+		return state.None, err
+	}
+
 	vcConn := NewVcConn(d)
 	stdout, err := vcConn.VMInfo()
 	if err != nil {
@@ -414,6 +423,10 @@ func (d *Driver) Start() error {
 }
 
 func (d *Driver) Stop() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	vcConn := NewVcConn(d)
 	if err := vcConn.VMShutdown(); err != nil {
 		return err
@@ -473,6 +486,10 @@ func (d *Driver) Restart() error {
 }
 
 func (d *Driver) Kill() error {
+	if err := d.loadCredentials(); err != nil {
+		return err
+	}
+
 	vcConn := NewVcConn(d)
 	if err := vcConn.VMPowerOff(); err != nil {
 		return err
@@ -491,6 +508,13 @@ func (d *Driver) publicSSHKeyPath() string {
 	return d.GetSSHKeyPath() + ".pub"
 }
 
+// loadCredentials resolves the password, which is not stored in the config.
+// It is called by the methods which connect to vCenter; the others go
+// through GetState.
+func (d *Driver) loadCredentials() error {
+	return drivers.ResolveCredential(&d.Password, passwordCredential)
+}
+
 func (d *Driver) checkVsphereConfig() error {
 	if d.IP == "" {
 		return errors.NewIncompleteVsphereConfigError("vSphere IP")
@@ -498,8 +522,8 @@ func (d *Driver) checkVsphereConfig() error {
 	if d.Username == "" {
 		return errors.NewIncompleteVsphereConfigError("vSphere username")
 	}
-	if d.Password == "" {
-		return errors.NewIncompleteVsphereConfigError("vSphere password")
+	if err := d.loadCredentials(); err != nil {
+		return err
 	}
 	if d.Network == "" {
 		return errors.NewIncompleteVsphereConfigError("vSphere network")
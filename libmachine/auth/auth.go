@@ -11,4 +11,23 @@ type AuthOptions struct {
 	ServerKeyRemotePath  string
 	PrivateKeyPath       string
 	ClientCertPath       string
+	// ServerCertSANs are extra IP addresses and DNS names the server
+	// certificate is issued for
+	ServerCertSANs []string
+	// KeyAlgorithm, KeySize, CertValidityDays and CertOrg configure the
+	// server certificate; zero values select the defaults
+	KeyAlgorithm     string
+	KeySize          int
+	CertValidityDays int
+	CertOrg          string
+	// CaChainPath holds the certificates the CA chains to when it is an
+	// intermediate CA; they are trusted along with the CA
+	CaChainPath string
+	// SignerCommand or SignerURL issue the server certificate from a
+	// certificate signing request instead of the local CA key
+	SignerCommand string
+	SignerURL     string
+	// TrustedCaCertPaths are CA certificates trusted in addition to the CA
+	// while the CA is being rotated
+	TrustedCaCertPaths []string
 }
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// RevokedCert is the CA of a client certificate which the daemons must no
+// longer trust
+type RevokedCert struct {
+	Name      string
+	Serial    string
+	RevokedAt time.Time
+}
+
+// RevocationList is the list of revoked client certificates, kept as JSON
+// in the machine cert dir.  The CAs listed in it are left out of the CA
+// bundle uploaded to the daemons.
+type RevocationList struct {
+	path    string
+	Revoked []RevokedCert
+}
+
+// LoadRevocationList reads the revocation list at path; a missing file is
+// an empty list.
+func LoadRevocationList(path string) (*RevocationList, error) {
+	l := &RevocationList{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("error reading the revocation list %s: %s", path, err)
+	}
+
+	return l, nil
+}
+
+// Revoke adds the certificate to the list.  It returns false if the serial
+// number was already revoked.
+func (l *RevocationList) Revoke(name, serial string) bool {
+	for _, r := range l.Revoked {
+		if r.Serial == serial {
+			return false
+		}
+	}
+
+	l.Revoked = append(l.Revoked, RevokedCert{
+		Name:      name,
+		Serial:    serial,
+		RevokedAt: time.Now().UTC(),
+	})
+
+	return true
+}
+
+// IsRevoked reports whether a certificate issued for name was revoked
+func (l *RevocationList) IsRevoked(name string) bool {
+	for _, r := range l.Revoked {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSerialRevoked reports whether the certificate with the serial number
+// was revoked
+func (l *RevocationList) IsSerialRevoked(serial string) bool {
+	for _, r := range l.Revoked {
+		if r.Serial == serial {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *RevocationList) Save() error {
+	data, err := json.MarshalIndent(l, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(l.path, data, 0600)
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRevocationList(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "revoked.json")
+
+	l, err := LoadRevocationList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l.Revoked) != 0 {
+		t.Fatalf("expected an empty list; received %v", l.Revoked)
+	}
+
+	if !l.Revoke("alice", "1234") {
+		t.Fatal("expected the certificate to be revoked")
+	}
+
+	if l.Revoke("alice", "1234") {
+		t.Fatal("expected the certificate to be revoked only once")
+	}
+
+	if !l.IsRevoked("alice") || l.IsRevoked("bob") {
+		t.Fatal("expected only the certificate of alice to be revoked")
+	}
+
+	if !l.IsSerialRevoked("1234") || l.IsSerialRevoked("5678") {
+		t.Fatal("expected only serial 1234 to be revoked")
+	}
+
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = LoadRevocationList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l.Revoked) != 1 || l.Revoked[0].Name != "alice" || l.Revoked[0].Serial != "1234" || l.Revoked[0].RevokedAt.IsZero() {
+		t.Fatalf("unexpected revocation list %+v", l.Revoked)
+	}
+}
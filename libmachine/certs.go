@@ -1,10 +1,134 @@
 package libmachine
 
+import (
+	"os"
+	"time"
+
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/log"
+	"github.com/docker/machine/utils"
+)
+
+// Server certificates which expire within this window are reissued
+// automatically when the machine is started.
+const CertRenewalWindow = time.Hour * 24 * 30
+
 type CertPathInfo struct {
 	CaCertPath     string
 	CaKeyPath      string
+	CaChainPath    string
 	ClientCertPath string
 	ClientKeyPath  string
 	ServerCertPath string
 	ServerKeyPath  string
 }
+
+// CertExpiry is when the certificates used to connect to a host expire.
+// A zero time means the certificate could not be read.
+type CertExpiry struct {
+	CaCert     time.Time
+	ClientCert time.Time
+	ServerCert time.Time
+}
+
+// Earliest returns the first of the certificates to expire
+func (c CertExpiry) Earliest() time.Time {
+	earliest := time.Time{}
+	for _, t := range []time.Time{c.CaCert, c.ClientCert, c.ServerCert} {
+		if t.IsZero() {
+			continue
+		}
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return earliest
+}
+
+func (h *Host) GetCertExpiry() CertExpiry {
+	authOptions := h.authOptions()
+	expiry := CertExpiry{}
+
+	for _, c := range []struct {
+		path   string
+		expiry *time.Time
+	}{
+		{authOptions.CaCertPath, &expiry.CaCert},
+		{authOptions.ClientCertPath, &expiry.ClientCert},
+		{authOptions.ServerCertPath, &expiry.ServerCert},
+	} {
+		t, err := utils.GetCertificateExpiry(c.path)
+		if err != nil {
+			log.Debugf("error reading the expiry of %s: %s", c.path, err)
+			continue
+		}
+		*c.expiry = t
+	}
+
+	return expiry
+}
+
+func (h *Host) authOptions() auth.AuthOptions {
+	if h.HostOptions == nil || h.HostOptions.AuthOptions == nil {
+		return auth.AuthOptions{}
+	}
+	return *h.HostOptions.AuthOptions
+}
+
+// ServerCertExpiresWithin reports whether the server certificate expires
+// within the given window
+func (h *Host) ServerCertExpiresWithin(window time.Duration) (bool, error) {
+	expiry, err := utils.GetCertificateExpiry(h.authOptions().ServerCertPath)
+	if err != nil {
+		return false, err
+	}
+
+	return time.Now().Add(window).After(expiry), nil
+}
+
+// renewServerCert reissues the server certificate of a started machine if
+// it is about to expire or no longer covers the machine's IP address, which
+// can change across restarts (e.g. with DHCP or cloud stop/start).
+func (h *Host) renewServerCert() error {
+	serverCertPath := h.authOptions().ServerCertPath
+	if _, err := os.Stat(serverCertPath); err != nil || h.Driver.DriverName() == "none" {
+		return nil
+	}
+
+	if err := WaitForSSH(h); err != nil {
+		return err
+	}
+
+	ip, err := h.Driver.GetIP()
+	if err != nil {
+		return err
+	}
+
+	certHosts, err := utils.GetCertificateHosts(serverCertPath)
+	if err != nil {
+		return err
+	}
+
+	ipChanged := true
+	for _, certHost := range certHosts {
+		if certHost == ip {
+			ipChanged = false
+		}
+	}
+
+	expiring, err := h.ServerCertExpiresWithin(CertRenewalWindow)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case ipChanged:
+		log.Infof("IP address of %s changed to %s, reissuing its server certificate...", h.Name, ip)
+	case expiring:
+		log.Infof("Server certificate for %s expires soon, reissuing...", h.Name)
+	default:
+		return nil
+	}
+
+	return h.ConfigureAuth()
+}
@@ -0,0 +1,550 @@
+package libmachine
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/libmachine/swarm"
+	"github.com/docker/machine/log"
+)
+
+// ClusterMembers returns the machines in the store which belong to the
+// named swarm cluster
+func (m *Machine) ClusterMembers(cluster string) ([]*Host, error) {
+	hosts, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	members := []*Host{}
+	for _, h := range hosts {
+		if h.HostOptions == nil || h.HostOptions.SwarmOptions == nil {
+			continue
+		}
+		if h.HostOptions.SwarmOptions.IsSwarm && h.HostOptions.SwarmOptions.Cluster == cluster {
+			members = append(members, h)
+		}
+	}
+
+	return members, nil
+}
+
+// resolveClusterDiscovery sets the discovery of a machine joining a named
+// cluster: that of the cluster's KV store, or a static list of the
+// members' daemons, to which Host.Create adds the machine itself.  The
+// discovery of a machine running the KV store is set once it has an IP.
+func (m *Machine) resolveClusterDiscovery(swarmOptions *swarm.SwarmOptions) error {
+	if swarmOptions.Cluster == "" {
+		return nil
+	}
+
+	members, err := m.ClusterMembers(swarmOptions.Cluster)
+	if err != nil {
+		return err
+	}
+
+	if swarmOptions.KVStore != "" {
+		if len(members) > 0 {
+			return fmt.Errorf("cluster %s already exists; only its first machine can run the KV store", swarmOptions.Cluster)
+		}
+		return nil
+	}
+
+	if swarmOptions.Discovery != "" {
+		return nil
+	}
+
+	addrs := []string{}
+	for _, member := range members {
+		discovery := member.HostOptions.SwarmOptions.Discovery
+		if discovery == "" {
+			continue
+		}
+
+		if !swarm.IsNodesDiscovery(discovery) {
+			log.Debugf("using the discovery of %s: %s", member.Name, discovery)
+			swarmOptions.Discovery = discovery
+			return nil
+		}
+
+		addr, err := member.dockerAddress()
+		if err != nil {
+			return fmt.Errorf("error getting the address of %s: %s", member.Name, err)
+		}
+		addrs = append(addrs, addr)
+	}
+
+	if swarmOptions.Replication {
+		return fmt.Errorf("cluster %s has no KV store, which swarm master replication needs", swarmOptions.Cluster)
+	}
+
+	swarmOptions.Discovery = swarm.NodesDiscovery(addrs)
+	return nil
+}
+
+// updateClusterNodes gives the other members of a cluster with a static
+// node list the list including h, and restarts their masters with it
+func (m *Machine) updateClusterNodes(h *Host) error {
+	swarmOptions := h.HostOptions.SwarmOptions
+	if swarmOptions.Cluster == "" || !swarm.IsNodesDiscovery(swarmOptions.Discovery) {
+		return nil
+	}
+
+	return m.updateClusterDiscovery(swarmOptions.Cluster, swarmOptions.Discovery, h.Name)
+}
+
+// updateClusterDiscovery sets the discovery of the members of a cluster
+// other than except, and restarts their masters with it
+func (m *Machine) updateClusterDiscovery(cluster, discovery, except string) error {
+	members, err := m.ClusterMembers(cluster)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if member.Name == except {
+			continue
+		}
+
+		member.HostOptions.SwarmOptions.Discovery = discovery
+		if err := member.SaveConfig(); err != nil {
+			return err
+		}
+
+		if member.HostOptions.SwarmOptions.Master {
+			log.Infof("Updating the nodes of the swarm master %s...", member.Name)
+			if err := member.ConfigureSwarm(); err != nil {
+				log.Warnf("Unable to restart the swarm master %s: %s", member.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SwarmMembers returns the machines in the same swarm as h, including h:
+// those in its named cluster, or with the same discovery
+func (m *Machine) SwarmMembers(h *Host) ([]*Host, error) {
+	swarmOptions := h.HostOptions.SwarmOptions
+	if swarmOptions == nil || !swarmOptions.IsSwarm {
+		return nil, fmt.Errorf("%s is not in a swarm", h.Name)
+	}
+
+	if swarmOptions.Cluster != "" {
+		return m.ClusterMembers(swarmOptions.Cluster)
+	}
+
+	hosts, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	members := []*Host{}
+	for _, member := range hosts {
+		if member.HostOptions == nil || member.HostOptions.SwarmOptions == nil {
+			continue
+		}
+		if member.HostOptions.SwarmOptions.IsSwarm && member.HostOptions.SwarmOptions.Discovery == swarmOptions.Discovery {
+			members = append(members, member)
+		}
+	}
+
+	return members, nil
+}
+
+// AddToSwarm adds a provisioned machine to a swarm, finding the discovery
+// of a named cluster as create does
+func (m *Machine) AddToSwarm(h *Host, swarmOptions swarm.SwarmOptions) error {
+	if h.HostOptions.SwarmOptions != nil && h.HostOptions.SwarmOptions.IsSwarm {
+		return fmt.Errorf("%s is already in a swarm; remove it first", h.Name)
+	}
+
+	if h.HostOptions.EngineOptions.DisableTCP {
+		return fmt.Errorf("swarm requires the daemon's TCP socket, which is disabled on %s", h.Name)
+	}
+
+	swarmOptions.IsSwarm = true
+	if err := swarmOptions.Validate(); err != nil {
+		return err
+	}
+
+	if swarmOptions.KVStore != "" {
+		return fmt.Errorf("a KV store can only be set up when the cluster's first machine is created")
+	}
+
+	if swarmOptions.Host == "" {
+		swarmOptions.Host = swarm.DefaultHost
+	}
+
+	if err := m.resolveClusterDiscovery(&swarmOptions); err != nil {
+		return err
+	}
+
+	if swarmOptions.Discovery == "" {
+		return fmt.Errorf("a discovery or cluster name is needed to add %s to a swarm", h.Name)
+	}
+
+	h.HostOptions.SwarmOptions = &swarmOptions
+	if err := h.setClusterDiscovery(); err != nil {
+		return err
+	}
+
+	clusterStore := h.HostOptions.EngineOptions.ClusterStore
+	if err := h.setClusterEngineOptions(); err != nil {
+		return err
+	}
+
+	if err := h.SaveConfig(); err != nil {
+		return err
+	}
+
+	// the daemon is restarted with the cluster store by reconfiguring it
+	if h.HostOptions.EngineOptions.ClusterStore != clusterStore {
+		log.Infof("Restarting the Docker daemon of %s with the cluster store...", h.Name)
+		if err := h.ConfigureAuth(); err != nil {
+			return err
+		}
+	}
+
+	if err := h.JoinSwarm(); err != nil {
+		return err
+	}
+
+	return m.updateClusterNodes(h)
+}
+
+// RemoveFromSwarm removes the swarm containers of a machine and takes it
+// out of its cluster's node list.  The machine is removed from the swarm
+// even if it cannot be reached.
+func (m *Machine) RemoveFromSwarm(h *Host) error {
+	swarmOptions := *h.HostOptions.SwarmOptions
+	if !swarmOptions.IsSwarm {
+		return fmt.Errorf("%s is not in a swarm", h.Name)
+	}
+
+	if err := h.LeaveSwarm(); err != nil {
+		log.Warnf("Unable to remove the swarm containers of %s: %s", h.Name, err)
+	}
+
+	addr, addrErr := h.dockerAddress()
+
+	h.HostOptions.SwarmOptions.IsSwarm = false
+	h.HostOptions.SwarmOptions.Master = false
+	h.HostOptions.SwarmOptions.Discovery = ""
+	h.HostOptions.SwarmOptions.Cluster = ""
+	if err := h.SaveConfig(); err != nil {
+		return err
+	}
+
+	if swarmOptions.Cluster == "" || !swarm.IsNodesDiscovery(swarmOptions.Discovery) {
+		return nil
+	}
+
+	if addrErr != nil {
+		return fmt.Errorf("error getting the address of %s to remove from the node list: %s", h.Name, addrErr)
+	}
+
+	addrs := []string{}
+	for _, a := range strings.Split(strings.TrimPrefix(swarmOptions.Discovery, "nodes://"), ",") {
+		if a != "" && a != addr {
+			addrs = append(addrs, a)
+		}
+	}
+
+	return m.updateClusterDiscovery(swarmOptions.Cluster, swarm.NodesDiscovery(addrs), h.Name)
+}
+
+// PromoteSwarmMaster makes h the master of its swarm, e.g. after the master
+// died, and demotes the other masters.  In a swarm with replicated masters
+// h becomes another replica instead.
+func (m *Machine) PromoteSwarmMaster(h *Host) error {
+	swarmOptions := h.HostOptions.SwarmOptions
+	if !swarmOptions.IsSwarm {
+		return fmt.Errorf("%s is not in a swarm", h.Name)
+	}
+
+	if swarmOptions.Master {
+		return fmt.Errorf("%s is already a swarm master", h.Name)
+	}
+
+	members, err := m.SwarmMembers(h)
+	if err != nil {
+		return err
+	}
+
+	// a swarm with replicated masters gains a replica
+	for _, member := range members {
+		if member.HostOptions.SwarmOptions.Master && member.HostOptions.SwarmOptions.Replication {
+			swarmOptions.Replication = true
+		}
+	}
+
+	swarmOptions.Master = true
+	if swarmOptions.Host == "" {
+		swarmOptions.Host = swarm.DefaultHost
+	}
+
+	if err := h.authorizeSwarmPort(); err != nil {
+		return err
+	}
+
+	if err := h.ConfigureSwarm(); err != nil {
+		return err
+	}
+
+	if err := h.SaveConfig(); err != nil {
+		return err
+	}
+
+	if swarmOptions.Replication {
+		return nil
+	}
+
+	for _, member := range members {
+		if member.Name == h.Name || !member.HostOptions.SwarmOptions.Master {
+			continue
+		}
+
+		log.Infof("Demoting the swarm master %s...", member.Name)
+		member.HostOptions.SwarmOptions.Master = false
+		if err := member.SaveConfig(); err != nil {
+			return err
+		}
+
+		if err := member.ConfigureSwarm(); err != nil {
+			log.Warnf("Unable to stop the swarm master container of %s: %s", member.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// SwarmMaster returns a healthy master of the swarm h is in: h itself if it
+// is a master which answers, or else the first of the others which does.
+// A swarm's only master is returned without asking it.
+func (m *Machine) SwarmMaster(h *Host) (*Host, error) {
+	members, err := m.SwarmMembers(h)
+	if err != nil {
+		return nil, err
+	}
+
+	masters := []*Host{}
+	if h.HostOptions.SwarmOptions.Master {
+		masters = append(masters, h)
+	}
+	for _, member := range members {
+		if member.Name != h.Name && member.HostOptions.SwarmOptions.Master {
+			masters = append(masters, member)
+		}
+	}
+
+	switch len(masters) {
+	case 0:
+		return nil, fmt.Errorf("the swarm of %s has no master", h.Name)
+	case 1:
+		// there is no other master to fall back to
+		return masters[0], nil
+	}
+
+	for _, master := range masters {
+		role, err := master.GetSwarmRole()
+		if err != nil {
+			log.Debugf("the swarm master %s is unhealthy: %s", master.Name, err)
+			continue
+		}
+
+		log.Debugf("the swarm master %s is the %s", master.Name, role)
+		return master, nil
+	}
+
+	return nil, fmt.Errorf("none of the swarm masters of %s answers", h.Name)
+}
+
+// getSwarmRole requests the info of the swarm master at addr
+func getSwarmRole(addr, caCertPath, clientCertPath, clientKeyPath string) (string, error) {
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		return "", err
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caCert) {
+		return "", fmt.Errorf("no certificates found in %s", caCertPath)
+	}
+
+	keypair, err := tls.LoadX509KeyPair(clientCertPath, clientKeyPath)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{
+		Timeout: time.Second * 5,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				Certificates: []tls.Certificate{keypair},
+				RootCAs:      caPool,
+			},
+		},
+	}
+
+	resp, err := client.Get(fmt.Sprintf("https://%s/info", addr))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from %s: %s", addr, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return parseSwarmRole(body)
+}
+
+// parseSwarmRole returns the role in the driver status of a swarm master's
+// info; a master without replicas reports none and is the primary
+func parseSwarmRole(body []byte) (string, error) {
+	var info struct {
+		DriverStatus [][2]string
+	}
+
+	if err := json.Unmarshal(body, &info); err != nil {
+		return "", err
+	}
+
+	for _, status := range info.DriverStatus {
+		// swarm indents the keys of its status with backspaces
+		if strings.Trim(status[0], "\b ") == "Role" {
+			return status[1], nil
+		}
+	}
+
+	return "primary", nil
+}
+
+// setClusterDiscovery completes the discovery of a machine in a named
+// cluster once it has an IP: the URL of the KV store it runs, or the
+// static node list with its own daemon added
+func (h *Host) setClusterDiscovery() error {
+	swarmOptions := h.HostOptions.SwarmOptions
+	if !swarmOptions.IsSwarm || swarmOptions.Cluster == "" {
+		return nil
+	}
+
+	if swarmOptions.KVStore != "" {
+		ip, err := swarm.KVStoreIP(h.Driver)
+		if err != nil {
+			return err
+		}
+
+		discovery, err := swarm.KVStoreDiscovery(swarmOptions.KVStore, ip, swarmOptions.Cluster)
+		if err != nil {
+			return err
+		}
+
+		swarmOptions.Discovery = discovery
+		return h.SaveConfig()
+	}
+
+	if !swarm.IsNodesDiscovery(swarmOptions.Discovery) {
+		return nil
+	}
+
+	addr, err := h.dockerAddress()
+	if err != nil {
+		return err
+	}
+
+	nodes := strings.TrimPrefix(swarmOptions.Discovery, "nodes://")
+	addrs := []string{}
+	if nodes != "" {
+		addrs = strings.Split(nodes, ",")
+	}
+	for _, a := range addrs {
+		if a == addr {
+			return nil
+		}
+	}
+
+	swarmOptions.Discovery = swarm.NodesDiscovery(append(addrs, addr))
+	return h.SaveConfig()
+}
+
+// setClusterEngineOptions points the daemon of a machine in a named cluster
+// with a KV store at the store, advertising its private IP if it has one,
+// so overlay networks span the cluster.  Options given with --engine-opt
+// are left alone.
+func (h *Host) setClusterEngineOptions() error {
+	swarmOptions := h.HostOptions.SwarmOptions
+	engineOptions := h.HostOptions.EngineOptions
+	if !swarmOptions.IsSwarm || swarmOptions.Cluster == "" || !swarm.IsKVDiscovery(swarmOptions.Discovery) {
+		return nil
+	}
+
+	for _, flag := range engineOptions.ArbitraryFlags {
+		if strings.HasPrefix(flag, "cluster-store") || strings.HasPrefix(flag, "cluster-advertise") {
+			return nil
+		}
+	}
+
+	clusterStore, err := swarm.ClusterStore(swarmOptions.Discovery)
+	if err != nil {
+		return err
+	}
+
+	addr, err := h.dockerAddress()
+	if err != nil {
+		return err
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	if privateIPDriver, ok := h.Driver.(drivers.PrivateIPDriver); ok {
+		privateIP, err := privateIPDriver.GetPrivateIP()
+		if err != nil {
+			return err
+		}
+		if privateIP != "" {
+			host = privateIP
+		}
+	}
+
+	engineOptions.ClusterStore = clusterStore
+	engineOptions.ClusterAdvertise = net.JoinHostPort(host, port)
+	return h.SaveConfig()
+}
+
+// dockerAddress returns the host:port of the machine's daemon
+func (h *Host) dockerAddress() (string, error) {
+	dockerURL, err := h.GetURL()
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(dockerURL)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "tcp" {
+		return "", fmt.Errorf("the daemon of %s is not reachable over TCP", h.Name)
+	}
+
+	return u.Host, nil
+}
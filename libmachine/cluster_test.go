@@ -0,0 +1,570 @@
+package libmachine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision"
+	"github.com/docker/machine/libmachine/swarm"
+	"github.com/docker/machine/ssh"
+)
+
+// fakeProvisioner records the SSH commands run on the machines of a test,
+// by the URL of their daemons
+type fakeProvisioner struct {
+	provision.Provisioner
+	driver        drivers.Driver
+	authOptions   auth.AuthOptions
+	engineOptions engine.EngineOptions
+}
+
+var sshCommands map[string][]string
+
+func init() {
+	detectProvisioner = func(d drivers.Driver) (provision.Provisioner, error) {
+		return &fakeProvisioner{driver: d}, nil
+	}
+}
+
+func (p *fakeProvisioner) GetDriver() drivers.Driver {
+	return p.driver
+}
+
+func (p *fakeProvisioner) GetDockerOptionsDir() string {
+	return "/etc/docker"
+}
+
+func (p *fakeProvisioner) GetAuthOptions() auth.AuthOptions {
+	return p.authOptions
+}
+
+func (p *fakeProvisioner) SetAuthOptions(authOptions auth.AuthOptions) {
+	p.authOptions = authOptions
+}
+
+func (p *fakeProvisioner) GetEngineOptions() engine.EngineOptions {
+	return p.engineOptions
+}
+
+func (p *fakeProvisioner) SetEngineOptions(engineOptions engine.EngineOptions) {
+	p.engineOptions = engineOptions
+}
+
+func (p *fakeProvisioner) SSHCommand(args string) (ssh.Output, error) {
+	url, err := p.driver.GetURL()
+	if err != nil {
+		return ssh.Output{}, err
+	}
+	sshCommands[url] = append(sshCommands[url], args)
+	return ssh.Output{Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}, nil
+}
+
+// ranCommand reports whether a command containing s was run on a machine
+func ranCommand(url, s string) bool {
+	for _, command := range sshCommands[url] {
+		if strings.Contains(command, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func getTestClusterHost(name, url string, swarmOptions swarm.SwarmOptions) (*Host, error) {
+	hostOptions := &HostOptions{
+		EngineOptions: &engine.EngineOptions{},
+		SwarmOptions:  &swarmOptions,
+		AuthOptions:   &auth.AuthOptions{},
+	}
+
+	host, err := NewHost(name, hostTestDriverName, hostOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := getTestDriverFlags()
+	flags.Data["url"] = url
+	if err := host.Driver.SetConfigFromFlags(flags); err != nil {
+		return nil, err
+	}
+
+	return host, nil
+}
+
+func TestResolveClusterDiscovery(t *testing.T) {
+	defer cleanup()
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, url := range map[string]string{"a": "tcp://10.0.0.1:2376", "b": "tcp://10.0.0.2:2376"} {
+		host, err := getTestClusterHost(name, url, swarm.SwarmOptions{
+			IsSwarm:   true,
+			Cluster:   "test",
+			Discovery: "nodes://10.0.0.1:2376,10.0.0.2:2376",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Save(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	swarmOptions := &swarm.SwarmOptions{IsSwarm: true, Cluster: "test"}
+	if err := m.resolveClusterDiscovery(swarmOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "nodes://10.0.0.1:2376,10.0.0.2:2376"
+	if swarmOptions.Discovery != expected {
+		t.Fatalf("expected %s; received %s", expected, swarmOptions.Discovery)
+	}
+
+	host, err := getTestClusterHost("c", "tcp://10.0.0.3:2376", *swarmOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host.StorePath = store.GetPath()
+	if err := host.setClusterDiscovery(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "nodes://10.0.0.1:2376,10.0.0.2:2376,10.0.0.3:2376"
+	if host.HostOptions.SwarmOptions.Discovery != expected {
+		t.Fatalf("expected %s; received %s", expected, host.HostOptions.SwarmOptions.Discovery)
+	}
+
+	if err := m.resolveClusterDiscovery(&swarm.SwarmOptions{IsSwarm: true, Cluster: "test", KVStore: "consul"}); err == nil {
+		t.Fatal("expected an error running a KV store for an existing cluster")
+	}
+
+	swarmOptions = &swarm.SwarmOptions{IsSwarm: true, Cluster: "other"}
+	if err := m.resolveClusterDiscovery(swarmOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	if swarmOptions.Discovery != "nodes://" {
+		t.Fatalf("expected an empty node list for a new cluster; received %s", swarmOptions.Discovery)
+	}
+}
+
+func TestResolveClusterDiscoveryKVStore(t *testing.T) {
+	defer cleanup()
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := getTestClusterHost("kv", "tcp://10.0.0.1:2376", swarm.SwarmOptions{
+		IsSwarm:   true,
+		Cluster:   "test",
+		KVStore:   "consul",
+		Discovery: "consul://10.0.0.1:8500/test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(host); err != nil {
+		t.Fatal(err)
+	}
+
+	swarmOptions := &swarm.SwarmOptions{IsSwarm: true, Cluster: "test"}
+	if err := m.resolveClusterDiscovery(swarmOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	if swarmOptions.Discovery != "consul://10.0.0.1:8500/test" {
+		t.Fatalf("expected the KV store's discovery; received %s", swarmOptions.Discovery)
+	}
+}
+
+func TestParseSwarmRole(t *testing.T) {
+	for body, expected := range map[string]string{
+		`{"DriverStatus":[["\bRole","replica"],["\bPrimary","10.0.0.1:3376"],["\bStrategy","spread"]]}`: "replica",
+		`{"DriverStatus":[["Role","primary"]]}`:                                                         "primary",
+		`{"DriverStatus":[["\bStrategy","spread"],["\bNodes","2"]]}`:                                    "primary",
+	} {
+		role, err := parseSwarmRole([]byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if role != expected {
+			t.Fatalf("expected role %s for %s; received %s", expected, body, role)
+		}
+	}
+
+	if _, err := parseSwarmRole([]byte("not json")); err == nil {
+		t.Fatal("expected an error parsing invalid info")
+	}
+}
+
+func TestSwarmMaster(t *testing.T) {
+	defer cleanup()
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discovery := "consul://10.0.0.1:8500/test"
+	master, err := getTestClusterHost("master", "tcp://10.0.0.1:2376", swarm.SwarmOptions{
+		IsSwarm:   true,
+		Master:    true,
+		Host:      "tcp://0.0.0.0:3376",
+		Discovery: discovery,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := getTestClusterHost("node", "tcp://10.0.0.2:2376", swarm.SwarmOptions{
+		IsSwarm:   true,
+		Discovery: discovery,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.SwarmMaster(node); err == nil {
+		t.Fatal("expected an error for a swarm without a master")
+	}
+
+	for _, host := range []*Host{master, node} {
+		if err := store.Save(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := m.SwarmMaster(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.Name != "master" {
+		t.Fatalf("expected the master; received %s", found.Name)
+	}
+
+	swarmURL, err := found.GetSwarmURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if swarmURL != "tcp://10.0.0.1:3376" {
+		t.Fatalf("expected tcp://10.0.0.1:3376; received %s", swarmURL)
+	}
+}
+
+func TestSetClusterEngineOptions(t *testing.T) {
+	defer cleanup()
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := getTestClusterHost("node", "tcp://10.0.0.2:2376", swarm.SwarmOptions{
+		IsSwarm:   true,
+		Cluster:   "test",
+		Discovery: "consul://10.0.0.1:8500/test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	host.StorePath = store.GetPath()
+
+	if err := host.setClusterEngineOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	engineOptions := host.HostOptions.EngineOptions
+	if engineOptions.ClusterStore != "consul://10.0.0.1:8500" {
+		t.Fatalf("expected cluster store consul://10.0.0.1:8500; received %s", engineOptions.ClusterStore)
+	}
+
+	if engineOptions.ClusterAdvertise != "10.0.0.2:2376" {
+		t.Fatalf("expected cluster advertise 10.0.0.2:2376; received %s", engineOptions.ClusterAdvertise)
+	}
+
+	host.HostOptions.EngineOptions = &engine.EngineOptions{
+		ArbitraryFlags: []string{"cluster-store=etcd://10.0.0.9:2379"},
+	}
+	if err := host.setClusterEngineOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	if host.HostOptions.EngineOptions.ClusterStore != "" {
+		t.Fatalf("expected a cluster store given with --engine-opt to be kept; received %s", host.HostOptions.EngineOptions.ClusterStore)
+	}
+}
+
+func TestAddToSwarm(t *testing.T) {
+	defer cleanup()
+	sshCommands = map[string][]string{}
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	master, err := getTestClusterHost("master", "tcp://10.0.0.1:2376", swarm.SwarmOptions{
+		IsSwarm:   true,
+		Master:    true,
+		Cluster:   "test",
+		Discovery: "nodes://10.0.0.1:2376",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := getTestClusterHost("node", "tcp://10.0.0.2:2376", swarm.SwarmOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []*Host{master, node} {
+		if err := store.Save(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.AddToSwarm(node, swarm.SwarmOptions{Cluster: "test", KVStore: "consul"}); err == nil {
+		t.Fatal("expected an error setting up a KV store for an existing cluster")
+	}
+
+	if err := m.AddToSwarm(node, swarm.SwarmOptions{}); err == nil {
+		t.Fatal("expected an error adding a machine without a discovery")
+	}
+
+	if err := m.AddToSwarm(node, swarm.SwarmOptions{Cluster: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ranCommand("tcp://10.0.0.2:2376", "docker pull swarm") {
+		t.Fatalf("expected the swarm image to be pulled on node; ran %v", sshCommands["tcp://10.0.0.2:2376"])
+	}
+
+	expected := "nodes://10.0.0.1:2376,10.0.0.2:2376"
+	for _, name := range []string{"master", "node"} {
+		host, err := store.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if host.HostOptions.SwarmOptions.Discovery != expected {
+			t.Fatalf("expected %s to have discovery %s; received %s", name, expected, host.HostOptions.SwarmOptions.Discovery)
+		}
+	}
+
+	if !ranCommand("tcp://10.0.0.1:2376", "--name swarm-agent-master ") {
+		t.Fatalf("expected the swarm master to be restarted with the new node; ran %v", sshCommands["tcp://10.0.0.1:2376"])
+	}
+
+	if err := m.AddToSwarm(node, swarm.SwarmOptions{Cluster: "test"}); err == nil {
+		t.Fatal("expected an error adding a machine which is already in a swarm")
+	}
+}
+
+func TestAddToSwarmImageArchive(t *testing.T) {
+	defer cleanup()
+	sshCommands = map[string][]string{}
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := getTestClusterHost("node", "tcp://10.0.0.2:2376", swarm.SwarmOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Save(node); err != nil {
+		t.Fatal(err)
+	}
+
+	swarmOptions := swarm.SwarmOptions{
+		Discovery:    "token://1234",
+		ImageArchive: "/nonexistent/swarm.tar",
+	}
+
+	if err := m.AddToSwarm(node, swarmOptions); err == nil {
+		t.Fatal("expected an error joining with a missing image archive")
+	}
+
+	if ranCommand("tcp://10.0.0.2:2376", "docker rm -f") {
+		t.Fatalf("expected the swarm containers to be kept; ran %v", sshCommands["tcp://10.0.0.2:2376"])
+	}
+
+	if node.HostOptions.SwarmOptions.ImageArchive != swarmOptions.ImageArchive {
+		t.Fatalf("expected the image archive to be kept; received %q", node.HostOptions.SwarmOptions.ImageArchive)
+	}
+}
+
+func TestRemoveFromSwarm(t *testing.T) {
+	defer cleanup()
+	sshCommands = map[string][]string{}
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discovery := "nodes://10.0.0.1:2376,10.0.0.2:2376"
+	master, err := getTestClusterHost("master", "tcp://10.0.0.1:2376", swarm.SwarmOptions{
+		IsSwarm:   true,
+		Master:    true,
+		Cluster:   "test",
+		Discovery: discovery,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := getTestClusterHost("node", "tcp://10.0.0.2:2376", swarm.SwarmOptions{
+		IsSwarm:   true,
+		Cluster:   "test",
+		Discovery: discovery,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []*Host{master, node} {
+		if err := store.Save(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.RemoveFromSwarm(node); err != nil {
+		t.Fatal(err)
+	}
+
+	node, err = store.Get("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	swarmOptions := node.HostOptions.SwarmOptions
+	if swarmOptions.IsSwarm || swarmOptions.Cluster != "" || swarmOptions.Discovery != "" {
+		t.Fatalf("expected node to be out of the swarm; received %+v", swarmOptions)
+	}
+
+	master, err = store.Get("master")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if master.HostOptions.SwarmOptions.Discovery != "nodes://10.0.0.1:2376" {
+		t.Fatalf("expected node to be removed from the node list; received %s", master.HostOptions.SwarmOptions.Discovery)
+	}
+
+	if err := m.RemoveFromSwarm(node); err == nil {
+		t.Fatal("expected an error removing a machine which is not in a swarm")
+	}
+}
+
+func TestPromoteSwarmMaster(t *testing.T) {
+	defer cleanup()
+	sshCommands = map[string][]string{}
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discovery := "consul://10.0.0.1:8500/test"
+	master, err := getTestClusterHost("master", "tcp://10.0.0.1:2376", swarm.SwarmOptions{
+		IsSwarm:   true,
+		Master:    true,
+		Cluster:   "test",
+		Discovery: discovery,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := getTestClusterHost("node", "tcp://10.0.0.2:2376", swarm.SwarmOptions{
+		IsSwarm:   true,
+		Cluster:   "test",
+		Discovery: discovery,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []*Host{master, node} {
+		if err := store.Save(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.PromoteSwarmMaster(master); err == nil {
+		t.Fatal("expected an error promoting a swarm master")
+	}
+
+	if err := m.PromoteSwarmMaster(node); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ranCommand("tcp://10.0.0.2:2376", "--name swarm-agent-master ") {
+		t.Fatalf("expected the swarm master to be started on node; ran %v", sshCommands["tcp://10.0.0.2:2376"])
+	}
+
+	for name, isMaster := range map[string]bool{"master": false, "node": true} {
+		host, err := store.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if host.HostOptions.SwarmOptions.Master != isMaster {
+			t.Fatalf("expected %s to have master %t", name, isMaster)
+		}
+	}
+
+	if ranCommand("tcp://10.0.0.1:2376", "--name swarm-agent-master ") {
+		t.Fatalf("expected the old master to only run the swarm agent; ran %v", sshCommands["tcp://10.0.0.1:2376"])
+	}
+}
@@ -1,18 +1,133 @@
 package engine
 
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/docker/machine/drivers"
+)
+
+const (
+	// DefaultInstallURL is the script used to install Docker on hosts
+	// which do not ship with it
+	DefaultInstallURL = "https://get.docker.com"
+
+	// DefaultPort is the port the daemon listens on for TLS connections
+	DefaultPort = 2376
+
+	// BindPrivate binds the daemon to the machine's private IP
+	BindPrivate = "private"
+)
+
+var envKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 type EngineOptions struct {
 	ArbitraryFlags   []string
 	Dns              []string
 	GraphDir         string
+	Env              []string
+	InstallURL       string
 	Ipv6             bool
 	InsecureRegistry []string
 	Labels           []string
 	LogLevel         string
 	StorageDriver    string
 	SelinuxEnabled   bool
-	TlsCaCert        string
-	TlsCert          string
-	TlsKey           string
-	TlsVerify        bool
 	RegistryMirror   []string
+
+	// InstallPackage is a local Docker package (.deb) or static binary
+	// which is uploaded and installed instead of downloading Docker
+	InstallPackage string
+
+	// Version pins the Docker version to install; empty means the
+	// latest version available from InstallURL
+	Version string
+
+	// InstalledVersion is the Docker version found on the host after
+	// it was last provisioned or upgraded
+	InstalledVersion string
+
+	// BindAddress is the address the daemon listens on for TCP
+	// connections: an IP, or BindPrivate.  Empty means all interfaces.
+	BindAddress string
+
+	// Port is the daemon's TCP port; 0 means the driver's default
+	Port int
+
+	// DisableTCP turns the daemon's TCP socket off, leaving only its unix
+	// socket, which is forwarded over SSH
+	DisableTCP bool
+
+	// ClusterStore and ClusterAdvertise are the daemon's --cluster-store
+	// and --cluster-advertise, for overlay networks across a cluster
+	ClusterStore     string
+	ClusterAdvertise string
+
+	// DisableDriverLabels leaves out the labels describing the host which
+	// drivers implementing drivers.EngineLabelDriver supply
+	DisableDriverLabels bool
+}
+
+// GetInstallURL returns the install URL, falling back to the default for
+// hosts created before it was configurable
+func (e EngineOptions) GetInstallURL() string {
+	if e.InstallURL == "" {
+		return DefaultInstallURL
+	}
+	return e.InstallURL
+}
+
+// Validate checks the daemon's listen options are consistent and its
+// environment variables are KEY=value with a valid shell identifier as key
+func (e EngineOptions) Validate() error {
+	for _, env := range e.Env {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || !envKeyRegexp.MatchString(parts[0]) {
+			return fmt.Errorf("invalid engine environment variable %q: expected KEY=value", env)
+		}
+	}
+
+	if e.DisableTCP && (e.BindAddress != "" || e.Port != 0) {
+		return fmt.Errorf("a bind address or port cannot be set when TCP is disabled")
+	}
+
+	if e.Port < 0 || e.Port > 65535 {
+		return fmt.Errorf("invalid port %d", e.Port)
+	}
+
+	return nil
+}
+
+// GetBindAddress returns the address the daemon's TCP socket binds to,
+// resolving BindPrivate to the machine's private IP
+func (e EngineOptions) GetBindAddress(d drivers.Driver) (string, error) {
+	switch e.BindAddress {
+	case "":
+		return "0.0.0.0", nil
+	case BindPrivate:
+		privateIPDriver, ok := d.(drivers.PrivateIPDriver)
+		if !ok {
+			return "", fmt.Errorf("the %s driver does not support binding the daemon to a private IP", d.DriverName())
+		}
+
+		ip, err := privateIPDriver.GetPrivateIP()
+		if err != nil {
+			return "", err
+		}
+
+		if ip == "" {
+			return "", fmt.Errorf("the machine has no private IP to bind the daemon to")
+		}
+
+		return ip, nil
+	}
+
+	return e.BindAddress, nil
+}
+
+// BindsAllInterfaces reports whether the daemon's TCP socket listens on
+// all interfaces, i.e. on the IP the driver reports
+func (e EngineOptions) BindsAllInterfaces() bool {
+	return e.BindAddress == "" || e.BindAddress == "0.0.0.0" || e.BindAddress == "::"
 }
@@ -1 +1,70 @@
 package engine
+
+import (
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+)
+
+type privateIPDriver struct {
+	fakedriver.FakeDriver
+	privateIP string
+}
+
+func (d *privateIPDriver) GetPrivateIP() (string, error) {
+	return d.privateIP, nil
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		options EngineOptions
+		valid   bool
+	}{
+		{EngineOptions{}, true},
+		{EngineOptions{BindAddress: "10.0.0.1", Port: 2377}, true},
+		{EngineOptions{DisableTCP: true}, true},
+		{EngineOptions{DisableTCP: true, Port: 2377}, false},
+		{EngineOptions{DisableTCP: true, BindAddress: BindPrivate}, false},
+		{EngineOptions{Port: 70000}, false},
+		{EngineOptions{Env: []string{"HTTP_PROXY=http://proxy.local:3128", "EMPTY="}}, true},
+		{EngineOptions{Env: []string{"NO_VALUE"}}, false},
+		{EngineOptions{Env: []string{"1ST=a"}}, false},
+		{EngineOptions{Env: []string{"A;reboot=a"}}, false},
+	} {
+		if err := c.options.Validate(); (err == nil) != c.valid {
+			t.Fatalf("expected %+v to be valid: %t; received %v", c.options, c.valid, err)
+		}
+	}
+}
+
+func TestGetBindAddress(t *testing.T) {
+	d := &privateIPDriver{privateIP: "10.0.0.1"}
+
+	for _, c := range []struct {
+		bindAddress string
+		expected    string
+	}{
+		{"", "0.0.0.0"},
+		{"192.168.0.1", "192.168.0.1"},
+		{BindPrivate, "10.0.0.1"},
+	} {
+		address, err := EngineOptions{BindAddress: c.bindAddress}.GetBindAddress(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if address != c.expected {
+			t.Fatalf("expected %q for %q; received %q", c.expected, c.bindAddress, address)
+		}
+	}
+}
+
+func TestGetBindAddressPrivateUnsupported(t *testing.T) {
+	if _, err := (EngineOptions{BindAddress: BindPrivate}).GetBindAddress(&fakedriver.FakeDriver{}); err == nil {
+		t.Fatal("expected an error for a driver without a private IP")
+	}
+
+	if _, err := (EngineOptions{BindAddress: BindPrivate}).GetBindAddress(&privateIPDriver{}); err == nil {
+		t.Fatal("expected an error for a machine without a private IP")
+	}
+}
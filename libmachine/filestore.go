@@ -61,7 +61,7 @@ func (s Filestore) Save(host *Host) error {
 		return err
 	}
 
-	if err := ioutil.WriteFile(filepath.Join(hostPath, "config.json"), data, 0600); err != nil {
+	if err := utils.WriteSecretFile(filepath.Join(hostPath, "config.json"), data, 0600); err != nil {
 		return err
 	}
 
@@ -69,6 +69,17 @@ func (s Filestore) Save(host *Host) error {
 }
 
 func (s Filestore) Remove(name string, force bool) error {
+	active, err := s.GetActiveName()
+	if err != nil {
+		return err
+	}
+
+	if active == name {
+		if err := s.SetActive(nil); err != nil {
+			return err
+		}
+	}
+
 	hostPath := filepath.Join(utils.GetMachineDir(), name)
 	return os.RemoveAll(hostPath)
 }
@@ -111,17 +122,61 @@ func (s Filestore) Get(name string) (*Host, error) {
 	return s.loadHost(name)
 }
 
+// activePath is the file recording the name of the active host; List
+// only loads directories
+func (s Filestore) activePath() string {
+	return filepath.Join(utils.GetMachineDir(), ".active")
+}
+
+func (s Filestore) GetActiveName() (string, error) {
+	data, err := ioutil.ReadFile(s.activePath())
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (s Filestore) SetActive(host *Host) error {
+	if host == nil {
+		if err := os.Remove(s.activePath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(utils.GetMachineDir(), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.activePath(), []byte(host.Name+"\n"), 0600)
+}
+
 func (s Filestore) GetActive() (*Host, error) {
+	name, err := s.GetActiveName()
+	if err != nil {
+		return nil, err
+	}
+
+	if name != "" {
+		host, err := s.Get(name)
+		if err == nil {
+			return host, nil
+		}
+		log.Debugf("error loading the active host %q: %s", name, err)
+	}
+
 	hosts, err := s.List()
 	if err != nil {
 		return nil, err
 	}
 
-	dockerHost := os.Getenv("DOCKER_HOST")
 	hostListItems := GetHostListItems(hosts)
 
 	for _, item := range hostListItems {
-		if dockerHost == item.URL {
+		if item.Active {
 			host, err := s.Get(item.Name)
 			if err != nil {
 				return nil, err
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	_ "github.com/docker/machine/drivers/none"
+	"github.com/docker/machine/libmachine/swarm"
 	"github.com/docker/machine/utils"
 )
 
@@ -228,3 +229,65 @@ func TestStoreGetSetActive(t *testing.T) {
 		t.Fatalf("Active host is not 'test', got %s", host.Name)
 	}
 }
+
+func TestStoreSetActive(t *testing.T) {
+	defer cleanup()
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+
+	store, err := getTestStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		host, err := getTestClusterHost(name, "tcp://10.0.0.1:2376", swarm.SwarmOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Save(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	os.Setenv("DOCKER_HOST", "tcp://10.0.0.1:2376")
+
+	b, err := store.Get("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetActive(b); err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := store.GetActive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if host.Name != "b" {
+		t.Fatalf("expected the recorded host b to be active; received %s", host.Name)
+	}
+
+	if err := store.Remove("b", false); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := store.GetActiveName()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "" {
+		t.Fatalf("expected removing the active host to clear it; received %s", name)
+	}
+
+	// DOCKER_HOST is the fallback
+	if host, err = store.GetActive(); err != nil {
+		t.Fatal(err)
+	}
+
+	if host.Name != "a" {
+		t.Fatalf("expected the host DOCKER_HOST points at to be active; received %s", host.Name)
+	}
+}
@@ -0,0 +1,133 @@
+package hooks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Phases of provisioning at which hooks can run
+const (
+	PreInstall = "pre-install" // before Docker is installed
+	PostAuth   = "post-auth"   // after TLS has been configured
+	PostSwarm  = "post-swarm"  // after Swarm has been configured
+)
+
+var Phases = []string{PreInstall, PostAuth, PostSwarm}
+
+type HookOptions struct {
+	Files   []File
+	Scripts []Script
+}
+
+// File is a local file uploaded to Destination on the host
+type File struct {
+	Phase       string
+	Source      string
+	Destination string
+}
+
+// Script is a local script uploaded to the host and run with sudo
+type Script struct {
+	Phase string
+	Path  string
+}
+
+func ValidatePhase(phase string) error {
+	for _, p := range Phases {
+		if phase == p {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown hook phase %q; expected one of %s", phase, strings.Join(Phases, ", "))
+}
+
+func splitPhase(s string) (string, string, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid hook %q; expected phase=value", s)
+	}
+
+	if err := ValidatePhase(parts[0]); err != nil {
+		return "", "", err
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// ParseScript parses a script hook in the form phase=path
+func ParseScript(s string) (Script, error) {
+	phase, path, err := splitPhase(s)
+	if err != nil {
+		return Script{}, err
+	}
+
+	return Script{
+		Phase: phase,
+		Path:  path,
+	}, nil
+}
+
+// ParseFile parses a file hook in the form phase=source:destination.
+// The destination is a path on the host so the last colon separates the
+// two, which allows Windows paths as the source.
+func ParseFile(s string) (File, error) {
+	phase, value, err := splitPhase(s)
+	if err != nil {
+		return File{}, err
+	}
+
+	i := strings.LastIndex(value, ":")
+	if i <= 0 || i == len(value)-1 {
+		return File{}, fmt.Errorf("invalid file hook %q; expected phase=source:destination", s)
+	}
+
+	return File{
+		Phase:       phase,
+		Source:      value[:i],
+		Destination: value[i+1:],
+	}, nil
+}
+
+// NewHookOptions parses the script and file hooks given on the command line
+func NewHookOptions(scripts []string, files []string) (*HookOptions, error) {
+	hookOptions := &HookOptions{}
+
+	for _, s := range scripts {
+		script, err := ParseScript(s)
+		if err != nil {
+			return nil, err
+		}
+		hookOptions.Scripts = append(hookOptions.Scripts, script)
+	}
+
+	for _, f := range files {
+		file, err := ParseFile(f)
+		if err != nil {
+			return nil, err
+		}
+		hookOptions.Files = append(hookOptions.Files, file)
+	}
+
+	return hookOptions, nil
+}
+
+// ForPhase returns the files and scripts to run at the given phase
+func (h HookOptions) ForPhase(phase string) ([]File, []Script) {
+	files := []File{}
+	scripts := []Script{}
+
+	for _, f := range h.Files {
+		if f.Phase == phase {
+			files = append(files, f)
+		}
+	}
+
+	for _, s := range h.Scripts {
+		if s.Phase == phase {
+			scripts = append(scripts, s)
+		}
+	}
+
+	return files, scripts
+}
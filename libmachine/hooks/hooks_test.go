@@ -0,0 +1,79 @@
+package hooks
+
+import (
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	script, err := ParseScript("post-auth=/tmp/setup.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if script.Phase != PostAuth {
+		t.Fatalf("expected phase %s; received %s", PostAuth, script.Phase)
+	}
+
+	if script.Path != "/tmp/setup.sh" {
+		t.Fatalf("expected path /tmp/setup.sh; received %s", script.Path)
+	}
+}
+
+func TestParseScriptInvalid(t *testing.T) {
+	for _, s := range []string{"/tmp/setup.sh", "post-auth=", "post-install=/tmp/setup.sh"} {
+		if _, err := ParseScript(s); err == nil {
+			t.Fatalf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	file, err := ParseFile(`pre-install=C:\certs\corp.crt:/usr/local/share/ca-certificates/corp.crt`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file.Phase != PreInstall {
+		t.Fatalf("expected phase %s; received %s", PreInstall, file.Phase)
+	}
+
+	if file.Source != `C:\certs\corp.crt` {
+		t.Fatalf("expected source C:\\certs\\corp.crt; received %s", file.Source)
+	}
+
+	if file.Destination != "/usr/local/share/ca-certificates/corp.crt" {
+		t.Fatalf("expected destination /usr/local/share/ca-certificates/corp.crt; received %s", file.Destination)
+	}
+}
+
+func TestParseFileInvalid(t *testing.T) {
+	for _, s := range []string{"pre-install=/tmp/corp.crt", "pre-install=/tmp/corp.crt:", "pre-install=:/tmp/corp.crt"} {
+		if _, err := ParseFile(s); err == nil {
+			t.Fatalf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestForPhase(t *testing.T) {
+	hookOptions, err := NewHookOptions(
+		[]string{"pre-install=/tmp/a.sh", "post-swarm=/tmp/b.sh", "pre-install=/tmp/c.sh"},
+		[]string{"post-swarm=/tmp/d:/etc/d"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, scripts := hookOptions.ForPhase(PreInstall)
+	if len(files) != 0 || len(scripts) != 2 {
+		t.Fatalf("expected 0 files and 2 scripts; received %d and %d", len(files), len(scripts))
+	}
+
+	if scripts[0].Path != "/tmp/a.sh" || scripts[1].Path != "/tmp/c.sh" {
+		t.Fatalf("expected scripts in the order given; received %v", scripts)
+	}
+
+	files, scripts = hookOptions.ForPhase(PostSwarm)
+	if len(files) != 1 || len(scripts) != 1 {
+		t.Fatalf("expected 1 file and 1 script; received %d and %d", len(files), len(scripts))
+	}
+}
@@ -4,14 +4,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/hooks"
 	"github.com/docker/machine/libmachine/provision"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/swarm"
@@ -25,6 +29,9 @@ var (
 	validHostNameChars                = `[a-zA-Z0-9\-\.]`
 	validHostNamePattern              = regexp.MustCompile(`^` + validHostNameChars + `+$`)
 	errMachineMustBeRunningForUpgrade = errors.New("Error: machine must be running to upgrade.")
+
+	// detectProvisioner is replaced in tests, which have no host to SSH to
+	detectProvisioner = provision.DetectProvisioner
 )
 
 type Host struct {
@@ -50,9 +57,11 @@ type HostOptions struct {
 	Driver        string
 	Memory        int
 	Disk          int
+	CloudInit     bool
 	EngineOptions *engine.EngineOptions
 	SwarmOptions  *swarm.SwarmOptions
 	AuthOptions   *auth.AuthOptions
+	HookOptions   *hooks.HookOptions
 }
 
 type HostMetadata struct {
@@ -67,12 +76,17 @@ type HostMetadata struct {
 }
 
 type HostListItem struct {
-	Name         string
-	Active       bool
-	DriverName   string
-	State        state.State
-	URL          string
-	SwarmOptions swarm.SwarmOptions
+	Name          string
+	Active        bool
+	DriverName    string
+	State         state.State
+	URL           string
+	DockerVersion string
+	CertExpiry    time.Time
+	SwarmOptions  swarm.SwarmOptions
+	// SwarmRole is the role of a replicated swarm master, primary or
+	// replica, if it could be asked
+	SwarmRole string
 }
 
 func NewHost(name, driverName string, hostOptions *HostOptions) (*Host, error) {
@@ -108,6 +122,12 @@ func ValidateHostName(name string) bool {
 }
 
 func (h *Host) Create(name string) error {
+	if h.HostOptions.CloudInit {
+		if err := h.setCloudInitUserData(); err != nil {
+			return err
+		}
+	}
+
 	// create the instance
 	if err := h.Driver.Create(); err != nil {
 		return err
@@ -118,25 +138,120 @@ func (h *Host) Create(name string) error {
 		return err
 	}
 
+	if err := h.authorizeDockerPort(); err != nil {
+		return err
+	}
+
+	if err := h.setClusterDiscovery(); err != nil {
+		return err
+	}
+
+	// cloud-init machines are given these options once their daemon is up
+	if err := h.setClusterEngineOptions(); err != nil {
+		return err
+	}
+
 	// TODO: Not really a fan of just checking "none" here.
 	if h.Driver.DriverName() != "none" {
 		if err := WaitForSSH(h); err != nil {
 			return err
 		}
 
-		provisioner, err := provision.DetectProvisioner(h.Driver)
+		provisioner, err := detectProvisioner(h.Driver)
 		if err != nil {
 			return err
 		}
 
-		if err := provisioner.Provision(*h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
-			return err
+		if h.HostOptions.CloudInit {
+			provisioner.SetEngineOptions(*h.HostOptions.EngineOptions)
+			if err := provision.CompleteCloudInit(provisioner, *h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, h.hookOptions()); err != nil {
+				return err
+			}
+		} else {
+			if err := provisioner.Provision(*h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions, h.hookOptions()); err != nil {
+				return err
+			}
 		}
+
+		return h.recordEngineVersion(provisioner)
+	}
+
+	return nil
+}
+
+// authorizeDockerPort opens the daemon's port in the driver's firewall if
+// it is not the default, which drivers open when the machine is created
+func (h *Host) authorizeDockerPort() error {
+	engineOptions := h.HostOptions.EngineOptions
+	if engineOptions.DisableTCP || engineOptions.Port == 0 || engineOptions.Port == engine.DefaultPort {
+		return nil
+	}
+
+	if err := h.Driver.AuthorizePort([]*drivers.Port{{Protocol: "tcp", Port: engineOptions.Port}}); err != nil {
+		return fmt.Errorf("error opening port %d: %s", engineOptions.Port, err)
 	}
 
 	return nil
 }
 
+// recordEngineVersion saves the version of Docker found on the host so it
+// can be shown without connecting to the daemon
+func (h *Host) recordEngineVersion(provisioner provision.Provisioner) error {
+	engineOptions := h.HostOptions.EngineOptions
+
+	version, err := provision.GetDockerVersion(provisioner)
+	if err != nil {
+		log.Warnf("Unable to determine the Docker version of %s: %s", h.Name, err)
+		engineOptions.InstalledVersion = ""
+	} else {
+		if engineOptions.Version != "" && engineOptions.Version != version {
+			log.Warnf("%s is running Docker %s instead of the requested %s", h.Name, version, engineOptions.Version)
+		}
+		engineOptions.InstalledVersion = version
+	}
+
+	return h.SaveConfig()
+}
+
+func (h *Host) hookOptions() hooks.HookOptions {
+	if h.HostOptions.HookOptions == nil {
+		return hooks.HookOptions{}
+	}
+	return *h.HostOptions.HookOptions
+}
+
+func (h *Host) setCloudInitUserData() error {
+	userDataDriver, ok := h.Driver.(drivers.UserDataDriver)
+	if !ok {
+		return fmt.Errorf("driver %q does not support cloud-init provisioning", h.Driver.DriverName())
+	}
+
+	if files, scripts := h.hookOptions().ForPhase(hooks.PreInstall); len(files) > 0 || len(scripts) > 0 {
+		return fmt.Errorf("%s hooks are not supported with cloud-init provisioning", hooks.PreInstall)
+	}
+
+	if h.HostOptions.EngineOptions.InstallPackage != "" || h.HostOptions.SwarmOptions.ImageArchive != "" {
+		return errors.New("offline installation is not supported with cloud-init provisioning")
+	}
+
+	if swarmOptions := h.HostOptions.SwarmOptions; swarmOptions.KVStore != "" || (swarmOptions.Cluster != "" && swarm.IsNodesDiscovery(swarmOptions.Discovery)) {
+		return errors.New("a cluster's KV store or static node list cannot be set up with cloud-init provisioning")
+	}
+
+	if h.HostOptions.EngineOptions.BindAddress == engine.BindPrivate {
+		return errors.New("binding the daemon to the private IP is not supported with cloud-init provisioning; give the IP instead")
+	}
+
+	userData, err := provision.GenerateCloudInit(h.Driver, *h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions)
+	if err != nil {
+		return fmt.Errorf("error generating cloud-init: %s", err)
+	}
+
+	log.Debugf("using cloud-init user-data:\n%s", userData)
+
+	return userDataDriver.SetUserData(userData)
+}
+
 func (h *Host) RunSSHCommand(command string) (ssh.Output, error) {
 	var output ssh.Output
 
@@ -191,7 +306,11 @@ func (h *Host) Start() error {
 		return err
 	}
 
-	return utils.WaitFor(drivers.MachineInState(h.Driver, state.Running))
+	if err := utils.WaitFor(drivers.MachineInState(h.Driver, state.Running)); err != nil {
+		return err
+	}
+
+	return h.renewServerCert()
 }
 
 func (h *Host) Stop() error {
@@ -254,11 +373,13 @@ func (h *Host) Upgrade() error {
 		log.Fatal(errMachineMustBeRunningForUpgrade)
 	}
 
-	provisioner, err := provision.DetectProvisioner(h.Driver)
+	provisioner, err := detectProvisioner(h.Driver)
 	if err != nil {
 		return err
 	}
 
+	provisioner.SetEngineOptions(*h.HostOptions.EngineOptions)
+
 	if err := provisioner.Package("docker", pkgaction.Upgrade); err != nil {
 		return err
 	}
@@ -266,7 +387,8 @@ func (h *Host) Upgrade() error {
 	if err := provisioner.Service("docker", pkgaction.Restart); err != nil {
 		return err
 	}
-	return nil
+
+	return h.recordEngineVersion(provisioner)
 }
 
 func (h *Host) Remove(force bool) error {
@@ -294,12 +416,92 @@ func (h *Host) removeStorePath() error {
 	return os.RemoveAll(h.StorePath)
 }
 
+// GetURL returns the URL the daemon is reached at: the driver's URL with
+// the engine's bind address and port, or the local end of the SSH tunnel
+// to its unix socket if TCP is disabled.
 func (h *Host) GetURL() (string, error) {
-	return h.Driver.GetURL()
+	var engineOptions engine.EngineOptions
+	if h.HostOptions != nil && h.HostOptions.EngineOptions != nil {
+		engineOptions = *h.HostOptions.EngineOptions
+	}
+
+	if engineOptions.DisableTCP {
+		return "unix://" + h.DockerSocketPath(), nil
+	}
+
+	dockerURL, err := h.Driver.GetURL()
+	if err != nil || dockerURL == "" {
+		return dockerURL, err
+	}
+
+	if engineOptions.BindsAllInterfaces() && engineOptions.Port == 0 {
+		return dockerURL, nil
+	}
+
+	u, err := url.Parse(dockerURL)
+	if err != nil {
+		return "", err
+	}
+
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host, port = u.Host, strconv.Itoa(engine.DefaultPort)
+	}
+
+	if !engineOptions.BindsAllInterfaces() {
+		if host, err = engineOptions.GetBindAddress(h.Driver); err != nil {
+			return "", err
+		}
+	}
+
+	if engineOptions.Port != 0 {
+		port = strconv.Itoa(engineOptions.Port)
+	}
+
+	u.Host = net.JoinHostPort(host, port)
+	return u.String(), nil
+}
+
+// CredentialsPath returns the path of the file holding the credentials
+// the driver stored in the config of machines created before drivers
+// resolved them through credential providers
+func (h *Host) CredentialsPath() string {
+	return filepath.Join(h.StorePath, "credentials.json")
+}
+
+// DockerSocketPath returns the path of the local end of the SSH tunnel to
+// the daemon's unix socket
+func (h *Host) DockerSocketPath() string {
+	return filepath.Join(h.StorePath, "docker.sock")
+}
+
+// ForwardDockerSocket forwards DockerSocketPath to the daemon's unix socket
+// over SSH.  It blocks until the tunnel fails.
+func (h *Host) ForwardDockerSocket() error {
+	addr, err := h.Driver.GetSSHHostname()
+	if err != nil {
+		return err
+	}
+
+	port, err := h.Driver.GetSSHPort()
+	if err != nil {
+		return err
+	}
+
+	auth := &ssh.Auth{
+		Keys: []string{h.Driver.GetSSHKeyPath()},
+	}
+
+	client, err := ssh.NewClient(h.Driver.GetSSHUsername(), addr, port, auth)
+	if err != nil {
+		return err
+	}
+
+	return client.ForwardUnixSocket(h.DockerSocketPath(), "/var/run/docker.sock")
 }
 
 func (h *Host) LoadConfig() error {
-	data, err := ioutil.ReadFile(filepath.Join(h.StorePath, "config.json"))
+	data, err := utils.ReadSecretFile(filepath.Join(h.StorePath, "config.json"))
 	if err != nil {
 		return err
 	}
@@ -326,15 +528,18 @@ func (h *Host) LoadConfig() error {
 		return err
 	}
 
-	return nil
+	return loadDriverCredentials(h, data)
 }
 
 func (h *Host) ConfigureAuth() error {
-	provisioner, err := provision.DetectProvisioner(h.Driver)
+	provisioner, err := detectProvisioner(h.Driver)
 	if err != nil {
 		return err
 	}
 
+	provisioner.SetAuthOptions(*h.HostOptions.AuthOptions)
+	provisioner.SetEngineOptions(*h.HostOptions.EngineOptions)
+
 	if err := provision.ConfigureAuth(provisioner); err != nil {
 		return err
 	}
@@ -342,13 +547,147 @@ func (h *Host) ConfigureAuth() error {
 	return nil
 }
 
+// ReloadCACertificates uploads the CA bundle to the machine and reloads its
+// daemon, keeping the server certificate
+func (h *Host) ReloadCACertificates() error {
+	provisioner, err := detectProvisioner(h.Driver)
+	if err != nil {
+		return err
+	}
+
+	provisioner.SetAuthOptions(*h.HostOptions.AuthOptions)
+	provisioner.SetEngineOptions(*h.HostOptions.EngineOptions)
+
+	return provision.ReloadCACertificates(provisioner)
+}
+
+// ConfigureSwarm restarts the machine's swarm containers with its stored
+// swarm options
+func (h *Host) ConfigureSwarm() error {
+	provisioner, err := h.swarmProvisioner()
+	if err != nil {
+		return err
+	}
+
+	return provision.ReconfigureSwarm(provisioner, *h.HostOptions.SwarmOptions)
+}
+
+// JoinSwarm starts the machine's swarm containers with its stored swarm
+// options, pulling the image
+func (h *Host) JoinSwarm() error {
+	provisioner, err := h.swarmProvisioner()
+	if err != nil {
+		return err
+	}
+
+	if h.HostOptions.SwarmOptions.Master {
+		if err := h.authorizeSwarmPort(); err != nil {
+			return err
+		}
+	}
+
+	return provision.JoinSwarm(provisioner, *h.HostOptions.SwarmOptions)
+}
+
+// LeaveSwarm removes the machine's swarm containers
+func (h *Host) LeaveSwarm() error {
+	provisioner, err := h.swarmProvisioner()
+	if err != nil {
+		return err
+	}
+
+	return provision.LeaveSwarm(provisioner)
+}
+
+// GetSwarmStatus returns the state of the machine's swarm containers
+func (h *Host) GetSwarmStatus() (provision.SwarmStatus, error) {
+	provisioner, err := h.swarmProvisioner()
+	if err != nil {
+		return provision.SwarmStatus{}, err
+	}
+
+	return provision.GetSwarmStatus(provisioner)
+}
+
+// GetSwarmURL returns the URL of the machine's swarm master: the port it
+// listens on at the address of the daemon
+func (h *Host) GetSwarmURL() (string, error) {
+	swarmOptions := h.HostOptions.SwarmOptions
+	if swarmOptions == nil || !swarmOptions.Master {
+		return "", fmt.Errorf("%s is not a swarm master", h.Name)
+	}
+
+	addr, err := h.dockerAddress()
+	if err != nil {
+		return "", err
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	listenAddr, err := swarmOptions.ListenAddress()
+	if err != nil {
+		return "", err
+	}
+
+	return swarm.Address{Host: host, Port: listenAddr.Port}.URL(), nil
+}
+
+// GetSwarmRole asks the machine's swarm master whether it is the primary
+// or a replica, using the client certificate env points Docker at
+func (h *Host) GetSwarmRole() (string, error) {
+	swarmURL, err := h.GetSwarmURL()
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(swarmURL)
+	if err != nil {
+		return "", err
+	}
+
+	return getSwarmRole(u.Host,
+		filepath.Join(h.StorePath, "ca.pem"),
+		filepath.Join(h.StorePath, "cert.pem"),
+		filepath.Join(h.StorePath, "key.pem"),
+	)
+}
+
+func (h *Host) swarmProvisioner() (provision.Provisioner, error) {
+	provisioner, err := detectProvisioner(h.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	provisioner.SetAuthOptions(*h.HostOptions.AuthOptions)
+	provisioner.SetEngineOptions(*h.HostOptions.EngineOptions)
+
+	return provisioner, nil
+}
+
+// authorizeSwarmPort opens the swarm master's port in the driver's firewall
+func (h *Host) authorizeSwarmPort() error {
+	listenAddr, err := h.HostOptions.SwarmOptions.ListenAddress()
+	if err != nil {
+		return err
+	}
+
+	if err := h.Driver.AuthorizePort([]*drivers.Port{{Protocol: "tcp", Port: listenAddr.Port}}); err != nil {
+		return fmt.Errorf("error opening port %d: %s", listenAddr.Port, err)
+	}
+
+	return nil
+}
+
 func (h *Host) SaveConfig() error {
 	data, err := json.Marshal(h)
 	if err != nil {
 		return err
 	}
 
-	if err := ioutil.WriteFile(filepath.Join(h.StorePath, "config.json"), data, 0600); err != nil {
+	if err := utils.WriteSecretFile(filepath.Join(h.StorePath, "config.json"), data, 0600); err != nil {
 		return err
 	}
 	return nil
@@ -411,15 +750,38 @@ func getHostState(host Host, hostListItemsChan chan<- HostListItem) {
 		}
 	}
 
+	// DOCKER_HOST may point at the daemon, or the swarm of a master
 	dockerHost := os.Getenv("DOCKER_HOST")
+	active := dockerHost == url
+	if host.HostOptions.SwarmOptions.Master && dockerHost != "" {
+		if swarmURL, err := host.GetSwarmURL(); err == nil && dockerHost == swarmURL {
+			active = true
+		}
+	}
+
+	dockerVersion := ""
+	if host.HostOptions.EngineOptions != nil {
+		dockerVersion = host.HostOptions.EngineOptions.InstalledVersion
+	}
+
+	swarmRole := ""
+	swarmOptions := host.HostOptions.SwarmOptions
+	if swarmOptions.Master && swarmOptions.Replication && currentState == state.Running {
+		if swarmRole, err = host.GetSwarmRole(); err != nil {
+			log.Debugf("error getting the swarm role of %s: %s", host.Name, err)
+		}
+	}
 
 	hostListItemsChan <- HostListItem{
-		Name:         host.Name,
-		Active:       dockerHost == url && currentState != state.Stopped,
-		DriverName:   host.Driver.DriverName(),
-		State:        currentState,
-		URL:          url,
-		SwarmOptions: *host.HostOptions.SwarmOptions,
+		Name:          host.Name,
+		Active:        active && currentState != state.Stopped,
+		DriverName:    host.Driver.DriverName(),
+		State:         currentState,
+		URL:           url,
+		DockerVersion: dockerVersion,
+		CertExpiry:    host.GetCertExpiry().Earliest(),
+		SwarmOptions:  *swarmOptions,
+		SwarmRole:     swarmRole,
 	}
 }
 
@@ -185,6 +185,44 @@ func TestHostOptions(t *testing.T) {
 	}
 }
 
+func TestGetURL(t *testing.T) {
+	defer cleanup()
+
+	for _, c := range []struct {
+		options  engine.EngineOptions
+		expected string
+	}{
+		{engine.EngineOptions{}, "tcp://1.2.3.4:2376"},
+		{engine.EngineOptions{Port: 2377}, "tcp://1.2.3.4:2377"},
+		{engine.EngineOptions{BindAddress: "10.0.0.1"}, "tcp://10.0.0.1:2376"},
+		{engine.EngineOptions{BindAddress: "fd00::1", Port: 2377}, "tcp://[fd00::1]:2377"},
+		{engine.EngineOptions{DisableTCP: true}, "unix:///store/docker.sock"},
+	} {
+		host, err := getDefaultTestHost()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		flags := getTestDriverFlags()
+		flags.Data["url"] = "tcp://1.2.3.4:2376"
+		if err := host.Driver.SetConfigFromFlags(flags); err != nil {
+			t.Fatal(err)
+		}
+
+		host.StorePath = "/store"
+		host.HostOptions.EngineOptions = &c.options
+
+		url, err := host.GetURL()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if url != c.expected {
+			t.Fatalf("expected %s for %+v; received %s", c.expected, c.options, url)
+		}
+	}
+}
+
 func TestPrintIPEmptyGivenLocalEngine(t *testing.T) {
 	defer cleanup()
 	host, _ := getDefaultTestHost()
@@ -32,6 +32,12 @@ func (m *Machine) Create(name string, driverName string, hostOptions *HostOption
 		return nil, fmt.Errorf("Machine %s already exists", name)
 	}
 
+	if hostOptions.SwarmOptions != nil {
+		if err := m.resolveClusterDiscovery(hostOptions.SwarmOptions); err != nil {
+			return nil, err
+		}
+	}
+
 	hostPath := filepath.Join(utils.GetMachineDir(), name)
 
 	host, err := NewHost(name, driverName, hostOptions)
@@ -60,6 +66,10 @@ func (m *Machine) Create(name string, driverName string, hostOptions *HostOption
 		return host, err
 	}
 
+	if err := m.updateClusterNodes(host); err != nil {
+		return host, err
+	}
+
 	return host, nil
 }
 
@@ -71,6 +81,14 @@ func (m *Machine) GetActive() (*Host, error) {
 	return m.store.GetActive()
 }
 
+func (m *Machine) GetActiveName() (string, error) {
+	return m.store.GetActiveName()
+}
+
+func (m *Machine) SetActive(host *Host) error {
+	return m.store.SetActive(host)
+}
+
 func (m *Machine) List() ([]*Host, error) {
 	return m.store.List()
 }
@@ -1,11 +1,19 @@
 package libmachine
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 
+	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/swarm"
+	"github.com/docker/machine/log"
 	"github.com/docker/machine/utils"
 )
 
@@ -37,17 +45,19 @@ func FillNestedHost(host *Host) *Host {
 		}
 	}
 
-	host.HostOptions.AuthOptions = &auth.AuthOptions{
-		StorePath:            host.StorePath,
-		CaCertPath:           certInfo.CaCertPath,
-		CaCertRemotePath:     "",
-		ServerCertPath:       certInfo.ServerCertPath,
-		ServerKeyPath:        certInfo.ServerKeyPath,
-		ClientKeyPath:        certInfo.ClientKeyPath,
-		ServerCertRemotePath: "",
-		ServerKeyRemotePath:  "",
-		PrivateKeyPath:       certInfo.CaKeyPath,
-		ClientCertPath:       certInfo.ClientCertPath,
+	if host.HostOptions.AuthOptions == nil {
+		host.HostOptions.AuthOptions = &auth.AuthOptions{
+			StorePath:            host.StorePath,
+			CaCertPath:           certInfo.CaCertPath,
+			CaCertRemotePath:     "",
+			ServerCertPath:       certInfo.ServerCertPath,
+			ServerKeyPath:        certInfo.ServerKeyPath,
+			ClientKeyPath:        certInfo.ClientKeyPath,
+			ServerCertRemotePath: "",
+			ServerKeyRemotePath:  "",
+			PrivateKeyPath:       certInfo.CaKeyPath,
+			ClientCertPath:       certInfo.ClientCertPath,
+		}
 	}
 
 	return host
@@ -120,3 +130,100 @@ func getCertInfoFromHost(h *Host) CertPathInfo {
 		ServerKeyPath:  serverKeyPath,
 	}
 }
+
+// Drivers used to store their credentials in the machine's config.  They
+// now resolve them through credential providers and tag the fields json:"-",
+// so machines created before would lose them when loaded.  Instead they are
+// moved to the machine's credentials file, which is read on every load.
+
+// driverCredentialFields returns the credential fields of the driver: the
+// strings it leaves out of the config, by field name
+func driverCredentialFields(d drivers.Driver) map[string]reflect.Value {
+	fields := map[string]reflect.Value{}
+
+	v := reflect.ValueOf(d)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fields
+	}
+	v = v.Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.Tag.Get("json") == "-" && f.Type.Kind() == reflect.String && f.PkgPath == "" {
+			fields[f.Name] = v.Field(i)
+		}
+	}
+
+	return fields
+}
+
+// loadDriverCredentials moves the credentials stored in the config data to
+// the machine's credentials file, and sets the driver's credentials which
+// are unset from the file.  The credentials are only moved when the store
+// is encrypted; otherwise they are used from the config this once, and the
+// user is asked to configure a credential provider instead.
+func loadDriverCredentials(h *Host, data []byte) error {
+	fields := driverCredentialFields(h.Driver)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var config struct {
+		Driver map[string]interface{}
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+
+	path := h.CredentialsPath()
+	credentials := map[string]string{}
+
+	stored, err := utils.ReadSecretFile(path)
+	if err == nil {
+		if err := json.Unmarshal(stored, &credentials); err != nil {
+			return fmt.Errorf("error reading %s: %s", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	migrated := []string{}
+	for name := range fields {
+		if value, ok := config.Driver[name].(string); ok && value != "" {
+			credentials[name] = value
+			migrated = append(migrated, name)
+		}
+	}
+
+	for name, value := range credentials {
+		if field, ok := fields[name]; ok && field.String() == "" {
+			field.SetString(value)
+		}
+	}
+
+	if len(migrated) == 0 {
+		return nil
+	}
+
+	// the credentials file would hold them in the clear
+	if !utils.StorageEncryptionEnabled() {
+		sort.Strings(migrated)
+		log.Warnf("The config of %s holds credentials (%s) which are no longer kept with the machine unless the store is encrypted (see encrypt-store); set them in the environment, the credentials file %s or a credential helper (MACHINE_CREDENTIAL_HELPER), as they are dropped the next time the config is saved",
+			h.Name, strings.Join(migrated, ", "), drivers.GetCredentialsFile())
+		return nil
+	}
+
+	data, err = json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+
+	if err := utils.WriteSecretFile(path, data, 0600); err != nil {
+		return err
+	}
+
+	log.Debugf("Moved the credentials of %s from its config to %s", h.Name, path)
+
+	// the config is written without them
+	return h.SaveConfig()
+}
@@ -1,13 +1,19 @@
 package libmachine
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/docker/machine/drivers/fakedriver"
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/swarm"
+	"github.com/docker/machine/utils"
 )
 
 func TestFillNestedHost(t *testing.T) {
@@ -117,3 +123,104 @@ func TestGetCertInfoFromHost(t *testing.T) {
 		t.Fatal("Expected these structs to be equal, they were different")
 	}
 }
+
+// credentialsDriver is a driver with a credential, which used to be stored
+// in the config
+type credentialsDriver struct {
+	fakedriver.FakeDriver
+	Secret string `json:"-"`
+	Region string
+}
+
+func TestLoadDriverCredentials(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.Setenv("MACHINE_STORAGE_PASSPHRASE", "correct horse")
+	defer os.Setenv("MACHINE_STORAGE_PASSPHRASE", "")
+
+	data := []byte(`{"Driver": {"Secret": "s3cret", "Region": "us-east-1"}}`)
+
+	driver := &credentialsDriver{}
+	if err := json.Unmarshal(data, &struct{ Driver *credentialsDriver }{driver}); err != nil {
+		t.Fatal(err)
+	}
+
+	host := &Host{Name: "test", StorePath: tmpDir, Driver: driver}
+	if err := loadDriverCredentials(host, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if driver.Secret != "s3cret" {
+		t.Fatalf("expected the credential from the config; received %q", driver.Secret)
+	}
+
+	config, err := utils.ReadSecretFile(filepath.Join(tmpDir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(config), "s3cret") {
+		t.Fatalf("expected the credential to be removed from the config; received %s", config)
+	}
+
+	// the config no longer has the credential, which is loaded from the
+	// credentials file instead
+	driver = &credentialsDriver{}
+	if err := json.Unmarshal(config, &struct{ Driver *credentialsDriver }{driver}); err != nil {
+		t.Fatal(err)
+	}
+
+	host.Driver = driver
+	if err := loadDriverCredentials(host, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if driver.Secret != "s3cret" || driver.Region != "us-east-1" {
+		t.Fatalf("expected the credential from the credentials file; received %+v", driver)
+	}
+
+	// credentials which are set are kept
+	driver.Secret = "other"
+	if err := loadDriverCredentials(host, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if driver.Secret != "other" {
+		t.Fatalf("expected the credential to be kept; received %q", driver.Secret)
+	}
+}
+
+func TestLoadDriverCredentialsUnencrypted(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	data := []byte(`{"Driver": {"Secret": "s3cret", "Region": "us-east-1"}}`)
+
+	driver := &credentialsDriver{}
+	if err := json.Unmarshal(data, &struct{ Driver *credentialsDriver }{driver}); err != nil {
+		t.Fatal(err)
+	}
+
+	host := &Host{Name: "test", StorePath: tmpDir, Driver: driver}
+	if err := loadDriverCredentials(host, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if driver.Secret != "s3cret" {
+		t.Fatalf("expected the credential from the config; received %q", driver.Secret)
+	}
+
+	// the credentials are not written in the clear
+	for _, name := range []string{"credentials.json", "config.json"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s not to be written; received %v", name, err)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/hooks"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/swarm"
 	"github.com/docker/machine/log"
@@ -72,14 +73,22 @@ func (provisioner *Boot2DockerProvisioner) upgradeIso() error {
 
 	b2dutils := utils.NewB2dUtils("", "")
 
-	// Usually we call this implicitly, but call it here explicitly to get
-	// the latest boot2docker ISO.
-	if err := b2dutils.DownloadLatestBoot2Docker(); err != nil {
-		return err
+	// boot2docker releases are tagged with the version of Docker they
+	// ship, so a pinned version is downloaded straight into the machine's
+	// directory, leaving the cached latest release alone.
+	isoURL := ""
+	if version := provisioner.EngineOptions.Version; version != "" {
+		isoURL = b2dutils.GetBoot2DockerReleaseURL("v" + version)
+	} else {
+		// Usually we call this implicitly, but call it here explicitly to get
+		// the latest boot2docker ISO.
+		if err := b2dutils.DownloadLatestBoot2Docker(); err != nil {
+			return err
+		}
 	}
 
-	// Copy the latest version of boot2docker ISO to the machine's directory
-	if err := b2dutils.CopyIsoToMachineDir("", machineName); err != nil {
+	// Copy the boot2docker ISO to the machine's directory
+	if err := b2dutils.CopyIsoToMachineDir(isoURL, machineName); err != nil {
 		return err
 	}
 
@@ -135,38 +144,75 @@ func (provisioner *Boot2DockerProvisioner) GetAuthOptions() auth.AuthOptions {
 	return provisioner.AuthOptions
 }
 
+func (provisioner *Boot2DockerProvisioner) SetAuthOptions(authOptions auth.AuthOptions) {
+	provisioner.AuthOptions = authOptions
+}
+
+func (provisioner *Boot2DockerProvisioner) GetEngineOptions() engine.EngineOptions {
+	return provisioner.EngineOptions
+}
+
+func (provisioner *Boot2DockerProvisioner) SetEngineOptions(engineOptions engine.EngineOptions) {
+	provisioner.EngineOptions = engineOptions
+
+	if provisioner.EngineOptions.StorageDriver == "" {
+		provisioner.EngineOptions.StorageDriver = "aufs"
+	}
+}
+
 func (provisioner *Boot2DockerProvisioner) GenerateDockerOptions(dockerPort int) (*DockerOptions, error) {
 	var (
 		engineCfg bytes.Buffer
 	)
 
-	driverNameLabel := fmt.Sprintf("provider=%s", provisioner.Driver.DriverName())
-	provisioner.EngineOptions.Labels = append(provisioner.EngineOptions.Labels, driverNameLabel)
+	labels, err := engineLabels(provisioner.EngineOptions, provisioner.Driver)
+	if err != nil {
+		return nil, err
+	}
+	provisioner.EngineOptions.Labels = labels
 
+	// the init script defaults an empty DOCKER_HOST to a TCP socket and
+	// always adds /var/run/docker.sock, so a second unix socket stands in
+	// when TCP is disabled
 	engineConfigTmpl := `
 EXTRA_ARGS='
 {{ range .EngineOptions.Labels }}--label {{.}}
+{{ end }}{{ with .EngineOptions.ClusterStore }}--cluster-store {{.}}
+{{ end }}{{ with .EngineOptions.ClusterAdvertise }}--cluster-advertise {{.}}
 {{ end }}{{ range .EngineOptions.InsecureRegistry }}--insecure-registry {{.}}
 {{ end }}{{ range .EngineOptions.RegistryMirror }}--registry-mirror {{.}}
+{{ end }}{{ range .EngineOptions.Dns }}--dns {{.}}
+{{ end }}{{ with .EngineOptions.GraphDir }}--graph {{.}}
+{{ end }}{{ if .EngineOptions.Ipv6 }}--ipv6
+{{ end }}{{ with .EngineOptions.LogLevel }}--log-level {{.}}
+{{ end }}{{ if .EngineOptions.SelinuxEnabled }}--selinux-enabled
 {{ end }}{{ range .EngineOptions.ArbitraryFlags }}--{{.}}
 {{ end }}
 '
 CACERT={{.AuthOptions.CaCertRemotePath}}
-DOCKER_HOST='-H tcp://0.0.0.0:{{.DockerPort}}'
+DOCKER_HOST='{{ with .DockerListenAddress }}-H tcp://{{.}}{{ else }}-H unix:///var/run/docker-machine.sock{{ end }}'
 DOCKER_STORAGE={{.EngineOptions.StorageDriver}}
 DOCKER_TLS=auto
 SERVERKEY={{.AuthOptions.ServerKeyRemotePath}}
 SERVERCERT={{.AuthOptions.ServerCertRemotePath}}
+{{ range .EngineOptions.Env }}export {{ exportEnv . }}
+{{ end }}
 `
-	t, err := template.New("engineConfig").Parse(engineConfigTmpl)
+	t, err := template.New("engineConfig").Funcs(engineConfigFuncs).Parse(engineConfigTmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	listenAddress, err := dockerListenAddress(provisioner.EngineOptions, provisioner.Driver, dockerPort)
 	if err != nil {
 		return nil, err
 	}
 
 	engineConfigContext := EngineConfigContext{
-		DockerPort:    dockerPort,
-		AuthOptions:   provisioner.AuthOptions,
-		EngineOptions: provisioner.EngineOptions,
+		DockerPort:          dockerPort,
+		DockerListenAddress: listenAddress,
+		AuthOptions:         provisioner.AuthOptions,
+		EngineOptions:       provisioner.EngineOptions,
 	}
 
 	t.Execute(&engineCfg, engineConfigContext)
@@ -186,20 +232,20 @@ func (provisioner *Boot2DockerProvisioner) SetOsReleaseInfo(info *OsRelease) {
 	provisioner.OsReleaseInfo = info
 }
 
-func (provisioner *Boot2DockerProvisioner) Provision(swarmOptions swarm.SwarmOptions, authOptions auth.AuthOptions, engineOptions engine.EngineOptions) error {
+func (provisioner *Boot2DockerProvisioner) Provision(swarmOptions swarm.SwarmOptions, authOptions auth.AuthOptions, engineOptions engine.EngineOptions, hookOptions hooks.HookOptions) error {
 	provisioner.SwarmOptions = swarmOptions
 	provisioner.AuthOptions = authOptions
-	provisioner.EngineOptions = engineOptions
+	provisioner.SetEngineOptions(engineOptions)
 
-	if provisioner.EngineOptions.StorageDriver == "" {
-		provisioner.EngineOptions.StorageDriver = "aufs"
+	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+		return err
 	}
 
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+	if err := runHooks(provisioner, hookOptions, hooks.PreInstall); err != nil {
 		return err
 	}
 
-	if err := installDockerGeneric(provisioner); err != nil {
+	if err := installDockerGeneric(provisioner, provisioner.EngineOptions); err != nil {
 		return err
 	}
 
@@ -209,8 +255,13 @@ func (provisioner *Boot2DockerProvisioner) Provision(swarmOptions swarm.SwarmOpt
 	}
 
 	// b2d hosts need to wait for the daemon to be up
-	// before continuing with provisioning
-	if err := utils.WaitForDocker(ip, 2376); err != nil {
+	// before continuing with provisioning; if the listen options were
+	// changed it may be running with those of a previous provisioning
+	if engineOptions.BindAddress != "" || engineOptions.Port != 0 || engineOptions.DisableTCP {
+		if err := waitForDockerOverSSH(provisioner); err != nil {
+			return err
+		}
+	} else if err := utils.WaitForDocker(ip, engine.DefaultPort); err != nil {
 		return err
 	}
 
@@ -224,10 +275,18 @@ func (provisioner *Boot2DockerProvisioner) Provision(swarmOptions swarm.SwarmOpt
 		return err
 	}
 
+	if err := runHooks(provisioner, hookOptions, hooks.PostAuth); err != nil {
+		return err
+	}
+
 	if err := configureSwarm(provisioner, swarmOptions); err != nil {
 		return err
 	}
 
+	if err := runHooks(provisioner, hookOptions, hooks.PostSwarm); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,279 @@
+package provision
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/hooks"
+	"github.com/docker/machine/libmachine/provision/pkgaction"
+	"github.com/docker/machine/libmachine/swarm"
+	"github.com/docker/machine/log"
+	"github.com/docker/machine/utils"
+)
+
+const (
+	cloudInitScriptPath = "/usr/local/bin/docker-machine-provision"
+	cloudInitAddrFile   = "machine-addr"
+)
+
+// The server certificate is bound to the machine's address, which is only
+// known once the instance exists.  The provisioning script therefore waits
+// for the certificate (and the address swarm should advertise) to be
+// uploaded by CompleteCloudInit before starting the daemon and swarm.
+var cloudInitTmpl = `#cloud-config
+hostname: {{.Hostname}}
+manage_etc_hosts: true
+write_files:
+  - path: {{.AuthOptions.CaCertRemotePath}}
+    permissions: '0644'
+    content: |
+{{ indent .CaCert }}
+  - path: ` + cloudInitScriptPath + `
+    permissions: '0755'
+    content: |
+{{ indent .Script }}
+runcmd:
+  - ` + cloudInitScriptPath + `
+`
+
+var cloudInitScriptTmpl = `#!/bin/sh
+set -e
+if ! type docker; then curl -sSL {{.InstallURL}} | sh -; fi
+{{ with .DockerVersion }}DEBIAN_FRONTEND=noninteractive apt-get install -y lxc-docker-{{.}}
+{{ end }}service docker stop || true
+cat >> {{.DockerOptions.EngineOptionsPath}} <<'MACHINE_EOF'
+{{.DockerOptions.EngineOptions}}
+MACHINE_EOF
+while [ ! -f {{.AuthOptions.ServerKeyRemotePath}} ]; do sleep 1; done
+service docker start
+{{ if .SwarmCommands }}until docker version; do sleep 1; done
+MACHINE_ADDR=$(cat {{.AddrPath}})
+{{ range .SwarmCommands }}{{.}}
+{{ end }}{{ end }}`
+
+type CloudInitContext struct {
+	Hostname      string
+	InstallURL    string
+	DockerVersion string
+	CaCert        string
+	Script        string
+	AddrPath      string
+	AuthOptions   auth.AuthOptions
+	DockerOptions *DockerOptions
+	SwarmCommands []string
+}
+
+func indentCloudInit(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = "      " + l
+	}
+	return strings.Join(lines, "\n")
+}
+
+// GenerateCloudInit renders a cloud-init document which installs Docker,
+// writes the CA certificate and daemon options, sets the hostname and starts
+// the swarm containers on first boot.  Cloud images are assumed to be
+// Ubuntu based, as they are for all drivers which support user-data.
+func GenerateCloudInit(d drivers.Driver, swarmOptions swarm.SwarmOptions, authOptions auth.AuthOptions, engineOptions engine.EngineOptions) ([]byte, error) {
+	var (
+		script    bytes.Buffer
+		cloudInit bytes.Buffer
+	)
+
+	provisioner := NewUbuntuProvisioner(d).(*UbuntuProvisioner)
+	provisioner.SetEngineOptions(engineOptions)
+
+	dockerDir := provisioner.GetDockerOptionsDir()
+	provisioner.AuthOptions = remoteAuthOptions(dockerDir, authOptions)
+
+	// the driver has no URL before the instance exists; use the default port
+	dockerPort := engine.DefaultPort
+	if engineOptions.DisableTCP {
+		dockerPort = 0
+	} else if engineOptions.Port != 0 {
+		dockerPort = engineOptions.Port
+	}
+
+	dockerOptions, err := provisioner.GenerateDockerOptions(dockerPort)
+	if err != nil {
+		return nil, err
+	}
+
+	caCert, err := daemonCaCertificates(authOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	context := CloudInitContext{
+		Hostname:      d.GetMachineName(),
+		InstallURL:    engineOptions.GetInstallURL(),
+		DockerVersion: engineOptions.Version,
+		CaCert:        string(caCert),
+		AddrPath:      path.Join(dockerDir, cloudInitAddrFile),
+		AuthOptions:   provisioner.AuthOptions,
+		DockerOptions: dockerOptions,
+	}
+
+	if swarmOptions.IsSwarm {
+		dockerAddr := swarm.Address{Host: "$MACHINE_ADDR", Port: dockerPort}
+		if !engineOptions.BindsAllInterfaces() {
+			dockerAddr.Host = engineOptions.BindAddress
+		}
+
+		nodeAddr, err := swarmOptions.AdvertiseAddress(d, dockerAddr)
+		if err != nil {
+			return nil, err
+		}
+
+		commands, err := swarmCommands(dockerDir, nodeAddr, swarmOptions)
+		if err != nil {
+			return nil, err
+		}
+		context.SwarmCommands = commands
+	}
+
+	t, err := template.New("cloudInitScript").Parse(cloudInitScriptTmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.Execute(&script, context); err != nil {
+		return nil, err
+	}
+
+	context.Script = script.String()
+
+	t, err = template.New("cloudInit").Funcs(template.FuncMap{
+		"indent": indentCloudInit,
+	}).Parse(cloudInitTmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.Execute(&cloudInit, context); err != nil {
+		return nil, err
+	}
+
+	return cloudInit.Bytes(), nil
+}
+
+// CompleteCloudInit finishes provisioning a host which was created with the
+// document from GenerateCloudInit: it issues the server certificate for the
+// host's address, hands it over and verifies the daemon is up.  Docker is
+// installed by cloud-init, so only the post-auth and post-swarm hooks run.
+func CompleteCloudInit(p Provisioner, swarmOptions swarm.SwarmOptions, authOptions auth.AuthOptions, hookOptions hooks.HookOptions) error {
+	dockerDir := p.GetDockerOptionsDir()
+	authOptions = remoteAuthOptions(dockerDir, authOptions)
+
+	ip, err := p.GetDriver().GetIP()
+	if err != nil {
+		return err
+	}
+
+	if err := generateServerCert(p.GetDriver(), authOptions); err != nil {
+		return err
+	}
+
+	serverCert, err := ioutil.ReadFile(authOptions.ServerCertPath)
+	if err != nil {
+		return err
+	}
+
+	serverKey, err := utils.ReadSecretFile(authOptions.ServerKeyPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(fmt.Sprintf("sudo mkdir -p %s && echo \"%s\" | sudo tee %s", dockerDir, ip, path.Join(dockerDir, cloudInitAddrFile))); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(fmt.Sprintf("echo \"%s\" | sudo tee %s", string(serverCert), authOptions.ServerCertRemotePath)); err != nil {
+		return err
+	}
+
+	// the key is written last and moved into place as the provisioning
+	// script starts the daemon as soon as it appears.  It is sent over
+	// stdin to keep it out of the host's process list.
+	keyPath := shellQuote(authOptions.ServerKeyRemotePath)
+	if _, err := sshCommandWithInput(p, fmt.Sprintf("sudo tee %s.tmp >/dev/null && sudo mv %s.tmp %s", keyPath, keyPath, keyPath), bytes.NewReader(serverKey)); err != nil {
+		return err
+	}
+
+	dockerPort, err := getDockerPort(p)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Waiting for cloud-init to start the Docker daemon...")
+
+	if err := waitForDocker(p, ip, dockerPort); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand("sudo docker version"); err != nil {
+		return fmt.Errorf("error verifying the Docker daemon: %s", err)
+	}
+
+	if dockerPort == 0 {
+		if err := allowSocketAccess(p); err != nil {
+			return err
+		}
+	}
+
+	if err := runHooks(p, hookOptions, hooks.PostAuth); err != nil {
+		return err
+	}
+
+	if swarmOptions.IsSwarm {
+		if err := utils.WaitFor(func() bool {
+			_, err := p.SSHCommand("sudo docker inspect swarm-agent")
+			return err == nil
+		}); err != nil {
+			return fmt.Errorf("error verifying the swarm agent: %s", err)
+		}
+	}
+
+	if p.GetEngineOptions().ClusterStore != "" {
+		p.SetAuthOptions(authOptions)
+		if err := setClusterStore(p, ip, dockerPort); err != nil {
+			return err
+		}
+	}
+
+	return runHooks(p, hookOptions, hooks.PostSwarm)
+}
+
+// setClusterStore restarts the daemon with the cluster store options, which
+// need the machine's address and so are missing from the user data.  The
+// options appended override those written by cloud-init.
+func setClusterStore(p Provisioner, ip string, dockerPort int) error {
+	dockerOptions, err := p.GenerateDockerOptions(dockerPort)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Restarting the Docker daemon with the cluster store...")
+
+	if err := appendDockerOptions(p, dockerOptions); err != nil {
+		return err
+	}
+
+	if err := p.Service("docker", pkgaction.Restart); err != nil {
+		return err
+	}
+
+	if err := waitForDocker(p, ip, dockerPort); err != nil {
+		return err
+	}
+
+	return checkClusterStore(p, p.GetEngineOptions().ClusterStore)
+}
@@ -0,0 +1,128 @@
+package provision
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/swarm"
+)
+
+func TestGenerateCloudInit(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	if err := ioutil.WriteFile(caCertPath, []byte("-----BEGIN CERTIFICATE-----\ntest\n-----END CERTIFICATE-----\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	swarmOptions := swarm.SwarmOptions{
+		IsSwarm:   true,
+		Master:    true,
+		Host:      "tcp://0.0.0.0:3376",
+		Discovery: "token://test",
+	}
+	authOptions := auth.AuthOptions{
+		CaCertPath: caCertPath,
+	}
+	engineOptions := engine.EngineOptions{
+		Labels: []string{"foo=bar"},
+	}
+
+	userData, err := GenerateCloudInit(&fakedriver.FakeDriver{}, swarmOptions, authOptions, engineOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cloudInit := string(userData)
+
+	if !strings.HasPrefix(cloudInit, "#cloud-config\n") {
+		t.Fatalf("expected cloud-config header; received %s", cloudInit)
+	}
+
+	expected := []string{
+		"  - path: /etc/docker/ca.pem\n",
+		"      -----BEGIN CERTIFICATE-----\n      test\n",
+		"  - path: " + cloudInitScriptPath + "\n",
+		"      if ! type docker; then curl -sSL https://get.docker.com | sh -; fi\n",
+		"      cat >> /etc/default/docker <<'MACHINE_EOF'\n",
+		"      --label foo=bar\n",
+		"      --storage-driver aufs\n",
+		"      while [ ! -f /etc/docker/server-key.pem ]; do sleep 1; done\n",
+		"      MACHINE_ADDR=$(cat /etc/docker/machine-addr)\n",
+		"--name swarm-agent-master",
+		"join --addr $MACHINE_ADDR:2376 token://test\n",
+		"runcmd:\n  - " + cloudInitScriptPath + "\n",
+	}
+
+	for _, e := range expected {
+		if strings.Index(cloudInit, e) == -1 {
+			t.Fatalf("expected cloud-init to contain %q; received %s", e, cloudInit)
+		}
+	}
+}
+
+func TestGenerateCloudInitNoSwarm(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	if err := ioutil.WriteFile(caCertPath, []byte("test"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	userData, err := GenerateCloudInit(&fakedriver.FakeDriver{}, swarm.SwarmOptions{}, auth.AuthOptions{CaCertPath: caCertPath}, engine.EngineOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Index(string(userData), "swarm") != -1 {
+		t.Fatalf("expected no swarm commands; received %s", userData)
+	}
+}
+
+func TestGenerateCloudInitEngineVersion(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	if err := ioutil.WriteFile(caCertPath, []byte("test"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	engineOptions := engine.EngineOptions{
+		InstallURL: "https://test.docker.com",
+		Version:    "1.6.2",
+	}
+
+	userData, err := GenerateCloudInit(&fakedriver.FakeDriver{}, swarm.SwarmOptions{}, auth.AuthOptions{CaCertPath: caCertPath}, engineOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"curl -sSL https://test.docker.com | sh -",
+		"apt-get install -y lxc-docker-1.6.2\n",
+	}
+
+	for _, e := range expected {
+		if strings.Index(string(userData), e) == -1 {
+			t.Fatalf("expected cloud-init to contain %q; received %s", e, userData)
+		}
+	}
+}
@@ -1,12 +1,34 @@
 package provision
 
 import (
+	"strings"
+	"text/template"
+
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/engine"
 )
 
 type EngineConfigContext struct {
-	DockerPort    int
-	AuthOptions   auth.AuthOptions
-	EngineOptions engine.EngineOptions
+	DockerPort int
+	// DockerListenAddress is the host:port of the daemon's TCP socket,
+	// empty if TCP is disabled
+	DockerListenAddress string
+	AuthOptions         auth.AuthOptions
+	EngineOptions       engine.EngineOptions
+}
+
+// engineConfigFuncs are the functions of the daemon options templates
+var engineConfigFuncs = template.FuncMap{
+	"exportEnv": exportEnv,
+}
+
+// exportEnv returns an engine environment variable, KEY=value, with its
+// value quoted for the shell profile the daemon options are sourced from.
+// The key is checked by EngineOptions.Validate.
+func exportEnv(env string) string {
+	parts := strings.SplitN(env, "=", 2)
+	if len(parts) != 2 {
+		return shellQuote(env)
+	}
+	return parts[0] + "=" + shellQuote(parts[1])
 }
@@ -75,6 +75,22 @@ func (provisioner *GenericProvisioner) GetAuthOptions() auth.AuthOptions {
 	return provisioner.AuthOptions
 }
 
+func (provisioner *GenericProvisioner) SetAuthOptions(authOptions auth.AuthOptions) {
+	provisioner.AuthOptions = authOptions
+}
+
+func (provisioner *GenericProvisioner) GetEngineOptions() engine.EngineOptions {
+	return provisioner.EngineOptions
+}
+
+func (provisioner *GenericProvisioner) SetEngineOptions(engineOptions engine.EngineOptions) {
+	provisioner.EngineOptions = engineOptions
+
+	if provisioner.EngineOptions.StorageDriver == "" {
+		provisioner.EngineOptions.StorageDriver = "aufs"
+	}
+}
+
 func (provisioner *GenericProvisioner) SetOsReleaseInfo(info *OsRelease) {
 	provisioner.OsReleaseInfo = info
 }
@@ -84,34 +100,52 @@ func (provisioner *GenericProvisioner) GenerateDockerOptions(dockerPort int) (*D
 		engineCfg bytes.Buffer
 	)
 
-	driverNameLabel := fmt.Sprintf("provider=%s", provisioner.Driver.DriverName())
-	provisioner.EngineOptions.Labels = append(provisioner.EngineOptions.Labels, driverNameLabel)
+	labels, err := engineLabels(provisioner.EngineOptions, provisioner.Driver)
+	if err != nil {
+		return nil, err
+	}
+	provisioner.EngineOptions.Labels = labels
 
 	engineConfigTmpl := `
 DOCKER_OPTS='
--H tcp://0.0.0.0:{{.DockerPort}}
--H unix:///var/run/docker.sock
+{{ with .DockerListenAddress }}-H tcp://{{.}}
+{{ end }}-H unix:///var/run/docker.sock
 --storage-driver {{.EngineOptions.StorageDriver}}
 --tlsverify
 --tlscacert {{.AuthOptions.CaCertRemotePath}}
 --tlscert {{.AuthOptions.ServerCertRemotePath}}
 --tlskey {{.AuthOptions.ServerKeyRemotePath}}
 {{ range .EngineOptions.Labels }}--label {{.}}
+{{ end }}{{ with .EngineOptions.ClusterStore }}--cluster-store {{.}}
+{{ end }}{{ with .EngineOptions.ClusterAdvertise }}--cluster-advertise {{.}}
 {{ end }}{{ range .EngineOptions.InsecureRegistry }}--insecure-registry {{.}}
 {{ end }}{{ range .EngineOptions.RegistryMirror }}--registry-mirror {{.}}
+{{ end }}{{ range .EngineOptions.Dns }}--dns {{.}}
+{{ end }}{{ with .EngineOptions.GraphDir }}--graph {{.}}
+{{ end }}{{ if .EngineOptions.Ipv6 }}--ipv6
+{{ end }}{{ with .EngineOptions.LogLevel }}--log-level {{.}}
+{{ end }}{{ if .EngineOptions.SelinuxEnabled }}--selinux-enabled
 {{ end }}{{ range .EngineOptions.ArbitraryFlags }}--{{.}}
 {{ end }}
 '
+{{ range .EngineOptions.Env }}export {{ exportEnv . }}
+{{ end }}
 `
-	t, err := template.New("engineConfig").Parse(engineConfigTmpl)
+	t, err := template.New("engineConfig").Funcs(engineConfigFuncs).Parse(engineConfigTmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	listenAddress, err := dockerListenAddress(provisioner.EngineOptions, provisioner.Driver, dockerPort)
 	if err != nil {
 		return nil, err
 	}
 
 	engineConfigContext := EngineConfigContext{
-		DockerPort:    dockerPort,
-		AuthOptions:   provisioner.AuthOptions,
-		EngineOptions: provisioner.EngineOptions,
+		DockerPort:          dockerPort,
+		DockerListenAddress: listenAddress,
+		AuthOptions:         provisioner.AuthOptions,
+		EngineOptions:       provisioner.EngineOptions,
 	}
 
 	t.Execute(&engineCfg, engineConfigContext)
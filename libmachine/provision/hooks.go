@@ -0,0 +1,91 @@
+package provision
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/hooks"
+	"github.com/docker/machine/log"
+)
+
+const remoteHookDir = "/tmp/docker-machine-hooks"
+
+// runCommand runs the command and includes its output in the error on
+// failure so that hook errors are surfaced to the user.
+func runCommand(p Provisioner, command string) error {
+	output, err := p.SSHCommand(command)
+	if err != nil {
+		var buf bytes.Buffer
+		if output.Stdout != nil {
+			buf.ReadFrom(output.Stdout)
+		}
+		if output.Stderr != nil {
+			buf.ReadFrom(output.Stderr)
+		}
+		if buf.Len() == 0 {
+			return err
+		}
+		return fmt.Errorf("%s\n%s", err, buf.String())
+	}
+
+	return nil
+}
+
+// shellQuote quotes s as a single word for the shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// uploadFile copies a local file to dest on the host, preserving its mode.
+// The file is streamed to a staging path the SSH user can write to and
+// then installed as root, as dest is usually owned by root.
+func uploadFile(p Provisioner, src, dest string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	staging := path.Join(remoteHookDir, "upload")
+	if err := streamFile(p, src, staging); err != nil {
+		return err
+	}
+
+	return runCommand(p, fmt.Sprintf("sudo mkdir -p %s && sudo install -m %o %s %s && rm -f %s",
+		shellQuote(path.Dir(dest)),
+		fi.Mode().Perm(),
+		shellQuote(staging),
+		shellQuote(dest),
+		shellQuote(staging),
+	))
+}
+
+// runHooks uploads the files and then runs the scripts for the given phase
+func runHooks(p Provisioner, hookOptions hooks.HookOptions, phase string) error {
+	files, scripts := hookOptions.ForPhase(phase)
+
+	for _, f := range files {
+		log.Infof("Uploading %s to %s (%s)...", f.Source, f.Destination, phase)
+		if err := uploadFile(p, f.Source, f.Destination); err != nil {
+			return fmt.Errorf("error uploading %s: %s", f.Source, err)
+		}
+	}
+
+	for _, s := range scripts {
+		log.Infof("Running %s (%s)...", s.Path, phase)
+		dest := path.Join(remoteHookDir, filepath.Base(s.Path))
+		if err := uploadFile(p, s.Path, dest); err != nil {
+			return fmt.Errorf("error uploading %s: %s", s.Path, err)
+		}
+
+		script := shellQuote(dest)
+		if err := runCommand(p, fmt.Sprintf("sudo chmod +x %s && sudo %s; rc=$?; sudo rm -f %s; exit $rc", script, script, script)); err != nil {
+			return fmt.Errorf("error running %s: %s", s.Path, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package provision
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/hooks"
+	"github.com/docker/machine/ssh"
+)
+
+// fakeProvisioner records the SSH commands it is asked to run
+type fakeProvisioner struct {
+	Provisioner
+	commands []string
+	uploads  []string
+	fail     string
+}
+
+func init() {
+	sshCommandWithInput = func(p Provisioner, args string, input io.Reader) (ssh.Output, error) {
+		fp := p.(*fakeProvisioner)
+		data, err := ioutil.ReadAll(input)
+		if err != nil {
+			return ssh.Output{}, err
+		}
+		fp.uploads = append(fp.uploads, string(data))
+		return fp.SSHCommand(args)
+	}
+}
+
+func (p *fakeProvisioner) SSHCommand(args string) (ssh.Output, error) {
+	p.commands = append(p.commands, args)
+	output := ssh.Output{
+		Stdout: &bytes.Buffer{},
+		Stderr: bytes.NewBufferString("script failed"),
+	}
+	if p.fail != "" && strings.Contains(args, p.fail) {
+		return output, errors.New("Process exited with: 1")
+	}
+	return output, nil
+}
+
+func TestRunHooks(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	script := filepath.Join(tmpDir, "setup.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$HOME\"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	crt := filepath.Join(tmpDir, "corp.crt")
+	if err := ioutil.WriteFile(crt, []byte("cert"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hookOptions := hooks.HookOptions{
+		Scripts: []hooks.Script{
+			{Phase: hooks.PostAuth, Path: script},
+			{Phase: hooks.PostSwarm, Path: script},
+		},
+		Files: []hooks.File{
+			{Phase: hooks.PostAuth, Source: crt, Destination: "/usr/local/share/ca-certificates/corp.crt"},
+		},
+	}
+
+	p := &fakeProvisioner{}
+	if err := runHooks(p, hookOptions, hooks.PostAuth); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.commands) != 5 {
+		t.Fatalf("expected 5 commands; received %v", p.commands)
+	}
+
+	if len(p.uploads) != 2 || p.uploads[0] != "cert" {
+		t.Fatalf("expected the file and script to be streamed; received %v", p.uploads)
+	}
+
+	expected := []string{
+		"mkdir -p '/tmp/docker-machine-hooks' && cat > '/tmp/docker-machine-hooks/upload'",
+		"sudo mkdir -p '/usr/local/share/ca-certificates' && sudo install -m 644 '/tmp/docker-machine-hooks/upload' '/usr/local/share/ca-certificates/corp.crt'",
+		"sudo install -m 700 '/tmp/docker-machine-hooks/upload' '/tmp/docker-machine-hooks/setup.sh'",
+		"sudo '/tmp/docker-machine-hooks/setup.sh'",
+	}
+	all := strings.Join(p.commands, "\n")
+	for _, e := range expected {
+		if strings.Index(all, e) == -1 {
+			t.Fatalf("expected commands to contain %q; received %s", e, all)
+		}
+	}
+
+	if strings.Index(p.commands[1], "corp.crt") == -1 {
+		t.Fatalf("expected files to be uploaded before scripts run; received %v", p.commands)
+	}
+}
+
+func TestRunHooksError(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	script := filepath.Join(tmpDir, "setup.sh")
+	if err := ioutil.WriteFile(script, []byte("exit 1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	hookOptions := hooks.HookOptions{
+		Scripts: []hooks.Script{
+			{Phase: hooks.PreInstall, Path: script},
+		},
+	}
+
+	p := &fakeProvisioner{fail: "sudo chmod +x"}
+	err = runHooks(p, hookOptions, hooks.PreInstall)
+	if err == nil {
+		t.Fatal("expected an error running the script")
+	}
+
+	if strings.Index(err.Error(), "script failed") == -1 {
+		t.Fatalf("expected the script output in the error; received %s", err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for s, expected := range map[string]string{
+		"/etc/docker/ca.pem": "'/etc/docker/ca.pem'",
+		"/tmp/my dir/it's":   `'/tmp/my dir/it'\''s'`,
+	} {
+		if quoted := shellQuote(s); quoted != expected {
+			t.Fatalf("expected %s; received %s", expected, quoted)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package provision
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/drivers"
+	"github.com/docker/machine/log"
+	"github.com/docker/machine/ssh"
+)
+
+const remoteInstallDir = "/tmp/docker-machine-install"
+
+// The static binary has no init configuration of its own; the job reads
+// the same daemon options file as the Ubuntu package.
+var dockerUpstartJob = `description "Docker daemon"
+
+start on (local-filesystems and net-device-up IFACE!=lo)
+stop on runlevel [!2345]
+respawn
+
+script
+	DOCKER=/usr/bin/docker
+	DOCKER_OPTS=
+	if [ -f /etc/default/docker ]; then
+		. /etc/default/docker
+	fi
+	exec "$DOCKER" -d $DOCKER_OPTS
+end script`
+
+// sshCommandWithInput runs the command on the host with its stdin read
+// from input; tests replace it as they have no host to connect to.
+var sshCommandWithInput = func(p Provisioner, args string, input io.Reader) (ssh.Output, error) {
+	return drivers.RunSSHCommandWithInputFromDriver(p.GetDriver(), args, input)
+}
+
+// streamFile copies a local file to dest on the host over the SSH
+// session's stdin, as packages and images are too large to be passed on
+// the command line.  dest must be writable by the SSH user.
+func streamFile(p Provisioner, src, dest string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	output, err := sshCommandWithInput(p, fmt.Sprintf("mkdir -p %s && cat > %s", shellQuote(path.Dir(dest)), shellQuote(dest)), f)
+	if err != nil {
+		var buf bytes.Buffer
+		if output.Stderr != nil {
+			buf.ReadFrom(output.Stderr)
+		}
+		return fmt.Errorf("error uploading %s: %s %s", src, err, buf.String())
+	}
+
+	return nil
+}
+
+// offlineInstallCommands returns the commands which install Docker from
+// the package or static binary uploaded to remotePath
+func offlineInstallCommands(localPath, remotePath string) []string {
+	if strings.HasSuffix(localPath, ".deb") {
+		return []string{
+			fmt.Sprintf("sudo dpkg -i %s", remotePath),
+		}
+	}
+
+	return []string{
+		fmt.Sprintf("sudo install -m 0755 %s /usr/bin/docker", remotePath),
+		fmt.Sprintf("if [ ! -f /etc/init/docker.conf ]; then sudo tee /etc/init/docker.conf > /dev/null <<'MACHINE_EOF'\n%s\nMACHINE_EOF\nfi", dockerUpstartJob),
+		"sudo service docker start",
+	}
+}
+
+// installDockerOffline uploads a local Docker package or static binary and
+// installs it, so that the host needs no outbound network access.
+func installDockerOffline(p Provisioner, localPath string) error {
+	if _, err := p.SSHCommand("type docker"); err == nil {
+		return nil
+	}
+
+	remotePath := path.Join(remoteInstallDir, filepath.Base(localPath))
+
+	log.Infof("Uploading %s...", localPath)
+
+	if err := streamFile(p, localPath, remotePath); err != nil {
+		return err
+	}
+
+	for _, command := range offlineInstallCommands(localPath, remotePath) {
+		if err := runCommand(p, command); err != nil {
+			return fmt.Errorf("error installing docker: %s", err)
+		}
+	}
+
+	return runCommand(p, fmt.Sprintf("rm -rf %s", remoteInstallDir))
+}
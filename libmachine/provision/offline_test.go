@@ -0,0 +1,63 @@
+package provision
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/swarm"
+)
+
+func TestOfflineInstallCommandsPackage(t *testing.T) {
+	commands := offlineInstallCommands("/tmp/cache/lxc-docker-1.6.2_1.6.2_amd64.deb", "/tmp/docker-machine-install/lxc-docker-1.6.2_1.6.2_amd64.deb")
+
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 command; received %v", commands)
+	}
+
+	expected := "sudo dpkg -i /tmp/docker-machine-install/lxc-docker-1.6.2_1.6.2_amd64.deb"
+	if commands[0] != expected {
+		t.Fatalf("expected %q; received %q", expected, commands[0])
+	}
+}
+
+func TestOfflineInstallCommandsBinary(t *testing.T) {
+	commands := offlineInstallCommands("/tmp/cache/docker-1.6.2", "/tmp/docker-machine-install/docker-1.6.2")
+
+	expected := []string{
+		"sudo install -m 0755 /tmp/docker-machine-install/docker-1.6.2 /usr/bin/docker",
+		"sudo tee /etc/init/docker.conf",
+		"sudo service docker start",
+	}
+
+	all := strings.Join(commands, "\n")
+	for _, e := range expected {
+		if strings.Index(all, e) == -1 {
+			t.Fatalf("expected commands to contain %q; received %s", e, all)
+		}
+	}
+}
+
+func TestSwarmCommandsImageArchive(t *testing.T) {
+	swarmOptions := swarm.SwarmOptions{
+		IsSwarm:      true,
+		Host:         "tcp://0.0.0.0:3376",
+		Discovery:    "token://test",
+		ImageArchive: "/tmp/cache/swarm.tar",
+	}
+
+	commands, err := swarmCommands("/etc/docker", swarm.Address{Host: "1.2.3.4", Port: 2376}, swarmOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "docker load -i /tmp/docker-machine-install/swarm.tar"
+	if commands[0] != expected {
+		t.Fatalf("expected %q; received %q", expected, commands[0])
+	}
+
+	for _, command := range commands {
+		if strings.Index(command, "docker pull") != -1 {
+			t.Fatalf("expected the image not to be pulled; received %v", commands)
+		}
+	}
+}
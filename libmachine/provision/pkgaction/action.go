@@ -6,12 +6,14 @@ const (
 	Restart ServiceAction = iota
 	Start
 	Stop
+	Reload
 )
 
 var serviceActions = []string{
 	"restart",
 	"start",
 	"stop",
+	"reload",
 }
 
 func (s ServiceAction) String() string {
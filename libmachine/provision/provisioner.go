@@ -7,6 +7,7 @@ import (
 	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/hooks"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/swarm"
 	"github.com/docker/machine/ssh"
@@ -25,6 +26,18 @@ type Provisioner interface {
 	// Return the auth options used to configure remote connection for the daemon.
 	GetAuthOptions() auth.AuthOptions
 
+	// Set the auth options used by actions outside of Provision, e.g.
+	// reissuing the server certificate.
+	SetAuthOptions(authOptions auth.AuthOptions)
+
+	// Set the engine options used by actions outside of Provision, e.g.
+	// the Docker version to upgrade to.
+	SetEngineOptions(engineOptions engine.EngineOptions)
+
+	// Return the engine options, e.g. to find the address the daemon
+	// listens on.
+	GetEngineOptions() engine.EngineOptions
+
 	// Run a package action e.g. install
 	Package(name string, action pkgaction.PackageAction) error
 
@@ -39,11 +52,14 @@ type Provisioner interface {
 
 	// Do the actual provisioning piece:
 	//     1. Set the hostname on the instance.
-	//     2. Install Docker if it is not present.
-	//     3. Configure the daemon to accept connections over TLS.
-	//     4. Copy the needed certificates to the server and local config dir.
-	//     5. Configure / activate swarm if applicable.
-	Provision(swarmOptions swarm.SwarmOptions, authOptions auth.AuthOptions, engineOptions engine.EngineOptions) error
+	//     2. Run the pre-install hooks.
+	//     3. Install Docker if it is not present.
+	//     4. Configure the daemon to accept connections over TLS.
+	//     5. Copy the needed certificates to the server and local config dir.
+	//     6. Run the post-auth hooks.
+	//     7. Configure / activate swarm if applicable.
+	//     8. Run the post-swarm hooks.
+	Provision(swarmOptions swarm.SwarmOptions, authOptions auth.AuthOptions, engineOptions engine.EngineOptions, hookOptions hooks.HookOptions) error
 
 	// Perform action on a named service e.g. stop
 	Service(name string, action pkgaction.ServiceAction) error
@@ -6,6 +6,7 @@ import (
 	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/hooks"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/swarm"
 	"github.com/docker/machine/log"
@@ -62,6 +63,14 @@ func (provisioner *UbuntuProvisioner) Package(name string, action pkgaction.Pack
 	switch name {
 	case "docker":
 		name = "lxc-docker"
+		if version := provisioner.EngineOptions.Version; version != "" {
+			// each release is a separate package which conflicts with
+			// the others, so installing one also handles downgrades
+			name = fmt.Sprintf("lxc-docker-%s", version)
+			if action == pkgaction.Upgrade {
+				packageAction = "install"
+			}
+		}
 	}
 
 	command := fmt.Sprintf("DEBIAN_FRONTEND=noninteractive sudo -E apt-get %s -y  %s", packageAction, name)
@@ -83,29 +92,39 @@ func (provisioner *UbuntuProvisioner) dockerDaemonResponding() bool {
 	return true
 }
 
-func (provisioner *UbuntuProvisioner) Provision(swarmOptions swarm.SwarmOptions, authOptions auth.AuthOptions, engineOptions engine.EngineOptions) error {
+func (provisioner *UbuntuProvisioner) Provision(swarmOptions swarm.SwarmOptions, authOptions auth.AuthOptions, engineOptions engine.EngineOptions, hookOptions hooks.HookOptions) error {
 	provisioner.SwarmOptions = swarmOptions
 	provisioner.AuthOptions = authOptions
-	provisioner.EngineOptions = engineOptions
-
-	if provisioner.EngineOptions.StorageDriver == "" {
-		provisioner.EngineOptions.StorageDriver = "aufs"
-	}
+	provisioner.SetEngineOptions(engineOptions)
 
 	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
 		return err
 	}
 
-	for _, pkg := range provisioner.Packages {
-		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
-			return err
+	// the packages are only needed to download Docker
+	if provisioner.EngineOptions.InstallPackage == "" {
+		for _, pkg := range provisioner.Packages {
+			if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+				return err
+			}
 		}
 	}
 
-	if err := installDockerGeneric(provisioner); err != nil {
+	if err := runHooks(provisioner, hookOptions, hooks.PreInstall); err != nil {
 		return err
 	}
 
+	if err := installDockerGeneric(provisioner, provisioner.EngineOptions); err != nil {
+		return err
+	}
+
+	if provisioner.EngineOptions.Version != "" && provisioner.EngineOptions.InstallPackage == "" {
+		log.Infof("Installing Docker %s...", provisioner.EngineOptions.Version)
+		if err := provisioner.Package("docker", pkgaction.Install); err != nil {
+			return err
+		}
+	}
+
 	if err := utils.WaitFor(provisioner.dockerDaemonResponding); err != nil {
 		return err
 	}
@@ -120,9 +139,17 @@ func (provisioner *UbuntuProvisioner) Provision(swarmOptions swarm.SwarmOptions,
 		return err
 	}
 
+	if err := runHooks(provisioner, hookOptions, hooks.PostAuth); err != nil {
+		return err
+	}
+
 	if err := configureSwarm(provisioner, swarmOptions); err != nil {
 		return err
 	}
 
+	if err := runHooks(provisioner, hookOptions, hooks.PostSwarm); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -4,28 +4,50 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/docker/machine/drivers"
 	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/swarm"
 	"github.com/docker/machine/log"
 	"github.com/docker/machine/utils"
 )
 
+var dockerVersionRegexp = regexp.MustCompile(`Docker version ([^,\s]+)`)
+
+const (
+	clusterStoreUnchecked = "unchecked"
+
+	// clusterStoreCheck connects to a host and port with nc, or with
+	// bash's /dev/tcp, printing clusterStoreUnchecked if it can do neither
+	clusterStoreCheck = "if command -v nc >/dev/null; then nc -w 5 %s %s </dev/null; " +
+		"elif command -v bash >/dev/null && command -v timeout >/dev/null; then timeout 5 bash -c '</dev/tcp/%s/%s'; " +
+		"else echo " + clusterStoreUnchecked + "; fi"
+)
+
 type DockerOptions struct {
 	EngineOptions     string
 	EngineOptionsPath string
 }
 
-func installDockerGeneric(p Provisioner) error {
+func installDockerGeneric(p Provisioner, engineOptions engine.EngineOptions) error {
+	if engineOptions.InstallPackage != "" {
+		return installDockerOffline(p, engineOptions.InstallPackage)
+	}
+
 	// install docker - until cloudinit we use ubuntu everywhere so we
 	// just install it using the docker repos
-	if output, err := p.SSHCommand("if ! type docker; then curl -sSL https://get.docker.com | sh -; fi"); err != nil {
+	if output, err := p.SSHCommand(fmt.Sprintf("if ! type docker; then curl -sSL %s | sh -; fi", engineOptions.GetInstallURL())); err != nil {
 		var buf bytes.Buffer
 		if _, err := buf.ReadFrom(output.Stderr); err != nil {
 			return err
@@ -37,6 +59,32 @@ func installDockerGeneric(p Provisioner) error {
 	return nil
 }
 
+// GetDockerVersion returns the version of Docker installed on the host
+func GetDockerVersion(p Provisioner) (string, error) {
+	output, err := p.SSHCommand("docker --version")
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(output.Stdout); err != nil {
+		return "", err
+	}
+
+	return parseDockerVersion(buf.String())
+}
+
+// parseDockerVersion extracts the version from the output of
+// `docker --version`, e.g. "Docker version 1.6.2, build 7c8fca2"
+func parseDockerVersion(output string) (string, error) {
+	matches := dockerVersionRegexp.FindStringSubmatch(output)
+	if matches == nil {
+		return "", fmt.Errorf("unable to parse Docker version from %q", strings.TrimSpace(output))
+	}
+
+	return matches[1], nil
+}
+
 func makeDockerOptionsDir(p Provisioner) error {
 	dockerDir := p.GetDockerOptionsDir()
 	if _, err := p.SSHCommand(fmt.Sprintf("sudo mkdir -p %s", dockerDir)); err != nil {
@@ -47,9 +95,10 @@ func makeDockerOptionsDir(p Provisioner) error {
 }
 
 func setRemoteAuthOptions(p Provisioner) auth.AuthOptions {
-	dockerDir := p.GetDockerOptionsDir()
-	authOptions := p.GetAuthOptions()
+	return remoteAuthOptions(p.GetDockerOptionsDir(), p.GetAuthOptions())
+}
 
+func remoteAuthOptions(dockerDir string, authOptions auth.AuthOptions) auth.AuthOptions {
 	// due to windows clients, we cannot use filepath.Join as the paths
 	// will be mucked on the linux hosts
 	authOptions.CaCertRemotePath = path.Join(dockerDir, "ca.pem")
@@ -59,17 +108,163 @@ func setRemoteAuthOptions(p Provisioner) auth.AuthOptions {
 	return authOptions
 }
 
-func ConfigureAuth(p Provisioner) error {
-	var (
-		err error
-	)
+// caCertificates returns the CA certificates the daemon and clients trust:
+// the CA with its chain, followed by any CA trusted during a CA rotation.
+func caCertificates(authOptions auth.AuthOptions) ([]byte, error) {
+	caCerts, err := utils.ReadCACertificates(authOptions.CaCertPath, authOptions.CaChainPath)
+	if err != nil {
+		return nil, err
+	}
 
-	machineName := p.GetDriver().GetMachineName()
-	authOptions := p.GetAuthOptions()
-	org := machineName
-	bits := 2048
+	for _, trusted := range authOptions.TrustedCaCertPaths {
+		data, err := ioutil.ReadFile(trusted)
+		if err != nil {
+			return nil, err
+		}
 
-	ip, err := p.GetDriver().GetIP()
+		if len(caCerts) > 0 && caCerts[len(caCerts)-1] != '\n' {
+			caCerts = append(caCerts, '\n')
+		}
+		caCerts = append(caCerts, data...)
+	}
+
+	return caCerts, nil
+}
+
+// clientCaCertificates returns the CAs of the client certificates issued
+// for users with `certs issue-client`, leaving out those which were revoked.
+func clientCaCertificates() ([]byte, error) {
+	revocationList, err := auth.LoadRevocationList(utils.GetRevocationListPath())
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(utils.GetClientCaDir(), "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	caCerts := []byte{}
+	for _, caPath := range paths {
+		serial, err := utils.GetCertificateSerial(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client CA %s: %s", caPath, err)
+		}
+
+		if revocationList.IsSerialRevoked(serial.String()) {
+			log.Debugf("Leaving out revoked client CA %s", caPath)
+			continue
+		}
+
+		data, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(caCerts) > 0 && caCerts[len(caCerts)-1] != '\n' {
+			caCerts = append(caCerts, '\n')
+		}
+		caCerts = append(caCerts, data...)
+	}
+
+	return caCerts, nil
+}
+
+// daemonCaCertificates returns the CA bundle the daemon verifies clients
+// with: the CA certificates and the CAs of the users' client certificates.
+func daemonCaCertificates(authOptions auth.AuthOptions) ([]byte, error) {
+	caCerts, err := caCertificates(authOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCaCerts, err := clientCaCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(clientCaCerts) == 0 {
+		return caCerts, nil
+	}
+
+	if len(caCerts) > 0 && caCerts[len(caCerts)-1] != '\n' {
+		caCerts = append(caCerts, '\n')
+	}
+
+	return append(caCerts, clientCaCerts...), nil
+}
+
+// ReloadCACertificates uploads the CA bundle to the host and reloads the
+// daemon, which then trusts the client CAs in it.  Unlike ConfigureAuth
+// the server certificate is left as it is.
+func ReloadCACertificates(p Provisioner) error {
+	authOptions := setRemoteAuthOptions(p)
+
+	caCert, err := daemonCaCertificates(authOptions)
+	if err != nil {
+		return err
+	}
+
+	if _, err := sshCommandWithInput(p, fmt.Sprintf("sudo tee %s >/dev/null", shellQuote(authOptions.CaCertRemotePath)), bytes.NewReader(caCert)); err != nil {
+		return err
+	}
+
+	return p.Service("docker", pkgaction.Reload)
+}
+
+// serverCertHosts returns the addresses the server certificate is issued
+// for: the machine's IP, name and SSH hostname, localhost for tunnels, the
+// driver's private IP and any extra SANs, without duplicates.
+func serverCertHosts(d drivers.Driver, authOptions auth.AuthOptions) ([]string, error) {
+	ip, err := d.GetIP()
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := []string{ip, d.GetMachineName(), "localhost", "127.0.0.1"}
+
+	if sshHostname, err := d.GetSSHHostname(); err == nil {
+		hosts = append(hosts, sshHostname)
+	}
+
+	if privateIPDriver, ok := d.(drivers.PrivateIPDriver); ok {
+		privateIP, err := privateIPDriver.GetPrivateIP()
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, privateIP)
+	}
+
+	hosts = append(hosts, authOptions.ServerCertSANs...)
+
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, h := range hosts {
+		if h == "" || seen[h] {
+			continue
+		}
+		seen[h] = true
+		unique = append(unique, h)
+	}
+
+	return unique, nil
+}
+
+// generateServerCert copies the client certificates to the machine dir
+// and generates a server certificate for the machine's IP.
+func generateServerCert(d drivers.Driver, authOptions auth.AuthOptions) error {
+	machineName := d.GetMachineName()
+	certOptions := utils.CertOptions{
+		Org:          authOptions.CertOrg,
+		KeyAlgorithm: authOptions.KeyAlgorithm,
+		KeySize:      authOptions.KeySize,
+		ValidityDays: authOptions.CertValidityDays,
+	}
+	if certOptions.Org == "" {
+		certOptions.Org = machineName
+	}
+
+	hosts, err := serverCertHosts(d, authOptions)
 	if err != nil {
 		return err
 	}
@@ -77,7 +272,12 @@ func ConfigureAuth(p Provisioner) error {
 	// copy certs to client dir for docker client
 	machineDir := filepath.Join(utils.GetMachineDir(), machineName)
 
-	if err := utils.CopyFile(authOptions.CaCertPath, filepath.Join(machineDir, "ca.pem")); err != nil {
+	caCert, err := caCertificates(authOptions)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(machineDir, "ca.pem"), caCert, 0644); err != nil {
 		log.Fatalf("Error copying ca.pem to machine dir: %s", err)
 	}
 
@@ -89,34 +289,68 @@ func ConfigureAuth(p Provisioner) error {
 		log.Fatalf("Error copying key.pem to machine dir: %s", err)
 	}
 
-	log.Debugf("generating server cert: %s ca-key=%s private-key=%s org=%s",
+	log.Debugf("generating server cert: %s ca-key=%s private-key=%s org=%s hosts=%v",
 		authOptions.ServerCertPath,
 		authOptions.CaCertPath,
 		authOptions.PrivateKeyPath,
-		org,
+		certOptions.Org,
+		hosts,
 	)
 
+	if authOptions.SignerCommand != "" || authOptions.SignerURL != "" {
+		signer, err := utils.NewCertSigner(authOptions.SignerCommand, authOptions.SignerURL)
+		if err != nil {
+			return err
+		}
+
+		if err := utils.GenerateCertWithSigner(hosts, authOptions.ServerCertPath, authOptions.ServerKeyPath, certOptions, signer); err != nil {
+			return fmt.Errorf("error generating server cert: %s", err)
+		}
+
+		return nil
+	}
+
 	// TODO: Switch to passing just authOptions to this func
 	// instead of all these individual fields
 	err = utils.GenerateCert(
-		[]string{ip},
+		hosts,
 		authOptions.ServerCertPath,
 		authOptions.ServerKeyPath,
 		authOptions.CaCertPath,
 		authOptions.PrivateKeyPath,
-		org,
-		bits,
+		certOptions,
 	)
 	if err != nil {
 		return fmt.Errorf("error generating server cert: %s", err)
 	}
 
+	return nil
+}
+
+func ConfigureAuth(p Provisioner) error {
+	var (
+		err error
+	)
+
+	// the remote paths are needed by the daemon options as well
+	authOptions := setRemoteAuthOptions(p)
+	p.SetAuthOptions(authOptions)
+
+	ip, err := p.GetDriver().GetIP()
+	if err != nil {
+		return err
+	}
+
+	if err := generateServerCert(p.GetDriver(), authOptions); err != nil {
+		return err
+	}
+
 	if err := p.Service("docker", pkgaction.Stop); err != nil {
 		return err
 	}
 
 	// upload certs and configure TLS auth
-	caCert, err := ioutil.ReadFile(authOptions.CaCertPath)
+	caCert, err := daemonCaCertificates(authOptions)
 	if err != nil {
 		return err
 	}
@@ -125,7 +359,7 @@ func ConfigureAuth(p Provisioner) error {
 	if err != nil {
 		return err
 	}
-	serverKey, err := ioutil.ReadFile(authOptions.ServerKeyPath)
+	serverKey, err := utils.ReadSecretFile(authOptions.ServerKeyPath)
 	if err != nil {
 		return err
 	}
@@ -138,97 +372,492 @@ func ConfigureAuth(p Provisioner) error {
 		return err
 	}
 
-	if _, err := p.SSHCommand(fmt.Sprintf("echo \"%s\" | sudo tee %s", string(serverKey), authOptions.ServerKeyRemotePath)); err != nil {
+	// the key is sent over stdin to keep it out of the host's process list
+	if _, err := sshCommandWithInput(p, fmt.Sprintf("sudo tee %s >/dev/null", shellQuote(authOptions.ServerKeyRemotePath)), bytes.NewReader(serverKey)); err != nil {
 		return err
 	}
 
-	dockerUrl, err := p.GetDriver().GetURL()
+	dockerPort, err := getDockerPort(p)
 	if err != nil {
 		return err
 	}
-	u, err := url.Parse(dockerUrl)
+
+	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
 	if err != nil {
 		return err
 	}
-	dockerPort := 2376
-	parts := strings.Split(u.Host, ":")
-	if len(parts) == 2 {
-		dPort, err := strconv.Atoi(parts[1])
+
+	if err := appendDockerOptions(p, dkrcfg); err != nil {
+		return err
+	}
+
+	if err := p.Service("docker", pkgaction.Start); err != nil {
+		return err
+	}
+
+	if err := waitForDocker(p, ip, dockerPort); err != nil {
+		return err
+	}
+
+	if dockerPort == 0 {
+		return allowSocketAccess(p)
+	}
+
+	return nil
+}
+
+// appendDockerOptions appends the daemon options to their file on the host.
+// They are sent over stdin rather than echoed, so the shell on the host
+// does not expand the quoted values in them.
+func appendDockerOptions(p Provisioner, dockerOptions *DockerOptions) error {
+	_, err := sshCommandWithInput(p, fmt.Sprintf("sudo tee -a %s >/dev/null", shellQuote(dockerOptions.EngineOptionsPath)), strings.NewReader(dockerOptions.EngineOptions))
+	return err
+}
+
+// getDockerPort returns the daemon port: the engine's port option, or the
+// port from the driver's URL, falling back to the default of 2376.  It
+// returns 0 if the daemon's TCP socket is disabled.
+func getDockerPort(p Provisioner) (int, error) {
+	engineOptions := p.GetEngineOptions()
+	if engineOptions.DisableTCP {
+		return 0, nil
+	}
+
+	if engineOptions.Port != 0 {
+		return engineOptions.Port, nil
+	}
+
+	dockerUrl, err := p.GetDriver().GetURL()
+	if err != nil {
+		return 0, err
+	}
+	u, err := url.Parse(dockerUrl)
+	if err != nil {
+		return 0, err
+	}
+	// SplitHostPort fails if there is no port, and copes with IPv6 hosts
+	_, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return engine.DefaultPort, nil
+	}
+
+	return strconv.Atoi(port)
+}
+
+// dockerListenAddress returns the host:port the daemon's TCP socket binds
+// to, or an empty string if dockerPort is 0, i.e. TCP is disabled.
+func dockerListenAddress(engineOptions engine.EngineOptions, d drivers.Driver, dockerPort int) (string, error) {
+	if dockerPort == 0 {
+		return "", nil
+	}
+
+	bindAddress, err := engineOptions.GetBindAddress(d)
+	if err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(bindAddress, strconv.Itoa(dockerPort)), nil
+}
+
+// waitForDocker waits for the daemon to come up.  The TCP socket is only
+// dialed if it listens on the IP the driver reports; otherwise the daemon
+// is asked over SSH.
+func waitForDocker(p Provisioner, ip string, dockerPort int) error {
+	if dockerPort != 0 && p.GetEngineOptions().BindsAllInterfaces() {
+		return utils.WaitForDocker(ip, dockerPort)
+	}
+
+	return waitForDockerOverSSH(p)
+}
+
+func waitForDockerOverSSH(p Provisioner) error {
+	return utils.WaitFor(func() bool {
+		if _, err := p.SSHCommand("sudo docker version"); err != nil {
+			log.Debugf("Daemon not responding yet: %s", err)
+			return false
+		}
+		return true
+	})
+}
+
+// engineLabels returns the daemon's labels: those given, the provider and
+// those the driver supplies.  A label given is not overridden, and one
+// added before is not added again, as GenerateDockerOptions may run twice.
+func engineLabels(engineOptions engine.EngineOptions, d drivers.Driver) ([]string, error) {
+	labels := append([]string{}, engineOptions.Labels...)
+	driverLabels := map[string]string{
+		"provider": d.DriverName(),
+	}
+
+	if labelDriver, ok := d.(drivers.EngineLabelDriver); ok && !engineOptions.DisableDriverLabels {
+		metadata, err := labelDriver.GetEngineLabels()
 		if err != nil {
-			return err
+			return nil, err
+		}
+		for key, value := range metadata {
+			if value != "" {
+				driverLabels[key] = value
+			}
 		}
-		dockerPort = dPort
 	}
 
-	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
+	keys := []string{}
+	for key := range driverLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !hasLabel(labels, key) {
+			labels = append(labels, fmt.Sprintf("%s=%s", key, driverLabels[key]))
+		}
+	}
+
+	return labels, nil
+}
+
+func hasLabel(labels []string, key string) bool {
+	for _, label := range labels {
+		if strings.SplitN(label, "=", 2)[0] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// dockerNodeAddress returns the address other nodes, e.g. the swarm
+// master, reach the daemon at
+func dockerNodeAddress(p Provisioner, ip string, dockerPort int) (swarm.Address, error) {
+	engineOptions := p.GetEngineOptions()
+	if !engineOptions.BindsAllInterfaces() {
+		bindAddress, err := engineOptions.GetBindAddress(p.GetDriver())
+		if err != nil {
+			return swarm.Address{}, err
+		}
+		ip = bindAddress
+	}
+
+	return swarm.Address{Host: ip, Port: dockerPort}, nil
+}
+
+// allowSocketAccess adds the SSH user to the docker group, so that the
+// daemon's unix socket can be forwarded when TCP is disabled
+func allowSocketAccess(p Provisioner) error {
+	_, err := p.SSHCommand("id -nG | grep -qw docker || sudo usermod -a -G docker $(id -un)")
+	return err
+}
+
+// swarmCommands returns the commands which pull the swarm image and start
+// the master (if applicable) and node agents.  The commands are meant to be
+// run as root on the host.
+func swarmCommands(dockerDir string, nodeAddr swarm.Address, swarmOptions swarm.SwarmOptions) ([]string, error) {
+	tlsCaCert := swarmOptions.TlsCaCert
+	if tlsCaCert == "" {
+		tlsCaCert = path.Join(dockerDir, "ca.pem")
+	}
+	tlsCert := swarmOptions.TlsCert
+	if tlsCert == "" {
+		tlsCert = path.Join(dockerDir, "server.pem")
+	}
+	tlsKey := swarmOptions.TlsKey
+	if tlsKey == "" {
+		tlsKey = path.Join(dockerDir, "server-key.pem")
+	}
+
+	listenAddr, err := swarmOptions.ListenAddress()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	masterArgs := []string{
+		"--tlsverify",
+		fmt.Sprintf("--tlscacert=%s", tlsCaCert),
+		fmt.Sprintf("--tlscert=%s", tlsCert),
+		fmt.Sprintf("--tlskey=%s", tlsKey),
+		fmt.Sprintf("-H %s", listenAddr.URL()),
+	}
+	if swarmOptions.Replication {
+		if !swarm.IsKVDiscovery(swarmOptions.Discovery) {
+			return nil, fmt.Errorf("swarm master replication needs a KV store discovery, not %s", swarmOptions.Discovery)
+		}
+
+		// the replicas reach the primary at the node's address
+		advertiseAddr := swarm.Address{Host: nodeAddr.Host, Port: listenAddr.Port}
+		masterArgs = append(masterArgs, "--replication", fmt.Sprintf("--advertise %s", advertiseAddr))
 	}
+	if swarmOptions.Strategy != "" {
+		masterArgs = append(masterArgs, fmt.Sprintf("--strategy %s", swarmOptions.Strategy))
+	}
+	if swarmOptions.Heartbeat != 0 {
+		masterArgs = append(masterArgs, fmt.Sprintf("--heartbeat=%ds", swarmOptions.Heartbeat))
+	}
+	if swarmOptions.Overcommit != 0 {
+		masterArgs = append(masterArgs, fmt.Sprintf("--cluster-opt swarm.overcommit=%g", swarmOptions.Overcommit))
+	}
+	for _, flag := range swarmOptions.ArbitraryFlags {
+		masterArgs = append(masterArgs, fmt.Sprintf("--%s", flag))
+	}
+	masterArgs = append(masterArgs, swarmOptions.Discovery)
+
+	nodeArgs := []string{
+		fmt.Sprintf("--addr %s", nodeAddr),
+	}
+	if swarmOptions.Heartbeat != 0 {
+		nodeArgs = append(nodeArgs, fmt.Sprintf("--heartbeat=%ds", swarmOptions.Heartbeat))
+	}
+	nodeArgs = append(nodeArgs, swarmOptions.Discovery)
 
-	if _, err = p.SSHCommand(fmt.Sprintf("echo \"%s\" | sudo tee -a %s", dkrcfg.EngineOptions, dkrcfg.EngineOptionsPath)); err != nil {
+	image := swarmOptions.GetImage()
+	commands := []string{
+		fmt.Sprintf("docker pull %s", image),
+	}
+
+	// the image is loaded from the archive uploaded by configureSwarm
+	if swarmOptions.ImageArchive != "" {
+		commands = []string{
+			fmt.Sprintf("docker load -i %s", remoteSwarmArchivePath(swarmOptions)),
+		}
+	}
+
+	// if master start master agent
+	if swarmOptions.Master {
+		log.Debugf("master args: %s", strings.Join(masterArgs, " "))
+		commands = append(commands, fmt.Sprintf("docker run -d -p %d:%d --restart=always --name swarm-agent-master -v %s:%s %s manage %s",
+			listenAddr.Port, listenAddr.Port, dockerDir, dockerDir, image, strings.Join(masterArgs, " ")))
+	}
+
+	// start node agent, unless the master finds the nodes itself
+	if swarm.RegistersNodes(swarmOptions.Discovery) {
+		log.Debugf("node args: %s", strings.Join(nodeArgs, " "))
+		commands = append(commands, fmt.Sprintf("docker run -d --restart=always --name swarm-agent -v %s:%s %s join %s",
+			dockerDir, dockerDir, image, strings.Join(nodeArgs, " ")))
+	}
+
+	return commands, nil
+}
+
+func remoteSwarmArchivePath(swarmOptions swarm.SwarmOptions) string {
+	return path.Join(remoteInstallDir, filepath.Base(swarmOptions.ImageArchive))
+}
+
+func configureSwarm(p Provisioner, swarmOptions swarm.SwarmOptions) error {
+	if err := startSwarm(p, swarmOptions, true); err != nil {
 		return err
 	}
 
-	if err := p.Service("docker", pkgaction.Start); err != nil {
+	// the KV store of the first machine of a cluster is up only now
+	if clusterStore := p.GetEngineOptions().ClusterStore; clusterStore != "" {
+		return checkClusterStore(p, clusterStore)
+	}
+
+	return nil
+}
+
+// checkClusterStore checks the host can connect to the daemon's cluster
+// store, without which overlay networks fail.  The check uses nc, or bash
+// if nc is missing, and is skipped with a warning if neither is installed.
+func checkClusterStore(p Provisioner, clusterStore string) error {
+	u, err := url.Parse(clusterStore)
+	if err != nil {
 		return err
 	}
 
-	// TODO: Do not hardcode daemon port, ask the driver
-	if err := utils.WaitForDocker(ip, dockerPort); err != nil {
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return fmt.Errorf("invalid cluster store %s: %s", clusterStore, err)
+	}
+
+	log.Debugf("checking the cluster store %s is reachable", clusterStore)
+	output, err := p.SSHCommand(fmt.Sprintf(clusterStoreCheck, host, port, host, port))
+	if err != nil {
+		return fmt.Errorf("the cluster store %s is not reachable from the machine; check the firewall allows port %s: %s", clusterStore, port, err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(output.Stdout); err != nil {
 		return err
 	}
 
+	if strings.TrimSpace(buf.String()) == clusterStoreUnchecked {
+		log.Warnf("Unable to check the cluster store %s is reachable: the machine has neither nc nor bash", clusterStore)
+	}
+
 	return nil
 }
 
-func configureSwarm(p Provisioner, swarmOptions swarm.SwarmOptions) error {
+// ReconfigureSwarm replaces the swarm containers of a provisioned host, e.g.
+// after the cluster's discovery changed.  The image and KV store are left
+// as they are.
+func ReconfigureSwarm(p Provisioner, swarmOptions swarm.SwarmOptions) error {
+	if err := LeaveSwarm(p); err != nil {
+		return err
+	}
+
+	return startSwarm(p, swarmOptions, false)
+}
+
+// JoinSwarm replaces the swarm containers of a provisioned host, pulling
+// the image first, or loading it from the image archive as at create, e.g.
+// to add it to a cluster
+func JoinSwarm(p Provisioner, swarmOptions swarm.SwarmOptions) error {
+	if swarmOptions.ImageArchive != "" {
+		if _, err := os.Stat(swarmOptions.ImageArchive); err != nil {
+			return fmt.Errorf("error reading the swarm image archive: %s", err)
+		}
+	}
+
+	if err := LeaveSwarm(p); err != nil {
+		return err
+	}
+
+	// a KV store is only started when the cluster is created
+	swarmOptions.KVStore = ""
+
+	return startSwarm(p, swarmOptions, true)
+}
+
+// LeaveSwarm removes the swarm containers of a host
+func LeaveSwarm(p Provisioner) error {
+	_, err := p.SSHCommand("sudo docker rm -f swarm-agent-master swarm-agent || true")
+	return err
+}
+
+// SwarmStatus is the state of the swarm containers on a host: running,
+// restarting, stopped or missing
+type SwarmStatus struct {
+	Agent  string
+	Master string
+}
+
+// GetSwarmStatus inspects the swarm containers of a host
+func GetSwarmStatus(p Provisioner) (SwarmStatus, error) {
+	output, err := p.SSHCommand("sudo docker inspect -f '{{.Name}} {{.State.Running}} {{.State.Restarting}}' swarm-agent swarm-agent-master 2>/dev/null || true")
+	if err != nil {
+		return SwarmStatus{}, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(output.Stdout); err != nil {
+		return SwarmStatus{}, err
+	}
+
+	return parseSwarmStatus(buf.String()), nil
+}
+
+func parseSwarmStatus(output string) SwarmStatus {
+	status := SwarmStatus{
+		Agent:  "missing",
+		Master: "missing",
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+
+		state := "stopped"
+		if fields[2] == "true" {
+			state = "restarting"
+		} else if fields[1] == "true" {
+			state = "running"
+		}
+
+		switch fields[0] {
+		case "/swarm-agent":
+			status.Agent = state
+		case "/swarm-agent-master":
+			status.Master = state
+		}
+	}
+
+	return status
+}
+
+// startSwarm starts the swarm containers, and if install is set, installs
+// the image and starts the KV store first
+func startSwarm(p Provisioner, swarmOptions swarm.SwarmOptions, install bool) error {
 	if !swarmOptions.IsSwarm {
 		return nil
 	}
 
-	basePath := p.GetDockerOptionsDir()
 	ip, err := p.GetDriver().GetIP()
 	if err != nil {
 		return err
 	}
 
-	tlsCaCert := path.Join(basePath, "ca.pem")
-	tlsCert := path.Join(basePath, "server.pem")
-	tlsKey := path.Join(basePath, "server-key.pem")
-	masterArgs := fmt.Sprintf("--tlsverify --tlscacert=%s --tlscert=%s --tlskey=%s -H %s %s",
-		tlsCaCert, tlsCert, tlsKey, swarmOptions.Host, swarmOptions.Discovery)
-	nodeArgs := fmt.Sprintf("--addr %s:2376 %s", ip, swarmOptions.Discovery)
+	dockerPort, err := getDockerPort(p)
+	if err != nil {
+		return err
+	}
+
+	if dockerPort == 0 {
+		return fmt.Errorf("swarm requires the daemon's TCP socket")
+	}
+
+	dockerAddr, err := dockerNodeAddress(p, ip, dockerPort)
+	if err != nil {
+		return err
+	}
 
-	u, err := url.Parse(swarmOptions.Host)
+	nodeAddr, err := swarmOptions.AdvertiseAddress(p.GetDriver(), dockerAddr)
 	if err != nil {
 		return err
 	}
 
-	parts := strings.Split(u.Host, ":")
-	port := parts[1]
+	// the master connects to the nodes with the daemon's certificates
+	authOptions := setRemoteAuthOptions(p)
+	if swarmOptions.TlsCaCert == "" {
+		swarmOptions.TlsCaCert = authOptions.CaCertRemotePath
+	}
+	if swarmOptions.TlsCert == "" {
+		swarmOptions.TlsCert = authOptions.ServerCertRemotePath
+	}
+	if swarmOptions.TlsKey == "" {
+		swarmOptions.TlsKey = authOptions.ServerKeyRemotePath
+	}
 
-	if _, err := p.SSHCommand(fmt.Sprintf("sudo docker pull %s", swarm.DockerImage)); err != nil {
+	commands, err := swarmCommands(p.GetDockerOptionsDir(), nodeAddr, swarmOptions)
+	if err != nil {
 		return err
 	}
 
-	dockerDir := p.GetDockerOptionsDir()
+	if !install {
+		// skip pulling or loading the image
+		commands = commands[1:]
+	} else if swarmOptions.KVStore != "" {
+		kvIP, err := swarm.KVStoreIP(p.GetDriver())
+		if err != nil {
+			return err
+		}
 
-	// if master start master agent
-	if swarmOptions.Master {
-		log.Debug("launching swarm master")
-		log.Debugf("master args: %s", masterArgs)
-		if _, err = p.SSHCommand(fmt.Sprintf("sudo docker run -d -p %s:%s --restart=always --name swarm-agent-master -v %s:%s %s manage %s",
-			port, port, dockerDir, dockerDir, swarm.DockerImage, masterArgs)); err != nil {
+		kvCommands, err := swarm.KVStoreCommands(swarmOptions.KVStore, kvIP)
+		if err != nil {
 			return err
 		}
+
+		log.Infof("Starting the %s discovery store...", swarmOptions.KVStore)
+		commands = append(kvCommands, commands...)
 	}
 
-	// start node agent
-	log.Debug("launching swarm node")
-	log.Debugf("node args: %s", nodeArgs)
-	if _, err = p.SSHCommand(fmt.Sprintf("sudo docker run -d --restart=always --name swarm-agent -v %s:%s %s join %s",
-		dockerDir, dockerDir, swarm.DockerImage, nodeArgs)); err != nil {
-		return err
+	if install && swarmOptions.ImageArchive != "" {
+		log.Infof("Uploading %s...", swarmOptions.ImageArchive)
+		if err := streamFile(p, swarmOptions.ImageArchive, remoteSwarmArchivePath(swarmOptions)); err != nil {
+			return err
+		}
+	}
+
+	log.Debug("launching swarm")
+	for _, command := range commands {
+		if _, err := p.SSHCommand(fmt.Sprintf("sudo %s", command)); err != nil {
+			return err
+		}
+	}
+
+	if install && swarmOptions.ImageArchive != "" {
+		if _, err := p.SSHCommand(fmt.Sprintf("rm -rf %s", remoteInstallDir)); err != nil {
+			return err
+		}
 	}
 
 	return nil
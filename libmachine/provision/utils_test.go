@@ -2,12 +2,19 @@ package provision
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/docker/machine/drivers/fakedriver"
 	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/swarm"
+	"github.com/docker/machine/utils"
 )
 
 func TestGenerateDockerOptionsBoot2Docker(t *testing.T) {
@@ -48,6 +55,342 @@ func TestGenerateDockerOptionsBoot2Docker(t *testing.T) {
 	}
 }
 
+func TestGenerateDockerOptionsClusterStore(t *testing.T) {
+	p := &GenericProvisioner{
+		Driver: &fakedriver.FakeDriver{},
+	}
+	p.EngineOptions = engine.EngineOptions{
+		ClusterStore:     "consul://10.0.0.1:8500",
+		ClusterAdvertise: "10.0.0.2:2376",
+	}
+
+	dockerCfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, option := range []string{"--cluster-store consul://10.0.0.1:8500", "--cluster-advertise 10.0.0.2:2376"} {
+		if strings.Index(dockerCfg.EngineOptions, option) == -1 {
+			t.Fatalf("expected engine options to contain %q; received %s", option, dockerCfg.EngineOptions)
+		}
+	}
+}
+
+type labelDriver struct {
+	fakedriver.FakeDriver
+}
+
+func (d *labelDriver) GetEngineLabels() (map[string]string, error) {
+	return map[string]string{
+		"region":       "us-east-1",
+		"instancetype": "m3.medium",
+		"zone":         "",
+	}, nil
+}
+
+func TestEngineLabels(t *testing.T) {
+	engineOptions := engine.EngineOptions{
+		Labels: []string{"region=eu-west-1", "env=test"},
+	}
+
+	labels, err := engineLabels(engineOptions, &labelDriver{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"region=eu-west-1", "env=test", "instancetype=m3.medium", "provider=fakedriver"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Fatalf("expected labels %v; received %v", expected, labels)
+	}
+
+	// the labels of an earlier run are kept as they are
+	engineOptions.Labels = labels
+	if labels, err = engineLabels(engineOptions, &labelDriver{}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Fatalf("expected labels %v to be added once; received %v", expected, labels)
+	}
+
+	engineOptions = engine.EngineOptions{DisableDriverLabels: true}
+	if labels, err = engineLabels(engineOptions, &labelDriver{}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(labels, []string{"provider=fakedriver"}) {
+		t.Fatalf("expected only the provider label; received %v", labels)
+	}
+}
+
+func TestGenerateDockerOptionsBoot2DockerEngineOptions(t *testing.T) {
+	p := &Boot2DockerProvisioner{
+		Driver: &fakedriver.FakeDriver{},
+	}
+	p.EngineOptions = engine.EngineOptions{
+		ArbitraryFlags: []string{"log-driver=syslog"},
+		Dns:            []string{"8.8.8.8", "8.8.4.4"},
+		Env:            []string{"HTTP_PROXY=http://proxy.local:3128", "NO_PROXY=a b;$(reboot)"},
+		GraphDir:       "/mnt/docker",
+		Ipv6:           true,
+		LogLevel:       "debug",
+		SelinuxEnabled: true,
+	}
+
+	dockerCfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"--dns 8.8.8.8\n",
+		"--dns 8.8.4.4\n",
+		"--graph /mnt/docker\n",
+		"--ipv6\n",
+		"--log-level debug\n",
+		"--selinux-enabled\n",
+		"--log-driver=syslog\n",
+		"export HTTP_PROXY='http://proxy.local:3128'\n",
+		"export NO_PROXY='a b;$(reboot)'\n",
+	}
+
+	for _, e := range expected {
+		if strings.Index(dockerCfg.EngineOptions, e) == -1 {
+			t.Fatalf("expected engine config to contain %q; received %s", e, dockerCfg.EngineOptions)
+		}
+	}
+}
+
+func TestGenerateDockerOptionsBoot2DockerEngineDefaults(t *testing.T) {
+	p := &Boot2DockerProvisioner{
+		Driver: &fakedriver.FakeDriver{},
+	}
+
+	dockerCfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, unexpected := range []string{"--dns", "--graph", "--ipv6", "--log-level", "--selinux-enabled", "export"} {
+		if strings.Index(dockerCfg.EngineOptions, unexpected) != -1 {
+			t.Fatalf("expected engine config not to contain %q; received %s", unexpected, dockerCfg.EngineOptions)
+		}
+	}
+}
+
+func TestGenerateDockerOptionsUbuntu(t *testing.T) {
+	p := NewUbuntuProvisioner(&fakedriver.FakeDriver{}).(*UbuntuProvisioner)
+	p.AuthOptions = auth.AuthOptions{
+		CaCertRemotePath:     "/test/ca-cert",
+		ServerKeyRemotePath:  "/test/server-key",
+		ServerCertRemotePath: "/test/server-cert",
+	}
+	p.EngineOptions = engine.EngineOptions{
+		ArbitraryFlags: []string{"log-driver=syslog"},
+		Dns:            []string{"8.8.8.8"},
+		Env:            []string{"HTTP_PROXY=http://proxy.local:3128", "GREETING=it's"},
+		GraphDir:       "/mnt/docker",
+		Ipv6:           true,
+		LogLevel:       "debug",
+		SelinuxEnabled: true,
+		StorageDriver:  "aufs",
+	}
+
+	dockerCfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dockerCfg.EngineOptionsPath != "/etc/default/docker" {
+		t.Fatalf("expected engine path /etc/default/docker; received %s", dockerCfg.EngineOptionsPath)
+	}
+
+	expected := []string{
+		"-H tcp://0.0.0.0:2376\n",
+		"--storage-driver aufs\n",
+		"--tlscacert /test/ca-cert\n",
+		"--dns 8.8.8.8\n",
+		"--graph /mnt/docker\n",
+		"--ipv6\n",
+		"--log-level debug\n",
+		"--selinux-enabled\n",
+		"--log-driver=syslog\n",
+		"export HTTP_PROXY='http://proxy.local:3128'\n",
+		"export GREETING='it'\\''s'\n",
+	}
+
+	for _, e := range expected {
+		if strings.Index(dockerCfg.EngineOptions, e) == -1 {
+			t.Fatalf("expected engine config to contain %q; received %s", e, dockerCfg.EngineOptions)
+		}
+	}
+}
+
+func TestGenerateDockerOptionsBindAddress(t *testing.T) {
+	p := NewUbuntuProvisioner(&fakedriver.FakeDriver{}).(*UbuntuProvisioner)
+	p.EngineOptions = engine.EngineOptions{
+		BindAddress: "10.0.0.1",
+	}
+
+	dockerCfg, err := p.GenerateDockerOptions(2377)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "-H tcp://10.0.0.1:2377\n"
+	if strings.Index(dockerCfg.EngineOptions, expected) == -1 {
+		t.Fatalf("expected engine config to contain %q; received %s", expected, dockerCfg.EngineOptions)
+	}
+
+	if strings.Index(dockerCfg.EngineOptions, "0.0.0.0") != -1 {
+		t.Fatalf("expected engine config not to bind all interfaces; received %s", dockerCfg.EngineOptions)
+	}
+}
+
+func TestGenerateDockerOptionsNoTCP(t *testing.T) {
+	ubuntu := NewUbuntuProvisioner(&fakedriver.FakeDriver{}).(*UbuntuProvisioner)
+	ubuntu.EngineOptions = engine.EngineOptions{DisableTCP: true}
+
+	dockerCfg, err := ubuntu.GenerateDockerOptions(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Index(dockerCfg.EngineOptions, "tcp://") != -1 {
+		t.Fatalf("expected engine config not to contain a TCP socket; received %s", dockerCfg.EngineOptions)
+	}
+
+	if strings.Index(dockerCfg.EngineOptions, "-H unix:///var/run/docker.sock\n") == -1 {
+		t.Fatalf("expected engine config to contain the unix socket; received %s", dockerCfg.EngineOptions)
+	}
+
+	b2d := &Boot2DockerProvisioner{
+		Driver:        &fakedriver.FakeDriver{},
+		EngineOptions: engine.EngineOptions{DisableTCP: true},
+	}
+
+	dockerCfg, err = b2d.GenerateDockerOptions(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "DOCKER_HOST='-H unix:///var/run/docker-machine.sock'\n"
+	if strings.Index(dockerCfg.EngineOptions, expected) == -1 {
+		t.Fatalf("expected engine config to contain %q; received %s", expected, dockerCfg.EngineOptions)
+	}
+}
+
+func TestSwarmCommandsDefaults(t *testing.T) {
+	swarmOptions := swarm.SwarmOptions{
+		IsSwarm:   true,
+		Master:    true,
+		Host:      "tcp://0.0.0.0:3376",
+		Discovery: "token://test",
+	}
+
+	commands, err := swarmCommands("/etc/docker", swarm.Address{Host: "1.2.3.4", Port: 2376}, swarmOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"docker pull swarm:latest",
+		"docker run -d -p 3376:3376 --restart=always --name swarm-agent-master -v /etc/docker:/etc/docker swarm:latest manage --tlsverify --tlscacert=/etc/docker/ca.pem --tlscert=/etc/docker/server.pem --tlskey=/etc/docker/server-key.pem -H tcp://0.0.0.0:3376 token://test",
+		"docker run -d --restart=always --name swarm-agent -v /etc/docker:/etc/docker swarm:latest join --addr 1.2.3.4:2376 token://test",
+	}
+
+	if len(commands) != len(expected) {
+		t.Fatalf("expected %v; received %v", expected, commands)
+	}
+
+	for i := range expected {
+		if commands[i] != expected[i] {
+			t.Fatalf("expected %q; received %q", expected[i], commands[i])
+		}
+	}
+}
+
+func TestSwarmCommandsOptions(t *testing.T) {
+	swarmOptions := swarm.SwarmOptions{
+		IsSwarm:        true,
+		Master:         true,
+		Host:           "tcp://0.0.0.0:3376",
+		Discovery:      "token://test",
+		Strategy:       "binpack",
+		Heartbeat:      10,
+		Overcommit:     0.05,
+		ArbitraryFlags: []string{"replication", "advertise=1.2.3.4:3376"},
+		Image:          "registry.local/swarm:0.3.0",
+		TlsCaCert:      "/var/lib/boot2docker/ca.pem",
+	}
+
+	commands, err := swarmCommands("/var/lib/boot2docker", swarm.Address{Host: "1.2.3.4", Port: 2376}, swarmOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"docker pull registry.local/swarm:0.3.0",
+		"registry.local/swarm:0.3.0 manage --tlsverify --tlscacert=/var/lib/boot2docker/ca.pem --tlscert=/var/lib/boot2docker/server.pem --tlskey=/var/lib/boot2docker/server-key.pem -H tcp://0.0.0.0:3376 --strategy binpack --heartbeat=10s --cluster-opt swarm.overcommit=0.05 --replication --advertise=1.2.3.4:3376 token://test",
+		"registry.local/swarm:0.3.0 join --addr 1.2.3.4:2376 --heartbeat=10s token://test",
+	}
+
+	for i, e := range expected {
+		if strings.Index(commands[i], e) == -1 {
+			t.Fatalf("expected %q to contain %q", commands[i], e)
+		}
+	}
+
+	for _, command := range commands {
+		if strings.Index(command, "swarm:latest") != -1 {
+			t.Fatalf("expected the default image not to be used; received %q", command)
+		}
+	}
+}
+
+func TestSwarmCommandsNodesDiscovery(t *testing.T) {
+	swarmOptions := swarm.SwarmOptions{
+		IsSwarm:   true,
+		Master:    true,
+		Host:      "tcp://0.0.0.0:3376",
+		Discovery: "nodes://1.2.3.4:2376,1.2.3.5:2376",
+	}
+
+	commands, err := swarmCommands("/etc/docker", swarm.Address{Host: "1.2.3.4", Port: 2376}, swarmOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, command := range commands {
+		if strings.Index(command, "swarm-agent ") != -1 {
+			t.Fatalf("expected no join agent with a static node list; received %v", commands)
+		}
+	}
+}
+
+func TestSwarmCommandsReplication(t *testing.T) {
+	swarmOptions := swarm.SwarmOptions{
+		IsSwarm:     true,
+		Master:      true,
+		Replication: true,
+		Host:        "tcp://0.0.0.0:3376",
+		Discovery:   "consul://1.2.3.5:8500/test",
+	}
+
+	commands, err := swarmCommands("/etc/docker", swarm.Address{Host: "1.2.3.4", Port: 2376}, swarmOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "-H tcp://0.0.0.0:3376 --replication --advertise 1.2.3.4:3376 consul://1.2.3.5:8500/test"
+	if strings.Index(commands[1], expected) == -1 {
+		t.Fatalf("expected master command to contain %q; received %s", expected, commands[1])
+	}
+
+	swarmOptions.Discovery = "token://abc"
+	if _, err := swarmCommands("/etc/docker", swarm.Address{Host: "1.2.3.4", Port: 2376}, swarmOptions); err == nil {
+		t.Fatal("expected an error replicating masters without a KV store")
+	}
+}
+
 func TestMachinePortBoot2Docker(t *testing.T) {
 	p := &Boot2DockerProvisioner{
 		Driver: &fakedriver.FakeDriver{},
@@ -112,3 +455,177 @@ func TestMachineCustomPortBoot2Docker(t *testing.T) {
 		t.Errorf("expected url %s; received %s", bindUrl, url)
 	}
 }
+
+func TestParseDockerVersion(t *testing.T) {
+	version, err := parseDockerVersion("Docker version 1.6.2, build 7c8fca2\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != "1.6.2" {
+		t.Fatalf("expected version 1.6.2; received %s", version)
+	}
+
+	if _, err := parseDockerVersion("docker: command not found"); err == nil {
+		t.Fatal("expected error parsing unknown output")
+	}
+}
+
+func TestServerCertHosts(t *testing.T) {
+	authOptions := auth.AuthOptions{
+		ServerCertSANs: []string{"dev.example.com", "1.2.3.4"},
+	}
+
+	hosts, err := serverCertHosts(&fakedriver.FakeDriver{}, authOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"1.2.3.4", "localhost", "127.0.0.1", "dev.example.com"}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Fatalf("expected hosts %v; received %v", expected, hosts)
+	}
+}
+
+func TestDaemonCaCertificates(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.Setenv("MACHINE_STORAGE_PATH", tmpDir)
+	defer os.Setenv("MACHINE_STORAGE_PATH", "")
+
+	if err := os.MkdirAll(utils.GetClientCaDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	caCertPath := filepath.Join(utils.GetMachineCertDir(), "ca.pem")
+	if err := utils.GenerateCACertificate(caCertPath, filepath.Join(utils.GetMachineCertDir(), "ca-key.pem"), utils.CertOptions{Org: "machine"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pems := map[string]string{}
+	for _, name := range []string{"alice", "bob"} {
+		certPath := filepath.Join(utils.GetClientCaDir(), name+".pem")
+		if err := utils.GenerateCACertificate(certPath, filepath.Join(tmpDir, name+"-key.pem"), utils.CertOptions{Org: name}); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadFile(certPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pems[name] = string(data)
+	}
+
+	revocationList, err := auth.LoadRevocationList(utils.GetRevocationListPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := utils.GetCertificateSerial(filepath.Join(utils.GetClientCaDir(), "bob.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revocationList.Revoke("bob", serial.String())
+	if err := revocationList.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	caCerts, err := daemonCaCertificates(auth.AuthOptions{CaCertPath: caCertPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := string(caCert) + pems["alice"]; string(caCerts) != expected {
+		t.Fatalf("expected the CA and the CA of alice only; received:\n%s", caCerts)
+	}
+}
+
+func TestParseSwarmStatus(t *testing.T) {
+	status := parseSwarmStatus("/swarm-agent true false\n/swarm-agent-master false false\n")
+	if status.Agent != "running" {
+		t.Fatalf("expected agent running; received %s", status.Agent)
+	}
+	if status.Master != "stopped" {
+		t.Fatalf("expected master stopped; received %s", status.Master)
+	}
+
+	status = parseSwarmStatus("/swarm-agent true true\n")
+	if status.Agent != "restarting" {
+		t.Fatalf("expected agent restarting; received %s", status.Agent)
+	}
+	if status.Master != "missing" {
+		t.Fatalf("expected master missing; received %s", status.Master)
+	}
+}
+
+type urlDriver struct {
+	fakedriver.FakeDriver
+	url string
+}
+
+func (d *urlDriver) GetURL() (string, error) {
+	return d.url, nil
+}
+
+func TestGetDockerPort(t *testing.T) {
+	for url, expected := range map[string]int{
+		"tcp://10.0.0.1:2376":         2376,
+		"tcp://10.0.0.1:3376":         3376,
+		"tcp://10.0.0.1":              engine.DefaultPort,
+		"tcp://[fe80::1]:3376":        3376,
+		"tcp://[2001:db8::1]":         engine.DefaultPort,
+		"unix:///var/run/docker.sock": engine.DefaultPort,
+	} {
+		p := NewUbuntuProvisioner(&urlDriver{url: url})
+		port, err := getDockerPort(p)
+		if err != nil {
+			t.Fatalf("%s: %s", url, err)
+		}
+
+		if port != expected {
+			t.Fatalf("expected port %d for %s; received %d", expected, url, port)
+		}
+	}
+
+	p := NewUbuntuProvisioner(&urlDriver{url: "tcp://10.0.0.1:2376"})
+	p.SetEngineOptions(engine.EngineOptions{Port: 4243})
+	if port, err := getDockerPort(p); err != nil || port != 4243 {
+		t.Fatalf("expected the engine port 4243; received %d (%v)", port, err)
+	}
+}
+
+func TestCheckClusterStore(t *testing.T) {
+	p := &fakeProvisioner{}
+	if err := checkClusterStore(p, "consul://10.0.0.1:8500"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.commands) != 1 {
+		t.Fatalf("expected one command; received %v", p.commands)
+	}
+
+	for _, check := range []string{"nc -w 5 10.0.0.1 8500", "/dev/tcp/10.0.0.1/8500", "echo " + clusterStoreUnchecked} {
+		if !strings.Contains(p.commands[0], check) {
+			t.Fatalf("expected the check to contain %q; received %s", check, p.commands[0])
+		}
+	}
+
+	p = &fakeProvisioner{fail: "10.0.0.1"}
+	if err := checkClusterStore(p, "consul://10.0.0.1:8500"); err == nil {
+		t.Fatal("expected an error for an unreachable cluster store")
+	}
+
+	if err := checkClusterStore(&fakeProvisioner{}, "consul://10.0.0.1"); err == nil {
+		t.Fatal("expected an error for a cluster store without a port")
+	}
+}
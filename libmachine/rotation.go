@@ -0,0 +1,89 @@
+package libmachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// The phases of a CA rotation, in order
+const (
+	// RotationTrust makes the machines trust the new CA as well as the old
+	RotationTrust = "trust"
+	// RotationReissue reissues the certificates from the new CA while the
+	// machines still trust the old one
+	RotationReissue = "reissue"
+	// RotationDrop stops the machines trusting the old CA
+	RotationDrop = "drop"
+	// RotationRollback restores the old CA on all machines
+	RotationRollback = "rollback"
+)
+
+// CARotation is the state of a CA rotation in progress, kept as JSON in the
+// machine cert dir so that an interrupted rotation can be resumed or rolled
+// back.
+type CARotation struct {
+	path  string
+	Phase string
+	// Machines records the last phase each machine completed
+	Machines map[string]string
+}
+
+// NewCARotation starts a rotation whose state is kept at path
+func NewCARotation(path string) *CARotation {
+	return &CARotation{
+		path:     path,
+		Phase:    RotationTrust,
+		Machines: map[string]string{},
+	}
+}
+
+// LoadCARotation reads the rotation in progress at path.  It returns nil if
+// there is none.
+func LoadCARotation(path string) (*CARotation, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	r := NewCARotation(path)
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("error reading the CA rotation state %s: %s", path, err)
+	}
+
+	return r, nil
+}
+
+// Done reports whether the machine completed the current phase
+func (r *CARotation) Done(name string) bool {
+	return r.Machines[name] == r.Phase
+}
+
+// SetDone records that the machine completed the current phase
+func (r *CARotation) SetDone(name string) error {
+	r.Machines[name] = r.Phase
+	return r.Save()
+}
+
+// SetPhase moves the rotation on to the given phase
+func (r *CARotation) SetPhase(phase string) error {
+	r.Phase = phase
+	return r.Save()
+}
+
+func (r *CARotation) Save() error {
+	data, err := json.MarshalIndent(r, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, data, 0600)
+}
+
+// Remove deletes the state once the rotation is finished
+func (r *CARotation) Remove() error {
+	return os.Remove(r.path)
+}
@@ -0,0 +1,58 @@
+package libmachine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCARotation(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "rotation.json")
+
+	r, err := LoadCARotation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r != nil {
+		t.Fatal("expected no rotation in progress")
+	}
+
+	r = NewCARotation(path)
+	if err := r.SetDone("dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = LoadCARotation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Phase != RotationTrust || !r.Done("dev") || r.Done("staging") {
+		t.Fatalf("unexpected rotation state %+v", r)
+	}
+
+	// machines have to complete every phase
+	if err := r.SetPhase(RotationReissue); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Done("dev") {
+		t.Fatal("expected dev to have to complete the reissue phase")
+	}
+
+	if err := r.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("expected the rotation state to be removed")
+	}
+}
@@ -3,8 +3,14 @@ package libmachine
 type Store interface {
 	// Exists returns whether a machine exists or not
 	Exists(name string) (bool, error)
-	// GetActive returns the active host
+	// GetActive returns the active host: the one recorded by SetActive, or
+	// else the one DOCKER_HOST points at
 	GetActive() (*Host, error)
+	// GetActiveName returns the name of the host recorded by SetActive, or
+	// an empty string if there is none
+	GetActiveName() (string, error)
+	// SetActive records the active host; nil clears it
+	SetActive(host *Host) error
 	// GetPath returns the path to the store
 	GetPath() string
 	// GetCACertPath returns the CA certificate
@@ -0,0 +1,121 @@
+package swarm
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/drivers"
+)
+
+const (
+	// DefaultPort is the port the master listens on when the swarm host
+	// has none
+	DefaultPort = 3376
+
+	// AdvertisePublic advertises the IP the driver reports for the machine
+	AdvertisePublic = "public"
+
+	// AdvertisePrivate advertises the machine's private IP, for swarms
+	// within a provider's private network
+	AdvertisePrivate = "private"
+)
+
+// Address is a host and port swarm listens on or advertises.  The host may
+// be an IPv6 address, which String puts in brackets.
+type Address struct {
+	Host string
+	Port int
+}
+
+// ParseAddress parses host, host:port or tcp://host:port, with IPv6 hosts
+// bare or in brackets, using defaultPort if there is no port
+func ParseAddress(addr string, defaultPort int) (Address, error) {
+	hostPort := strings.TrimSuffix(strings.TrimPrefix(addr, "tcp://"), "/")
+	if strings.Contains(hostPort, "://") {
+		return Address{}, fmt.Errorf("invalid swarm address %q: only tcp:// is supported", addr)
+	}
+
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		// no port, or a bare IPv6 address
+		host, port = strings.Trim(hostPort, "[]"), ""
+	}
+
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return Address{}, fmt.Errorf("invalid swarm address %q", addr)
+	}
+
+	a := Address{
+		Host: host,
+		Port: defaultPort,
+	}
+
+	if port != "" {
+		if a.Port, err = strconv.Atoi(port); err != nil || a.Port < 1 || a.Port > 65535 {
+			return Address{}, fmt.Errorf("invalid port in swarm address %q", addr)
+		}
+	}
+
+	return a, nil
+}
+
+// String returns the address as host:port
+func (a Address) String() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
+// URL returns the address as tcp://host:port
+func (a Address) URL() string {
+	return fmt.Sprintf("tcp://%s", a)
+}
+
+// IsUnspecified reports whether the address is on all interfaces
+func (a Address) IsUnspecified() bool {
+	if a.Host == "" {
+		return true
+	}
+
+	ip := net.ParseIP(a.Host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// ListenAddress returns the address the master listens on, from Host
+func (s SwarmOptions) ListenAddress() (Address, error) {
+	host := s.Host
+	if host == "" {
+		host = DefaultHost
+	}
+
+	return ParseAddress(host, DefaultPort)
+}
+
+// AdvertiseAddress returns the address the node agent advertises for the
+// daemon, which is reached at dockerAddr, according to Address: the
+// driver's IP (the default), its private IP, or an address of its own with
+// the daemon's port by default
+func (s SwarmOptions) AdvertiseAddress(d drivers.Driver, dockerAddr Address) (Address, error) {
+	switch s.Address {
+	case "", AdvertisePublic:
+		return dockerAddr, nil
+	case AdvertisePrivate:
+		privateIPDriver, ok := d.(drivers.PrivateIPDriver)
+		if !ok {
+			return Address{}, fmt.Errorf("the %s driver does not report a private IP to advertise for swarm", d.DriverName())
+		}
+
+		ip, err := privateIPDriver.GetPrivateIP()
+		if err != nil {
+			return Address{}, err
+		}
+
+		if ip == "" {
+			return Address{}, fmt.Errorf("the machine has no private IP to advertise for swarm")
+		}
+
+		return Address{Host: ip, Port: dockerAddr.Port}, nil
+	}
+
+	return ParseAddress(s.Address, dockerAddr.Port)
+}
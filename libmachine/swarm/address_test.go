@@ -0,0 +1,114 @@
+package swarm
+
+import (
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+)
+
+type privateIPDriver struct {
+	fakedriver.FakeDriver
+	privateIP string
+}
+
+func (d *privateIPDriver) GetPrivateIP() (string, error) {
+	return d.privateIP, nil
+}
+
+func TestParseAddress(t *testing.T) {
+	for _, c := range []struct {
+		addr     string
+		expected Address
+	}{
+		{"tcp://0.0.0.0:3376", Address{"0.0.0.0", 3376}},
+		{"tcp://0.0.0.0", Address{"0.0.0.0", DefaultPort}},
+		{"10.0.0.1:4000", Address{"10.0.0.1", 4000}},
+		{"10.0.0.1", Address{"10.0.0.1", DefaultPort}},
+		{":4000", Address{"", 4000}},
+		{"tcp://[::]:3376", Address{"::", 3376}},
+		{"[fe80::1]", Address{"fe80::1", DefaultPort}},
+		{"fe80::1", Address{"fe80::1", DefaultPort}},
+		{"tcp://swarm.local:3376/", Address{"swarm.local", 3376}},
+	} {
+		a, err := ParseAddress(c.addr, DefaultPort)
+		if err != nil {
+			t.Fatalf("error parsing %s: %s", c.addr, err)
+		}
+
+		if a != c.expected {
+			t.Fatalf("expected %s to be %+v; received %+v", c.addr, c.expected, a)
+		}
+	}
+
+	for _, addr := range []string{"unix:///var/run/swarm.sock", "10.0.0.1:port", "10.0.0.1:70000", "fe80::zz"} {
+		if _, err := ParseAddress(addr, DefaultPort); err == nil {
+			t.Fatalf("expected an error parsing %s", addr)
+		}
+	}
+}
+
+func TestAddressString(t *testing.T) {
+	if s := (Address{"10.0.0.1", 3376}).URL(); s != "tcp://10.0.0.1:3376" {
+		t.Fatalf("expected tcp://10.0.0.1:3376; received %s", s)
+	}
+
+	if s := (Address{"fe80::1", 3376}).String(); s != "[fe80::1]:3376" {
+		t.Fatalf("expected [fe80::1]:3376; received %s", s)
+	}
+}
+
+func TestIsUnspecified(t *testing.T) {
+	for _, a := range []Address{{"", 3376}, {"0.0.0.0", 3376}, {"::", 3376}} {
+		if !a.IsUnspecified() {
+			t.Fatalf("expected %+v to be unspecified", a)
+		}
+	}
+
+	if (Address{"10.0.0.1", 3376}).IsUnspecified() {
+		t.Fatal("expected 10.0.0.1 not to be unspecified")
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	a, err := SwarmOptions{}.ListenAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a != (Address{"0.0.0.0", DefaultPort}) {
+		t.Fatalf("expected the default host; received %+v", a)
+	}
+}
+
+func TestAdvertiseAddress(t *testing.T) {
+	d := &privateIPDriver{privateIP: "10.0.0.1"}
+	dockerAddr := Address{"1.2.3.4", 2376}
+
+	for _, c := range []struct {
+		address  string
+		expected Address
+	}{
+		{"", dockerAddr},
+		{AdvertisePublic, dockerAddr},
+		{AdvertisePrivate, Address{"10.0.0.1", 2376}},
+		{"192.168.0.5", Address{"192.168.0.5", 2376}},
+		{"[fe80::1]:2377", Address{"fe80::1", 2377}},
+	} {
+		a, err := SwarmOptions{Address: c.address}.AdvertiseAddress(d, dockerAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if a != c.expected {
+			t.Fatalf("expected %q to advertise %+v; received %+v", c.address, c.expected, a)
+		}
+	}
+
+	if _, err := (SwarmOptions{Address: AdvertisePrivate}).AdvertiseAddress(&fakedriver.FakeDriver{}, dockerAddr); err == nil {
+		t.Fatal("expected an error advertising the private IP of a driver without one")
+	}
+
+	if _, err := (SwarmOptions{Address: AdvertisePrivate}).AdvertiseAddress(&privateIPDriver{}, dockerAddr); err == nil {
+		t.Fatal("expected an error advertising an empty private IP")
+	}
+}
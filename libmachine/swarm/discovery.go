@@ -0,0 +1,172 @@
+package swarm
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/drivers"
+)
+
+// KVStore describes a key-value store swarm can use for discovery, run as a
+// container on one of the cluster's machines
+type KVStore struct {
+	Port  int
+	Image string
+	// Args are the arguments of the container; %s is replaced with the
+	// address the store advertises
+	Args string
+}
+
+const (
+	// KVStoreContainer is the name of the container running the KV store
+	KVStoreContainer = "swarm-kv-store"
+)
+
+var KVStores = map[string]KVStore{
+	"consul": {
+		Port:  8500,
+		Image: "progrium/consul",
+		Args:  "-server -bootstrap -advertise %s",
+	},
+	"etcd": {
+		Port:  2379,
+		Image: "quay.io/coreos/etcd",
+		Args:  "-listen-client-urls http://0.0.0.0:2379 -advertise-client-urls http://%s:2379",
+	},
+	"zk": {
+		Port:  2181,
+		Image: "jplock/zookeeper",
+	},
+}
+
+// discoverySchemes are the discovery backends swarm supports; the
+// hosted token service is the default
+var discoverySchemes = []string{"token", "file", "nodes", "consul", "etcd", "zk"}
+
+// KVStoreNames returns the names of the supported KV stores
+func KVStoreNames() []string {
+	names := []string{}
+	for name := range KVStores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DiscoveryScheme returns the backend of a discovery URL, e.g. consul for
+// consul://10.0.0.5:8500/cluster, and checks swarm supports it
+func DiscoveryScheme(discovery string) (string, error) {
+	u, err := url.Parse(discovery)
+	if err != nil {
+		return "", fmt.Errorf("invalid swarm discovery %q: %s", discovery, err)
+	}
+
+	for _, scheme := range discoverySchemes {
+		if u.Scheme == scheme {
+			return scheme, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid swarm discovery %q: supported backends are %s", discovery, strings.Join(discoverySchemes, ", "))
+}
+
+// RegistersNodes reports whether the discovery backend needs each node to
+// register itself with a join agent; nodes and file list them statically.
+func RegistersNodes(discovery string) bool {
+	scheme, err := DiscoveryScheme(discovery)
+	if err != nil {
+		return true
+	}
+	return scheme != "nodes" && scheme != "file"
+}
+
+// IsNodesDiscovery reports whether discovery is a static nodes:// list
+func IsNodesDiscovery(discovery string) bool {
+	return strings.HasPrefix(discovery, "nodes://")
+}
+
+// IsKVDiscovery reports whether discovery is one of the KV stores, which
+// master replicas need for leader election
+func IsKVDiscovery(discovery string) bool {
+	scheme, err := DiscoveryScheme(discovery)
+	if err != nil {
+		return false
+	}
+	_, ok := KVStores[scheme]
+	return ok
+}
+
+// ClusterStore returns the KV store of a discovery URL as the daemon's
+// --cluster-store, e.g. consul://10.0.0.5:8500, for multi-host networking
+func ClusterStore(discovery string) (string, error) {
+	if !IsKVDiscovery(discovery) {
+		return "", fmt.Errorf("discovery %q is not a KV store", discovery)
+	}
+
+	u, err := url.Parse(discovery)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s://%s", u.Scheme, u.Host), nil
+}
+
+// KVStoreDiscovery returns the discovery URL of a cluster in the KV store
+// running on the machine with the given IP
+func KVStoreDiscovery(kvStore, ip, cluster string) (string, error) {
+	store, ok := KVStores[kvStore]
+	if !ok {
+		return "", fmt.Errorf("unsupported KV store %q: supported stores are %s", kvStore, strings.Join(KVStoreNames(), ", "))
+	}
+
+	return fmt.Sprintf("%s://%s/%s", kvStore, net.JoinHostPort(ip, strconv.Itoa(store.Port)), cluster), nil
+}
+
+// KVStoreIP returns the IP the KV store of a machine listens on and
+// advertises: its private IP if the driver reports one, as the store has
+// no authentication, or else its IP
+func KVStoreIP(d drivers.Driver) (string, error) {
+	if privateIPDriver, ok := d.(drivers.PrivateIPDriver); ok {
+		ip, err := privateIPDriver.GetPrivateIP()
+		if err != nil {
+			return "", err
+		}
+
+		if ip != "" {
+			return ip, nil
+		}
+	}
+
+	return d.GetIP()
+}
+
+// KVStoreCommands returns the commands which start the KV store container
+// listening on the given IP of the machine.  They are meant to be run as
+// root.
+func KVStoreCommands(kvStore, ip string) ([]string, error) {
+	store, ok := KVStores[kvStore]
+	if !ok {
+		return nil, fmt.Errorf("unsupported KV store %q: supported stores are %s", kvStore, strings.Join(KVStoreNames(), ", "))
+	}
+
+	publish := net.JoinHostPort(ip, strconv.Itoa(store.Port))
+	run := fmt.Sprintf("docker run -d --restart=always --name %s -p %s:%d %s", KVStoreContainer, publish, store.Port, store.Image)
+	if store.Args != "" {
+		run = fmt.Sprintf("%s %s", run, strings.Replace(store.Args, "%s", ip, -1))
+	}
+
+	return []string{
+		fmt.Sprintf("docker pull %s", store.Image),
+		run,
+	}, nil
+}
+
+// NodesDiscovery returns a static nodes:// discovery URL listing the
+// daemons at addrs (host:port)
+func NodesDiscovery(addrs []string) string {
+	return fmt.Sprintf("nodes://%s", strings.Join(addrs, ","))
+}
@@ -0,0 +1,103 @@
+package swarm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiscoveryScheme(t *testing.T) {
+	for _, c := range []struct {
+		discovery string
+		scheme    string
+	}{
+		{"token://abc", "token"},
+		{"consul://10.0.0.1:8500/test", "consul"},
+		{"etcd://10.0.0.1:2379/test", "etcd"},
+		{"zk://10.0.0.1:2181/test", "zk"},
+		{"nodes://10.0.0.1:2376,10.0.0.2:2376", "nodes"},
+		{"file:///etc/swarm/cluster", "file"},
+	} {
+		scheme, err := DiscoveryScheme(c.discovery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scheme != c.scheme {
+			t.Fatalf("expected %s for %s; received %s", c.scheme, c.discovery, scheme)
+		}
+	}
+
+	if _, err := DiscoveryScheme("redis://10.0.0.1/test"); err == nil {
+		t.Fatal("expected an error for an unsupported backend")
+	}
+}
+
+func TestRegistersNodes(t *testing.T) {
+	if !RegistersNodes("consul://10.0.0.1:8500/test") {
+		t.Fatal("expected nodes to register with consul")
+	}
+
+	if RegistersNodes("nodes://10.0.0.1:2376") || RegistersNodes("file:///etc/swarm/cluster") {
+		t.Fatal("expected nodes not to register with a static list")
+	}
+}
+
+func TestIsKVDiscovery(t *testing.T) {
+	if !IsKVDiscovery("zk://10.0.0.1:2181/test") {
+		t.Fatal("expected zk to be a KV store discovery")
+	}
+
+	if IsKVDiscovery("token://abc") || IsKVDiscovery("nodes://10.0.0.1:2376") {
+		t.Fatal("expected token and nodes not to be KV store discoveries")
+	}
+}
+
+func TestClusterStore(t *testing.T) {
+	clusterStore, err := ClusterStore("consul://10.0.0.1:8500/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clusterStore != "consul://10.0.0.1:8500" {
+		t.Fatalf("expected consul://10.0.0.1:8500; received %s", clusterStore)
+	}
+
+	if _, err := ClusterStore("token://abc"); err == nil {
+		t.Fatal("expected an error for a discovery without a KV store")
+	}
+}
+
+func TestKVStoreDiscovery(t *testing.T) {
+	discovery, err := KVStoreDiscovery("etcd", "10.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if discovery != "etcd://10.0.0.1:2379/test" {
+		t.Fatalf("expected etcd://10.0.0.1:2379/test; received %s", discovery)
+	}
+
+	if _, err := KVStoreDiscovery("redis", "10.0.0.1", "test"); err == nil {
+		t.Fatal("expected an error for an unsupported store")
+	}
+}
+
+func TestKVStoreCommands(t *testing.T) {
+	commands, err := KVStoreCommands("consul", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "docker run -d --restart=always --name swarm-kv-store -p 10.0.0.1:8500:8500 progrium/consul -server -bootstrap -advertise 10.0.0.1"
+	if commands[len(commands)-1] != expected {
+		t.Fatalf("expected %q; received %q", expected, commands[len(commands)-1])
+	}
+
+	commands, err = KVStoreCommands("zk", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(commands[len(commands)-1], "-p 10.0.0.1:2181:2181 jplock/zookeeper") {
+		t.Fatalf("unexpected zookeeper command %q", commands[len(commands)-1])
+	}
+}
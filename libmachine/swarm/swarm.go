@@ -1,15 +1,25 @@
 package swarm
 
+import (
+	"fmt"
+	"strings"
+)
+
 const (
 	DockerImage              = "swarm:latest"
 	DiscoveryServiceEndpoint = "https://discovery-stage.hub.docker.com/v1"
+	DefaultStrategy          = "spread"
+	DefaultHost              = "tcp://0.0.0.0:3376"
 )
 
 type SwarmOptions struct {
-	IsSwarm    bool
-	Address    string
-	Discovery  string
-	Master     bool
+	IsSwarm bool
+	// Address is the address advertised for the node: AdvertisePublic,
+	// AdvertisePrivate or a host[:port]; empty means AdvertisePublic
+	Address   string
+	Discovery string
+	Master    bool
+	// Host is the tcp://host:port the master listens on
 	Host       string
 	Strategy   string
 	Heartbeat  int
@@ -18,4 +28,92 @@ type SwarmOptions struct {
 	TlsCert    string
 	TlsKey     string
 	TlsVerify  bool
+
+	// Cluster is the name of the cluster the machine belongs to; machines
+	// with the same name share their discovery
+	Cluster string
+
+	// KVStore is the KV store (see KVStores) run on this machine for the
+	// cluster's discovery
+	KVStore string
+
+	// Replication runs the master as one of several replicas which elect
+	// a primary through the discovery's KV store
+	Replication bool
+
+	// ArbitraryFlags are passed to the master as --flag
+	ArbitraryFlags []string
+
+	// Image is the swarm image to run; empty means DockerImage
+	Image string
+
+	// ImageArchive is a local tarball of the swarm image, as written by
+	// `docker save`, loaded on the host instead of pulling the image
+	ImageArchive string
+}
+
+// GetImage returns the swarm image, falling back to the default for
+// options saved before it could be set
+func (s SwarmOptions) GetImage() string {
+	if s.Image == "" {
+		return DockerImage
+	}
+	return s.Image
+}
+
+// Validate checks the scheduling options are in range
+func (s SwarmOptions) Validate() error {
+	if s.Heartbeat < 0 {
+		return fmt.Errorf("invalid swarm heartbeat %d", s.Heartbeat)
+	}
+
+	if s.Overcommit < 0 {
+		return fmt.Errorf("invalid swarm overcommit %g", s.Overcommit)
+	}
+
+	if _, err := s.ListenAddress(); err != nil {
+		return err
+	}
+
+	if s.Address != "" && s.Address != AdvertisePublic && s.Address != AdvertisePrivate {
+		if _, err := ParseAddress(s.Address, 0); err != nil {
+			return err
+		}
+	}
+
+	if s.Discovery != "" {
+		if _, err := DiscoveryScheme(s.Discovery); err != nil {
+			return err
+		}
+	}
+
+	if s.KVStore != "" {
+		if _, ok := KVStores[s.KVStore]; !ok {
+			return fmt.Errorf("unsupported KV store %q: supported stores are %s", s.KVStore, strings.Join(KVStoreNames(), ", "))
+		}
+
+		if s.Cluster == "" {
+			return fmt.Errorf("a KV store needs a cluster name")
+		}
+
+		if s.Discovery != "" {
+			return fmt.Errorf("the discovery of a machine running the KV store is set from it")
+		}
+	}
+
+	if s.Replication {
+		if !s.Master {
+			return fmt.Errorf("replication is only for swarm masters")
+		}
+
+		if s.Discovery != "" && !IsKVDiscovery(s.Discovery) {
+			return fmt.Errorf("replication needs a KV store discovery (%s)", strings.Join(KVStoreNames(), ", "))
+		}
+	}
+
+	if s.Cluster != "" && !s.IsSwarm {
+		return fmt.Errorf("a cluster name needs swarm")
+	}
+
+	return nil
 }
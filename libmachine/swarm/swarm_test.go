@@ -1 +1,42 @@
 package swarm
+
+import "testing"
+
+func TestGetImage(t *testing.T) {
+	if image := (SwarmOptions{}).GetImage(); image != DockerImage {
+		t.Fatalf("expected %s; received %s", DockerImage, image)
+	}
+
+	if image := (SwarmOptions{Image: "registry.local/swarm:0.3.0"}).GetImage(); image != "registry.local/swarm:0.3.0" {
+		t.Fatalf("expected registry.local/swarm:0.3.0; received %s", image)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		options SwarmOptions
+		valid   bool
+	}{
+		{SwarmOptions{}, true},
+		{SwarmOptions{Heartbeat: 10, Overcommit: 0.05}, true},
+		{SwarmOptions{Heartbeat: -1}, false},
+		{SwarmOptions{Overcommit: -0.5}, false},
+		{SwarmOptions{IsSwarm: true, Cluster: "test", KVStore: "consul"}, true},
+		{SwarmOptions{IsSwarm: true, KVStore: "consul"}, false},
+		{SwarmOptions{IsSwarm: true, Cluster: "test", KVStore: "redis"}, false},
+		{SwarmOptions{IsSwarm: true, Cluster: "test", KVStore: "consul", Discovery: "token://abc"}, false},
+		{SwarmOptions{Discovery: "redis://10.0.0.1/test"}, false},
+		{SwarmOptions{Cluster: "test"}, false},
+		{SwarmOptions{Host: "tcp://[::]:3376", Address: AdvertisePrivate}, true},
+		{SwarmOptions{Host: "unix:///var/run/swarm.sock"}, false},
+		{SwarmOptions{Address: "10.0.0.1:port"}, false},
+		{SwarmOptions{IsSwarm: true, Master: true, Replication: true, Discovery: "consul://10.0.0.1:8500/test"}, true},
+		{SwarmOptions{IsSwarm: true, Master: true, Replication: true, Cluster: "test", KVStore: "etcd"}, true},
+		{SwarmOptions{IsSwarm: true, Master: true, Replication: true, Discovery: "token://abc"}, false},
+		{SwarmOptions{IsSwarm: true, Replication: true, Discovery: "consul://10.0.0.1:8500/test"}, false},
+	} {
+		if err := c.options.Validate(); (err == nil) != c.valid {
+			t.Fatalf("expected %+v to be valid: %t; received %v", c.options, c.valid, err)
+		}
+	}
+}
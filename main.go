@@ -60,6 +60,10 @@ func main() {
 	app.Email = "https://github.com/docker/machine"
 	app.Before = func(c *cli.Context) error {
 		os.Setenv("MACHINE_STORAGE_PATH", c.GlobalString("storage-path"))
+		os.Setenv("MACHINE_STORAGE_KEY_FILE", c.GlobalString("storage-key-file"))
+		os.Setenv("MACHINE_CREDENTIALS_FILE", c.GlobalString("credentials-file"))
+		os.Setenv("MACHINE_CREDENTIALS_PROFILE", c.GlobalString("credentials-profile"))
+		os.Setenv("MACHINE_CREDENTIAL_HELPER", c.GlobalString("credential-helper"))
 		return nil
 	}
 	app.Commands = commands.Commands
@@ -78,6 +82,30 @@ func main() {
 			Value:  utils.GetBaseDir(),
 			Usage:  "Configures storage path",
 		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_STORAGE_KEY_FILE",
+			Name:   "storage-key-file",
+			Usage:  "File holding the key the store is encrypted with; MACHINE_STORAGE_PASSPHRASE sets a passphrase instead",
+			Value:  "",
+		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_CREDENTIALS_FILE",
+			Name:   "credentials-file",
+			Usage:  "File holding driver credentials (default: credentials in the storage path)",
+			Value:  "",
+		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_CREDENTIALS_PROFILE",
+			Name:   "credentials-profile",
+			Usage:  "Profile in the credentials file to read driver credentials from",
+			Value:  "default",
+		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_CREDENTIAL_HELPER",
+			Name:   "credential-helper",
+			Usage:  "Command which prints the driver credential named by its argument",
+			Value:  "",
+		},
 		cli.StringFlag{
 			EnvVar: "MACHINE_TLS_CA_CERT",
 			Name:   "tls-ca-cert",
@@ -90,6 +118,24 @@ func main() {
 			Usage:  "Private key to generate certificates",
 			Value:  "",
 		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_TLS_CA_CHAIN",
+			Name:   "tls-ca-chain",
+			Usage:  "Certificates an intermediate CA chains to, trusted along with the CA",
+			Value:  "",
+		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_TLS_SIGNER_COMMAND",
+			Name:   "tls-signer-command",
+			Usage:  "Command which signs certificate requests read from stdin, instead of the CA key",
+			Value:  "",
+		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_TLS_SIGNER_URL",
+			Name:   "tls-signer-url",
+			Usage:  "URL certificate requests are posted to for signing, instead of the CA key",
+			Value:  "",
+		},
 		cli.StringFlag{
 			EnvVar: "MACHINE_TLS_CLIENT_CERT",
 			Name:   "tls-client-cert",
@@ -102,6 +148,33 @@ func main() {
 			Usage:  "Private key used in client TLS auth",
 			Value:  "",
 		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_TLS_KEY_ALGORITHM",
+			Name:   "tls-key-algorithm",
+			Usage:  "Key algorithm for generated certificates: rsa or ecdsa",
+			Value:  "rsa",
+		},
+		cli.IntFlag{
+			EnvVar: "MACHINE_TLS_KEY_SIZE",
+			Name:   "tls-key-size",
+			Usage:  "Key size for generated certificates (RSA: bits, default 2048; ECDSA: 256, 384 or 521)",
+		},
+		cli.IntFlag{
+			EnvVar: "MACHINE_TLS_CERT_VALIDITY",
+			Name:   "tls-cert-validity",
+			Usage:  "Validity of generated certificates in days",
+			Value:  utils.DefaultCertValidityDays,
+		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_TLS_CERT_ORG",
+			Name:   "tls-cert-org",
+			Usage:  "Organization of generated certificates (default: your username for the CA and client, the machine name for servers)",
+			Value:  "",
+		},
+	}
+
+	if err := commands.ApplyConfigDefaults(app, os.Args); err != nil {
+		log.Fatal(err)
 	}
 
 	app.Run(os.Args)
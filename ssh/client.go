@@ -5,11 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 
 	"github.com/docker/docker/pkg/term"
 	"github.com/docker/machine/log"
+	"github.com/docker/machine/utils"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -40,7 +40,7 @@ func NewConfig(user string, auth *Auth) (*ssh.ClientConfig, error) {
 	var authMethods []ssh.AuthMethod
 
 	for _, k := range auth.Keys {
-		key, err := ioutil.ReadFile(k)
+		key, err := utils.ReadSecretFile(k)
 		if err != nil {
 			return nil, err
 		}
@@ -64,6 +64,12 @@ func NewConfig(user string, auth *Auth) (*ssh.ClientConfig, error) {
 }
 
 func (client *Client) Run(command string) (Output, error) {
+	return client.RunWithInput(command, nil)
+}
+
+// RunWithInput runs the command with its stdin read from input, which
+// allows streaming files too large to be passed on the command line.
+func (client *Client) RunWithInput(command string, input io.Reader) (Output, error) {
 	var (
 		output Output
 		conn   *ssh.Client
@@ -90,6 +96,7 @@ func (client *Client) Run(command string) (Output, error) {
 
 	var stdout, stderr bytes.Buffer
 
+	session.Stdin = input
 	session.Stdout = &stdout
 	session.Stderr = &stderr
 
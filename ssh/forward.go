@@ -0,0 +1,84 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/docker/machine/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// streamLocalChannelOpen is the payload of a direct-streamlocal@openssh.com
+// channel request, which connects to a unix socket on the server
+type streamLocalChannelOpen struct {
+	SocketPath string
+	Reserved0  string
+	Reserved1  uint32
+}
+
+// ForwardUnixSocket listens on the unix socket localPath and forwards each
+// connection to the unix socket remotePath on the server, like
+// ssh -L localPath:remotePath.  It blocks until the listener fails.
+func (client *Client) ForwardUnixSocket(localPath, remotePath string) error {
+	conn, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", client.Hostname, client.Port), client.Config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// a socket left behind by a previous tunnel refuses connections
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", localPath)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	if err := os.Chmod(localPath, 0600); err != nil {
+		return err
+	}
+
+	for {
+		local, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := forwardToUnixSocket(conn, local, remotePath); err != nil {
+				log.Errorf("Error forwarding to %s: %s", remotePath, err)
+			}
+		}()
+	}
+}
+
+func forwardToUnixSocket(conn *ssh.Client, local net.Conn, remotePath string) error {
+	defer local.Close()
+
+	channel, requests, err := conn.OpenChannel("direct-streamlocal@openssh.com", ssh.Marshal(&streamLocalChannelOpen{
+		SocketPath: remotePath,
+	}))
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	go ssh.DiscardRequests(requests)
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(local, channel)
+		close(done)
+	}()
+
+	io.Copy(channel, local)
+	channel.CloseWrite()
+	<-done
+
+	return nil
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"runtime"
 
+	"github.com/docker/machine/utils"
 	gossh "golang.org/x/crypto/ssh"
 )
 
@@ -70,6 +71,13 @@ func (kp *KeyPair) WriteToFile(privateKeyPath string, publicKeyPath string) erro
 		},
 	}
 
+	// the private key is encrypted if the machine store is
+	privateKey, err := utils.EncryptSecret(files[0].Value)
+	if err != nil {
+		return err
+	}
+	files[0].Value = privateKey
+
 	for _, v := range files {
 		f, err := os.Create(v.File)
 		if err != nil {
@@ -2,7 +2,12 @@ package ssh
 
 import (
 	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/docker/machine/utils"
 )
 
 func TestNewKeyPair(t *testing.T) {
@@ -19,3 +24,32 @@ func TestNewKeyPair(t *testing.T) {
 		t.Fatal("Unable to generate fingerprint")
 	}
 }
+
+func TestGenerateSSHKeyEncryptedStore(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.Setenv("MACHINE_STORAGE_PASSPHRASE", "correct horse")
+	defer os.Setenv("MACHINE_STORAGE_PASSPHRASE", "")
+
+	keyPath := filepath.Join(tmpDir, "id_rsa")
+	if err := GenerateSSHKey(keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !utils.IsEncrypted(data) {
+		t.Fatal("expected the private key to be encrypted")
+	}
+
+	if _, err := NewConfig("docker", &Auth{Keys: []string{keyPath}}); err != nil {
+		t.Fatal(err)
+	}
+}
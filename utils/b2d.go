@@ -90,8 +90,12 @@ func (b *B2dUtils) GetLatestBoot2DockerReleaseURL() (string, error) {
 	}
 
 	tag := t[0].TagName
-	isoUrl := fmt.Sprintf("%s/boot2docker/boot2docker/releases/download/%s/boot2docker.iso", b.githubBaseUrl, tag)
-	return isoUrl, nil
+	return b.GetBoot2DockerReleaseURL(tag), nil
+}
+
+// Get the boot2docker ISO URL for the given release tag (e.g. "v1.6.2").
+func (b *B2dUtils) GetBoot2DockerReleaseURL(tag string) string {
+	return fmt.Sprintf("%s/boot2docker/boot2docker/releases/download/%s/boot2docker.iso", b.githubBaseUrl, tag)
 }
 
 func removeFileIfExists(name string) error {
@@ -28,6 +28,16 @@ func TestGetLatestBoot2DockerReleaseUrl(t *testing.T) {
 	}
 }
 
+func TestGetBoot2DockerReleaseUrl(t *testing.T) {
+	b := NewB2dUtils("", "https://example.com")
+	isoUrl := b.GetBoot2DockerReleaseURL("v1.6.2")
+
+	expectedUrl := "https://example.com/boot2docker/boot2docker/releases/download/v1.6.2/boot2docker.iso"
+	if isoUrl != expectedUrl {
+		t.Fatalf("expected url %s; received %s", expectedUrl, isoUrl)
+	}
+}
+
 func TestDownloadIso(t *testing.T) {
 	testData := "test-download"
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
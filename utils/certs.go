@@ -1,16 +1,21 @@
 package utils
 
 import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"net"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -34,12 +39,104 @@ func getTLSConfig(caCert, cert, key []byte, allowInsecure bool) (*tls.Config, er
 	return &tlsConfig, nil
 }
 
-func newCertificate(org string) (*x509.Certificate, error) {
+const (
+	KeyAlgorithmRSA   = "rsa"
+	KeyAlgorithmECDSA = "ecdsa"
+
+	DefaultCertValidityDays = 1080
+)
+
+// CertOptions configures the keys and certificates of the machine PKI.
+// Zero values select the defaults: RSA keys of 2048 bits (ECDSA keys on
+// the P-256 curve) in certificates valid for DefaultCertValidityDays.
+type CertOptions struct {
+	Org          string
+	KeyAlgorithm string
+	KeySize      int
+	ValidityDays int
+}
+
+// Validate checks the key algorithm and size are supported
+func (o CertOptions) Validate() error {
+	switch o.KeyAlgorithm {
+	case "", KeyAlgorithmRSA:
+		if o.KeySize != 0 && o.KeySize < 1024 {
+			return fmt.Errorf("RSA keys must be at least 1024 bits; received %d", o.KeySize)
+		}
+	case KeyAlgorithmECDSA:
+		if _, err := ecdsaCurve(o.KeySize); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown key algorithm %q; expected %s or %s",
+			o.KeyAlgorithm, KeyAlgorithmRSA, KeyAlgorithmECDSA)
+	}
+
+	if o.ValidityDays < 0 {
+		return fmt.Errorf("certificate validity must be a positive number of days")
+	}
+
+	return nil
+}
+
+func ecdsaCurve(size int) (elliptic.Curve, error) {
+	switch size {
+	case 0, 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	case 521:
+		return elliptic.P521(), nil
+	}
+	return nil, fmt.Errorf("unsupported ECDSA key size %d; expected 256, 384 or 521", size)
+}
+
+// generateKey generates a private key and returns it with its public key
+// and its PEM encoding
+func generateKey(o CertOptions) (interface{}, interface{}, *pem.Block, error) {
+	if o.KeyAlgorithm == KeyAlgorithmECDSA {
+		curve, err := ecdsaCurve(o.KeySize)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		der, err := x509.MarshalECPrivateKey(priv)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return priv, &priv.PublicKey, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+	}
+
+	bits := o.KeySize
+	if bits == 0 {
+		bits = 2048
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return priv, &priv.PublicKey, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}, nil
+}
+
+func newCertificate(o CertOptions) (*x509.Certificate, error) {
+	validityDays := o.ValidityDays
+	if validityDays == 0 {
+		validityDays = DefaultCertValidityDays
+	}
+
 	now := time.Now()
 	// need to set notBefore slightly in the past to account for time
 	// skew in the VMs otherwise the certs sometimes are not yet valid
 	notBefore := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute()-5, 0, 0, time.Local)
-	notAfter := notBefore.Add(time.Hour * 24 * 1080)
+	notAfter := notBefore.Add(time.Hour * 24 * time.Duration(validityDays))
 
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
@@ -47,128 +144,261 @@ func newCertificate(org string) (*x509.Certificate, error) {
 		return nil, err
 	}
 
+	// key encipherment only applies to RSA key exchange
+	keyUsage := x509.KeyUsageDigitalSignature
+	if o.KeyAlgorithm == "" || o.KeyAlgorithm == KeyAlgorithmRSA {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
 	return &x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
-			Organization: []string{org},
+			Organization: []string{o.Org},
 		},
 		NotBefore: notBefore,
 		NotAfter:  notAfter,
 
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:              keyUsage,
 		BasicConstraintsValid: true,
 	}, nil
 
 }
 
-// GenerateCACertificate generates a new certificate authority from the specified org
-// and bit size and stores the resulting certificate and key file
-// in the arguments.
-func GenerateCACertificate(certFile, keyFile, org string, bits int) error {
-	template, err := newCertificate(org)
+func writeCertAndKey(certFile, keyFile string, derBytes []byte, keyBlock *pem.Block, encryptKey bool) error {
+	certOut, err := os.Create(certFile)
 	if err != nil {
 		return err
 	}
 
-	template.IsCA = true
-	template.KeyUsage |= x509.KeyUsageCertSign
+	pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	certOut.Close()
 
-	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	return writeKey(keyFile, keyBlock, encryptKey)
+}
+
+// writeKey writes the private key, encrypted if requested and the store is
+// encrypted.  Client keys are not encrypted as the Docker client reads them.
+func writeKey(keyFile string, keyBlock *pem.Block, encrypt bool) error {
+	if encrypt {
+		return WriteSecretFile(keyFile, pem.EncodeToMemory(keyBlock), 0600)
+	}
+
+	keyOut, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
+
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	pem.Encode(keyOut, keyBlock)
+	keyOut.Close()
+
+	return nil
+}
+
+// loadKeyPair loads a certificate and its key, which may be encrypted
+func loadKeyPair(certFile, keyFile string) (tls.Certificate, error) {
+	certPEM, err := ioutil.ReadFile(certFile)
 	if err != nil {
-		return err
+		return tls.Certificate{}, err
 	}
 
-	certOut, err := os.Create(certFile)
+	keyPEM, err := ReadSecretFile(keyFile)
 	if err != nil {
-		return err
+		return tls.Certificate{}, err
 	}
 
-	pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	certOut.Close()
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
 
-	keyOut, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+// GenerateCACertificate generates a new certificate authority with the
+// specified options and stores the resulting certificate and key file
+// in the arguments.
+func GenerateCACertificate(certFile, keyFile string, opts CertOptions) error {
+	template, err := newCertificate(opts)
 	if err != nil {
 		return err
+	}
 
+	template.IsCA = true
+	template.KeyUsage |= x509.KeyUsageCertSign
+
+	priv, pub, keyBlock, err := generateKey(opts)
+	if err != nil {
+		return err
 	}
 
-	pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
-	keyOut.Close()
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return writeCertAndKey(certFile, keyFile, derBytes, keyBlock, true)
 }
 
 // GenerateCert generates a new certificate signed using the provided
 // certificate authority files and stores the result in the certificate
 // file and key provided.  The provided host names are set to the
 // appropriate certificate fields.
-func GenerateCert(hosts []string, certFile, keyFile, caFile, caKeyFile, org string, bits int) error {
-	template, err := newCertificate(org)
+func GenerateCert(hosts []string, certFile, keyFile, caFile, caKeyFile string, opts CertOptions) error {
+	template, err := newCertificate(opts)
+	if err != nil {
+		return err
+	}
+	ips, dnsNames := splitHosts(hosts)
+	setCertUsage(template, ips, dnsNames)
+
+	_, pub, keyBlock, err := generateKey(opts)
+	if err != nil {
+		return err
+
+	}
+
+	derBytes, err := signWithCA(template, pub, caFile, caKeyFile)
 	if err != nil {
 		return err
 	}
+
+	// only the server keys are encrypted
+	return writeCertAndKey(certFile, keyFile, derBytes, keyBlock, len(ips) > 0 || len(dnsNames) > 0)
+}
+
+// splitHosts separates the IP addresses from the DNS names in hosts.  A
+// client certificate is requested with a single empty host.
+func splitHosts(hosts []string) ([]net.IP, []string) {
+	ips := []net.IP{}
+	dnsNames := []string{}
+	for _, h := range hosts {
+		if h == "" {
+			continue
+		}
+		if ip := net.ParseIP(h); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, h)
+		}
+	}
+	return ips, dnsNames
+}
+
+// setCertUsage makes template a server certificate for the given addresses,
+// or a client certificate if there are none.
+func setCertUsage(template *x509.Certificate, ips []net.IP, dnsNames []string) {
 	// client
-	if len(hosts) == 1 && hosts[0] == "" {
+	if len(ips) == 0 && len(dnsNames) == 0 {
 		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
 		template.KeyUsage = x509.KeyUsageDigitalSignature
-	} else { // server
-		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
-		for _, h := range hosts {
-			if ip := net.ParseIP(h); ip != nil {
-				template.IPAddresses = append(template.IPAddresses, ip)
-
-			} else {
-				template.DNSNames = append(template.DNSNames, h)
-			}
-		}
+		return
 	}
 
-	tlsCert, err := tls.LoadX509KeyPair(caFile, caKeyFile)
+	// server
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	template.IPAddresses = ips
+	template.DNSNames = dnsNames
+}
+
+func signWithCA(template *x509.Certificate, pub interface{}, caFile, caKeyFile string) ([]byte, error) {
+	tlsCert, err := loadKeyPair(caFile, caKeyFile)
 	if err != nil {
-		return err
+		return nil, err
+	}
 
+	x509Cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		return nil, err
 	}
 
-	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	return x509.CreateCertificate(rand.Reader, template, x509Cert, pub, tlsCert.PrivateKey)
+}
+
+// SignCSR signs the PEM encoded certificate signing request with the
+// certificate authority files and returns the PEM encoded certificate.  A
+// request without IP addresses or DNS names gets a client certificate.
+// This is what an external signer does; it is used to test CSR mode.
+func SignCSR(csrPEM []byte, caFile, caKeyFile string, opts CertOptions) ([]byte, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("no certificate request found")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
 	if err != nil {
-		return err
+		return nil, err
+	}
 
+	// the request is signed with the key it is for
+	requester := &x509.Certificate{PublicKey: csr.PublicKey}
+	if err := requester.CheckSignature(csr.SignatureAlgorithm, csr.RawTBSCertificateRequest, csr.Signature); err != nil {
+		return nil, err
 	}
 
-	x509Cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	opts.Org = ""
+	if len(csr.Subject.Organization) > 0 {
+		opts.Org = csr.Subject.Organization[0]
+	}
+	// the key usage depends on the requested key, not the CA's
+	opts.KeyAlgorithm = keyAlgorithm(csr.PublicKey)
+
+	template, err := newCertificate(opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, template, x509Cert, &priv.PublicKey, tlsCert.PrivateKey)
+	setCertUsage(template, csr.IPAddresses, csr.DNSNames)
+
+	derBytes, err := signWithCA(template, csr.PublicKey, caFile, caKeyFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	certOut, err := os.Create(certFile)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes}), nil
+}
+
+func keyAlgorithm(pub interface{}) string {
+	if _, ok := pub.(*ecdsa.PublicKey); ok {
+		return KeyAlgorithmECDSA
+	}
+	return KeyAlgorithmRSA
+}
+
+func readCertificate(certFile string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(certFile)
 	if err != nil {
-		return err
+		return nil, err
+	}
 
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", certFile)
 	}
 
-	pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	certOut.Close()
+	return x509.ParseCertificate(block.Bytes)
+}
 
-	keyOut, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+// GetCertificateExpiry returns when the first certificate in the PEM
+// encoded certFile expires.
+func GetCertificateExpiry(certFile string) (time.Time, error) {
+	cert, err := readCertificate(certFile)
 	if err != nil {
-		return err
+		return time.Time{}, err
+	}
 
+	return cert.NotAfter, nil
+}
+
+// GetCertificateHosts returns the IP addresses and DNS names the first
+// certificate in the PEM encoded certFile is valid for.
+func GetCertificateHosts(certFile string) ([]string, error) {
+	cert, err := readCertificate(certFile)
+	if err != nil {
+		return nil, err
 	}
 
-	pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
-	keyOut.Close()
+	hosts := []string{}
+	for _, ip := range cert.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
 
-	return nil
+	return append(hosts, cert.DNSNames...), nil
 }
 
 func ValidateCertificate(addr, caCertPath, serverCertPath, serverKeyPath string) (bool, error) {
@@ -182,7 +412,7 @@ func ValidateCertificate(addr, caCertPath, serverCertPath, serverKeyPath string)
 		return false, err
 	}
 
-	serverKey, err := ioutil.ReadFile(serverKeyPath)
+	serverKey, err := ReadSecretFile(serverKeyPath)
 	if err != nil {
 		return false, err
 	}
@@ -203,3 +433,79 @@ func ValidateCertificate(addr, caCertPath, serverCertPath, serverKeyPath string)
 
 	return true, nil
 }
+
+// ProbeTLS connects to the daemon at addr with the client certificate and
+// makes a request, returning the certificate chain the daemon presented.
+// The chain is not verified.  An error means the connection or the request
+// failed, e.g. because the daemon rejected the client certificate; the chain
+// is returned if the TLS handshake completed.
+func ProbeTLS(addr string, clientCert, clientKey []byte) ([]*x509.Certificate, error) {
+	keypair, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates:       []tls.Certificate{keypair},
+		InsecureSkipVerify: true,
+	}
+
+	rawConn, err := net.DialTimeout("tcp", addr, time.Second*5)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := tls.Client(rawConn, tlsConfig)
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	chain := conn.ConnectionState().PeerCertificates
+
+	// with TLS 1.3 a rejected client certificate is only reported once
+	// data is exchanged
+	if _, err := fmt.Fprint(conn, "GET /_ping HTTP/1.0\r\n\r\n"); err != nil {
+		return chain, err
+	}
+
+	status, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return chain, err
+	}
+
+	if !strings.Contains(status, " 200 ") {
+		return chain, fmt.Errorf("unexpected response from the daemon: %s", strings.TrimSpace(status))
+	}
+
+	return chain, nil
+}
+
+// GetCertificateSerial returns the serial number of the first certificate
+// in the PEM encoded certFile.
+func GetCertificateSerial(certFile string) (*big.Int, error) {
+	cert, err := readCertificate(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return cert.SerialNumber, nil
+}
+
+// IsIssuedBy reports whether the first certificate in the PEM encoded
+// certFile is signed by the certificate authority in caFile.
+func IsIssuedBy(certFile, caFile string) (bool, error) {
+	cert, err := readCertificate(certFile)
+	if err != nil {
+		return false, err
+	}
+
+	caCert, err := readCertificate(caFile)
+	if err != nil {
+		return false, err
+	}
+
+	return cert.CheckSignatureFrom(caCert) == nil, nil
+}
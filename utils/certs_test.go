@@ -1,10 +1,20 @@
 package utils
 
 import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestGenerateCACertificate(t *testing.T) {
@@ -19,8 +29,7 @@ func TestGenerateCACertificate(t *testing.T) {
 	caCertPath := filepath.Join(tmpDir, "ca.pem")
 	caKeyPath := filepath.Join(tmpDir, "key.pem")
 	testOrg := "test-org"
-	bits := 2048
-	if err := GenerateCACertificate(caCertPath, caKeyPath, testOrg, bits); err != nil {
+	if err := GenerateCACertificate(caCertPath, caKeyPath, CertOptions{Org: testOrg}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -47,8 +56,7 @@ func TestGenerateCert(t *testing.T) {
 	certPath := filepath.Join(tmpDir, "cert.pem")
 	keyPath := filepath.Join(tmpDir, "cert-key.pem")
 	testOrg := "test-org"
-	bits := 2048
-	if err := GenerateCACertificate(caCertPath, caKeyPath, testOrg, bits); err != nil {
+	if err := GenerateCACertificate(caCertPath, caKeyPath, CertOptions{Org: testOrg}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -60,7 +68,7 @@ func TestGenerateCert(t *testing.T) {
 	}
 	os.Setenv("MACHINE_DIR", "")
 
-	if err := GenerateCert([]string{}, certPath, keyPath, caCertPath, caKeyPath, testOrg, bits); err != nil {
+	if err := GenerateCert([]string{}, certPath, keyPath, caCertPath, caKeyPath, CertOptions{Org: testOrg}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -72,3 +80,312 @@ func TestGenerateCert(t *testing.T) {
 		t.Fatalf("key not created at %s", keyPath)
 	}
 }
+
+func TestGetCertificateExpiry(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "key.pem")
+	if err := GenerateCACertificate(caCertPath, caKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	expiry, err := GetCertificateExpiry(caCertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expiry.Before(time.Now().Add(time.Hour * 24 * 1000)) {
+		t.Fatalf("expected the certificate to be valid for 1080 days; expires %s", expiry)
+	}
+
+	if _, err := GetCertificateExpiry(caKeyPath); err == nil {
+		t.Fatal("expected error reading the expiry of a key")
+	}
+}
+
+func TestGetCertificateHosts(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "key.pem")
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	keyPath := filepath.Join(tmpDir, "cert-key.pem")
+	if err := GenerateCACertificate(caCertPath, caKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateCert([]string{"1.2.3.4", "dev", "10.0.0.1"}, certPath, keyPath, caCertPath, caKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := GetCertificateHosts(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"1.2.3.4", "10.0.0.1", "dev"}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Fatalf("expected hosts %v; received %v", expected, hosts)
+	}
+}
+
+func TestCertOptionsValidate(t *testing.T) {
+	valid := []CertOptions{
+		{},
+		{KeyAlgorithm: KeyAlgorithmRSA, KeySize: 4096},
+		{KeyAlgorithm: KeyAlgorithmECDSA},
+		{KeyAlgorithm: KeyAlgorithmECDSA, KeySize: 384},
+		{KeyAlgorithm: KeyAlgorithmECDSA, ValidityDays: 90},
+	}
+	for _, o := range valid {
+		if err := o.Validate(); err != nil {
+			t.Fatalf("expected %+v to be valid: %s", o, err)
+		}
+	}
+
+	invalid := []CertOptions{
+		{KeyAlgorithm: "dsa"},
+		{KeyAlgorithm: KeyAlgorithmRSA, KeySize: 512},
+		{KeyAlgorithm: KeyAlgorithmECDSA, KeySize: 2048},
+		{KeyAlgorithm: "ed25519"},
+		{ValidityDays: -1},
+	}
+	for _, o := range invalid {
+		if err := o.Validate(); err == nil {
+			t.Fatalf("expected %+v to be invalid", o)
+		}
+	}
+}
+
+func TestGenerateCertOptions(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		opts  CertOptions
+		check func(pub interface{}) bool
+	}{
+		{
+			CertOptions{Org: "rsa-org", KeyAlgorithm: KeyAlgorithmRSA, KeySize: 1024, ValidityDays: 10},
+			func(pub interface{}) bool {
+				k, ok := pub.(*rsa.PublicKey)
+				return ok && k.N.BitLen() == 1024
+			},
+		},
+		{
+			CertOptions{Org: "ecdsa-org", KeyAlgorithm: KeyAlgorithmECDSA, KeySize: 384, ValidityDays: 20},
+			func(pub interface{}) bool {
+				k, ok := pub.(*ecdsa.PublicKey)
+				return ok && k.Curve.Params().BitSize == 384
+			},
+		},
+	}
+
+	for _, test := range tests {
+		caCertPath := filepath.Join(tmpDir, test.opts.KeyAlgorithm+"-ca.pem")
+		caKeyPath := filepath.Join(tmpDir, test.opts.KeyAlgorithm+"-ca-key.pem")
+		clientCertPath := filepath.Join(tmpDir, test.opts.KeyAlgorithm+"-cert.pem")
+		clientKeyPath := filepath.Join(tmpDir, test.opts.KeyAlgorithm+"-key.pem")
+		serverCertPath := filepath.Join(tmpDir, test.opts.KeyAlgorithm+"-server.pem")
+		serverKeyPath := filepath.Join(tmpDir, test.opts.KeyAlgorithm+"-server-key.pem")
+
+		if err := GenerateCACertificate(caCertPath, caKeyPath, test.opts); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := GenerateCert([]string{""}, clientCertPath, clientKeyPath, caCertPath, caKeyPath, test.opts); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := GenerateCert([]string{"1.2.3.4"}, serverCertPath, serverKeyPath, caCertPath, caKeyPath, test.opts); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, certPath := range []string{caCertPath, clientCertPath, serverCertPath} {
+			cert, err := readCertificate(certPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !test.check(cert.PublicKey) {
+				t.Fatalf("%s: unexpected public key %T", certPath, cert.PublicKey)
+			}
+
+			if len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != test.opts.Org {
+				t.Fatalf("%s: expected org %s; received %v", certPath, test.opts.Org, cert.Subject.Organization)
+			}
+
+			validity := cert.NotAfter.Sub(cert.NotBefore)
+			if validity != time.Hour*24*time.Duration(test.opts.ValidityDays) {
+				t.Fatalf("%s: expected validity of %d days; received %s", certPath, test.opts.ValidityDays, validity)
+			}
+
+			encipherment := cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0
+			if encipherment != (test.opts.KeyAlgorithm == KeyAlgorithmRSA && certPath != clientCertPath) {
+				t.Fatalf("%s: unexpected key usage %d", certPath, cert.KeyUsage)
+			}
+		}
+
+		// the generated keys must load back with their certificates
+		if _, err := tls.LoadX509KeyPair(serverCertPath, serverKeyPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIsIssuedBy(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "ca-key.pem")
+	otherCaCertPath := filepath.Join(tmpDir, "other-ca.pem")
+	otherCaKeyPath := filepath.Join(tmpDir, "other-ca-key.pem")
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	keyPath := filepath.Join(tmpDir, "key.pem")
+	if err := GenerateCACertificate(caCertPath, caKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateCACertificate(otherCaCertPath, otherCaKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateCert([]string{""}, certPath, keyPath, caCertPath, caKeyPath, CertOptions{Org: "alice", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	issued, err := IsIssuedBy(certPath, caCertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !issued {
+		t.Fatal("expected the certificate to be issued by its CA")
+	}
+
+	issued, err = IsIssuedBy(certPath, otherCaCertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued {
+		t.Fatal("expected the certificate not to be issued by another CA")
+	}
+}
+
+func TestProbeTLS(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "ca-key.pem")
+	serverCertPath := filepath.Join(tmpDir, "server.pem")
+	serverKeyPath := filepath.Join(tmpDir, "server-key.pem")
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	keyPath := filepath.Join(tmpDir, "key.pem")
+	if err := GenerateCACertificate(caCertPath, caKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateCert([]string{"127.0.0.1"}, serverCertPath, serverKeyPath, caCertPath, caKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateCert([]string{""}, certPath, keyPath, caCertPath, caKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	serverCert, err := tls.LoadX509KeyPair(serverCertPath, serverKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	addr := server.Listener.Addr().String()
+
+	clientCert, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientKey, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := ProbeTLS(addr, clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chain) != 1 || !reflect.DeepEqual(chain[0].Raw, serverCert.Certificate[0]) {
+		t.Fatal("expected the server certificate to be returned")
+	}
+
+	// a client certificate from another CA is rejected, but the server
+	// certificate is still returned
+	otherCaCertPath := filepath.Join(tmpDir, "other-ca.pem")
+	otherCaKeyPath := filepath.Join(tmpDir, "other-ca-key.pem")
+	if err := GenerateCACertificate(otherCaCertPath, otherCaKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateCert([]string{""}, certPath, keyPath, otherCaCertPath, otherCaKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+
+	clientCert, err = ioutil.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientKey, err = ioutil.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err = ProbeTLS(addr, clientCert, clientKey)
+	if err == nil {
+		t.Fatal("expected error with a client certificate from another CA")
+	}
+
+	if len(chain) != 1 {
+		t.Fatalf("expected the server certificate to be returned; received %d certificates", len(chain))
+	}
+}
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// encrypted files are a PEM block of this type holding the nonce and
+	// the ciphertext; the salt the key is derived with is a header
+	encryptedBlockType = "MACHINE ENCRYPTED DATA"
+	kdfIterations      = 100000
+	kdfSaltSize        = 16
+)
+
+var (
+	ErrStorageLocked = errors.New("the file is encrypted; set MACHINE_STORAGE_PASSPHRASE or --storage-key-file to decrypt it")
+)
+
+// getStorageSecret returns the secret the store is encrypted with: the
+// contents of the key file, or the passphrase.  It returns nil if the store
+// is not encrypted.
+func getStorageSecret() ([]byte, error) {
+	if keyFile := os.Getenv("MACHINE_STORAGE_KEY_FILE"); keyFile != "" {
+		secret, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the storage key file: %s", err)
+		}
+
+		secret = bytes.TrimSpace(secret)
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("the storage key file %s is empty", keyFile)
+		}
+
+		return secret, nil
+	}
+
+	if passphrase := os.Getenv("MACHINE_STORAGE_PASSPHRASE"); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	return nil, nil
+}
+
+// StorageEncryptionEnabled reports whether a passphrase or key file is set,
+// in which case keys and machine configs are written encrypted.
+func StorageEncryptionEnabled() bool {
+	secret, err := getStorageSecret()
+	return err == nil && secret != nil
+}
+
+func storageCipher(secret, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2.Key(secret, salt, kdfIterations, 32, sha256.New)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted reports whether data was encrypted by EncryptSecret
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN "+encryptedBlockType+"-----"))
+}
+
+// EncryptSecret encrypts data with the storage secret.  Data is returned
+// unchanged if the store is not encrypted or data is already encrypted.
+func EncryptSecret(data []byte) ([]byte, error) {
+	secret, err := getStorageSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil || IsEncrypted(data) {
+		return data, nil
+	}
+
+	salt := make([]byte, kdfSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := storageCipher(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:    encryptedBlockType,
+		Headers: map[string]string{"Salt": hex.EncodeToString(salt)},
+		Bytes:   aead.Seal(nonce, nonce, data, nil),
+	}), nil
+}
+
+// DecryptSecret decrypts data encrypted by EncryptSecret.  Data which is
+// not encrypted is returned unchanged.
+func DecryptSecret(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	secret, err := getStorageSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil {
+		return nil, ErrStorageLocked
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid encrypted data")
+	}
+
+	salt, err := hex.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted data: %s", err)
+	}
+
+	aead, err := storageCipher(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(block.Bytes) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted data")
+	}
+
+	nonce, ciphertext := block.Bytes[:aead.NonceSize()], block.Bytes[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt; the passphrase or key file is wrong")
+	}
+
+	return plaintext, nil
+}
+
+// ReadSecretFile reads a key or config file, decrypting it if needed
+func ReadSecretFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := DecryptSecret(data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", path, err)
+	}
+
+	return plaintext, nil
+}
+
+// WriteSecretFile writes a key or config file, encrypting it if the store
+// is encrypted.  The file is replaced atomically.
+func WriteSecretFile(path string, data []byte, perm os.FileMode) error {
+	data, err := EncryptSecret(data)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, perm)
+}
+
+// EncryptFile encrypts an existing key or config file in place.  It
+// returns false if the file was already encrypted.
+func EncryptFile(path string) (bool, error) {
+	return convertFile(path, true)
+}
+
+// DecryptFile decrypts an encrypted key or config file in place.  It
+// returns false if the file was not encrypted.
+func DecryptFile(path string) (bool, error) {
+	return convertFile(path, false)
+}
+
+func convertFile(path string, encrypt bool) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	if IsEncrypted(data) == encrypt {
+		return false, nil
+	}
+
+	if encrypt {
+		if !StorageEncryptionEnabled() {
+			return false, fmt.Errorf("no passphrase or key file to encrypt %s with", path)
+		}
+		data, err = EncryptSecret(data)
+	} else {
+		data, err = DecryptSecret(data)
+	}
+	if err != nil {
+		return false, fmt.Errorf("error converting %s: %s", path, err)
+	}
+
+	return true, writeFileAtomic(path, data, fi.Mode().Perm())
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
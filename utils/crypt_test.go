@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	defer os.Setenv("MACHINE_STORAGE_PASSPHRASE", "")
+
+	plaintext := []byte(`{"SecretKey": "s3cr3t"}`)
+
+	// without a secret nothing is encrypted
+	data, err := EncryptSecret(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, plaintext) {
+		t.Fatal("expected the data to be left in plaintext")
+	}
+
+	os.Setenv("MACHINE_STORAGE_PASSPHRASE", "correct horse")
+
+	encrypted, err := EncryptSecret(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsEncrypted(encrypted) || bytes.Contains(encrypted, []byte("s3cr3t")) {
+		t.Fatalf("expected the data to be encrypted; received %s", encrypted)
+	}
+
+	decrypted, err := DecryptSecret(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("expected %s; received %s", plaintext, decrypted)
+	}
+
+	os.Setenv("MACHINE_STORAGE_PASSPHRASE", "wrong")
+	if _, err := DecryptSecret(encrypted); err == nil {
+		t.Fatal("expected error decrypting with the wrong passphrase")
+	}
+
+	os.Setenv("MACHINE_STORAGE_PASSPHRASE", "")
+	if _, err := DecryptSecret(encrypted); err != ErrStorageLocked {
+		t.Fatalf("expected %s; received %v", ErrStorageLocked, err)
+	}
+}
+
+func TestSecretFiles(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	keyFile := filepath.Join(tmpDir, "storage.key")
+	if err := ioutil.WriteFile(keyFile, []byte("0123456789abcdef\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(tmpDir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("MACHINE_STORAGE_KEY_FILE", keyFile)
+	defer os.Setenv("MACHINE_STORAGE_KEY_FILE", "")
+
+	if changed, err := EncryptFile(configPath); err != nil || !changed {
+		t.Fatalf("expected the file to be encrypted: %v", err)
+	}
+
+	if changed, err := EncryptFile(configPath); err != nil || changed {
+		t.Fatalf("expected the file to be encrypted only once: %v", err)
+	}
+
+	data, err := ReadSecretFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "{}" {
+		t.Fatalf("expected {}; received %s", data)
+	}
+
+	fi, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected the permissions to be kept; received %s", fi.Mode())
+	}
+
+	if changed, err := DecryptFile(configPath); err != nil || !changed {
+		t.Fatalf("expected the file to be decrypted: %v", err)
+	}
+
+	raw, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(raw) != "{}" {
+		t.Fatalf("expected {}; received %s", raw)
+	}
+}
+
+func TestGenerateCertEncryptedStore(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.Setenv("MACHINE_STORAGE_PASSPHRASE", "correct horse")
+	defer os.Setenv("MACHINE_STORAGE_PASSPHRASE", "")
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "ca-key.pem")
+	serverCertPath := filepath.Join(tmpDir, "server.pem")
+	serverKeyPath := filepath.Join(tmpDir, "server-key.pem")
+	clientCertPath := filepath.Join(tmpDir, "cert.pem")
+	clientKeyPath := filepath.Join(tmpDir, "key.pem")
+	opts := CertOptions{Org: "test-org", KeySize: 1024}
+
+	if err := GenerateCACertificate(caCertPath, caKeyPath, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// the CA key is decrypted to sign
+	if err := GenerateCert([]string{"1.2.3.4"}, serverCertPath, serverKeyPath, caCertPath, caKeyPath, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateCert([]string{""}, clientCertPath, clientKeyPath, caCertPath, caKeyPath, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		path      string
+		encrypted bool
+	}{
+		{caKeyPath, true},
+		{serverKeyPath, true},
+		{clientKeyPath, false},
+	} {
+		data, err := ioutil.ReadFile(c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if IsEncrypted(data) != c.encrypted {
+			t.Fatalf("expected %s to be encrypted: %t", c.path, c.encrypted)
+		}
+	}
+
+	if _, err := loadKeyPair(serverCertPath, serverKeyPath); err != nil {
+		t.Fatal(err)
+	}
+}
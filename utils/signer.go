@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"reflect"
+	"strings"
+)
+
+// CertSigner signs certificate requests with a certificate authority whose
+// key is not available to machine, such as a corporate PKI.
+type CertSigner interface {
+	// SignCSR takes a PEM encoded certificate signing request and returns
+	// the PEM encoded certificate, optionally followed by the
+	// intermediate certificates it chains to.
+	SignCSR(csr []byte) ([]byte, error)
+}
+
+// commandSigner runs a shell command with the request on stdin and reads
+// the certificate from stdout.
+type commandSigner struct {
+	command string
+}
+
+func (s commandSigner) SignCSR(csr []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("/bin/sh", "-c", s.command)
+	cmd.Stdin = bytes.NewReader(csr)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error running signer command %q: %s: %s", s.command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// httpSigner posts the request to a signing endpoint and reads the
+// certificate from the response body.
+type httpSigner struct {
+	url string
+}
+
+func (s httpSigner) SignCSR(csr []byte) ([]byte, error) {
+	resp, err := http.Post(s.url, "application/pkcs10", bytes.NewReader(csr))
+	if err != nil {
+		return nil, fmt.Errorf("error contacting signer %s: %s", s.url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("signer %s returned %s: %s", s.url, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+// NewCertSigner returns a signer which runs command, or posts to url.
+// Exactly one of them must be given.
+func NewCertSigner(command, url string) (CertSigner, error) {
+	switch {
+	case command != "" && url != "":
+		return nil, fmt.Errorf("specify either a signer command or a signer URL, not both")
+	case command != "":
+		return commandSigner{command}, nil
+	case url != "":
+		return httpSigner{url}, nil
+	}
+	return nil, fmt.Errorf("no signer command or URL specified")
+}
+
+// GenerateCertWithSigner generates a new key and has a certificate for it
+// issued by signer, storing the result in the certificate file and key
+// provided.  As with GenerateCert, a single empty host requests a client
+// certificate.
+func GenerateCertWithSigner(hosts []string, certFile, keyFile string, opts CertOptions, signer CertSigner) error {
+	priv, pub, keyBlock, err := generateKey(opts)
+	if err != nil {
+		return err
+	}
+
+	ips, dnsNames := splitHosts(hosts)
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			Organization: []string{opts.Org},
+		},
+		IPAddresses: ips,
+		DNSNames:    dnsNames,
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, priv)
+	if err != nil {
+		return err
+	}
+
+	certPEM, err := signer.SignCSR(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("the signer did not return a certificate")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(cert.PublicKey, pub) {
+		return fmt.Errorf("the signer returned a certificate for a different key")
+	}
+
+	if err := ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		return err
+	}
+
+	return writeKey(keyFile, keyBlock, len(ips) > 0 || len(dnsNames) > 0)
+}
+
+// ReadCACertificates returns the CA certificate followed by the
+// certificates of its chain, if a chain file is given.  This is what the
+// daemon and clients need to trust to verify certificates issued by an
+// intermediate CA.
+func ReadCACertificates(caFile, chainFile string) ([]byte, error) {
+	caCert, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if chainFile == "" {
+		return caCert, nil
+	}
+
+	chain, err := ioutil.ReadFile(chainFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(caCert) > 0 && caCert[len(caCert)-1] != '\n' {
+		caCert = append(caCert, '\n')
+	}
+
+	return append(caCert, chain...), nil
+}
+
+// ValidateCAChain checks the CA certificate is issued by one of the
+// certificates in the PEM encoded chain file.
+func ValidateCAChain(caFile, chainFile string) error {
+	caCert, err := readCertificate(caFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(chainFile)
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in %s", chainFile)
+	}
+
+	if _, err := caCert.Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("the CA certificate %s does not chain to %s: %s", caFile, chainFile, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,288 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestHelperSigner is not a real test; it stands in for an external signer
+// command when the test binary is run by commandSigner.
+func TestHelperSigner(t *testing.T) {
+	if os.Getenv("MACHINE_TEST_SIGNER") != "1" {
+		return
+	}
+
+	csr, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprint(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cert, err := SignCSR(csr, os.Getenv("MACHINE_TEST_CA"), os.Getenv("MACHINE_TEST_CA_KEY"), CertOptions{})
+	if err != nil {
+		fmt.Fprint(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Stdout.Write(cert)
+	os.Exit(0)
+}
+
+func newTestCA(t *testing.T, dir string) (string, string) {
+	caCertPath := filepath.Join(dir, "ca.pem")
+	caKeyPath := filepath.Join(dir, "ca-key.pem")
+	if err := GenerateCACertificate(caCertPath, caKeyPath, CertOptions{Org: "test-org", KeySize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+	return caCertPath, caKeyPath
+}
+
+func verifyIssuedBy(t *testing.T, certPath, caCertPath string) *x509.Certificate {
+	cert, err := readCertificate(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caCert, err := readCertificate(caCertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cert.CheckSignatureFrom(caCert); err != nil {
+		t.Fatalf("%s is not issued by %s: %s", certPath, caCertPath, err)
+	}
+
+	return cert
+}
+
+func TestGenerateCertWithHTTPSigner(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath, caKeyPath := newTestCA(t, tmpDir)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		csr, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cert, err := SignCSR(csr, caCertPath, caKeyPath, CertOptions{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(cert)
+	}))
+	defer ts.Close()
+
+	signer, err := NewCertSigner("", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(tmpDir, "server.pem")
+	keyPath := filepath.Join(tmpDir, "server-key.pem")
+	opts := CertOptions{Org: "machine", KeyAlgorithm: KeyAlgorithmECDSA}
+	if err := GenerateCertWithSigner([]string{"1.2.3.4", "dev"}, certPath, keyPath, opts, signer); err != nil {
+		t.Fatal(err)
+	}
+
+	cert := verifyIssuedBy(t, certPath, caCertPath)
+
+	hosts, err := GetCertificateHosts(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"1.2.3.4", "dev"}; !reflect.DeepEqual(hosts, expected) {
+		t.Fatalf("expected hosts %v; received %v", expected, hosts)
+	}
+
+	if cert.Subject.Organization[0] != "machine" {
+		t.Fatalf("expected org machine; received %v", cert.Subject.Organization)
+	}
+
+	if _, err := tls.LoadX509KeyPair(certPath, keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	ts.Config.Handler = http.NotFoundHandler()
+	if err := GenerateCertWithSigner([]string{""}, certPath, keyPath, opts, signer); err == nil {
+		t.Fatal("expected error from a failing signer")
+	}
+}
+
+func TestGenerateCertWithCommandSigner(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath, caKeyPath := newTestCA(t, tmpDir)
+
+	os.Setenv("MACHINE_TEST_SIGNER", "1")
+	os.Setenv("MACHINE_TEST_CA", caCertPath)
+	os.Setenv("MACHINE_TEST_CA_KEY", caKeyPath)
+	defer os.Setenv("MACHINE_TEST_SIGNER", "")
+
+	signer, err := NewCertSigner(fmt.Sprintf("%q -test.run=TestHelperSigner", os.Args[0]), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(tmpDir, "cert.pem")
+	keyPath := filepath.Join(tmpDir, "key.pem")
+	if err := GenerateCertWithSigner([]string{""}, certPath, keyPath, CertOptions{Org: "user"}, signer); err != nil {
+		t.Fatal(err)
+	}
+
+	cert := verifyIssuedBy(t, certPath, caCertPath)
+
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Fatalf("expected a client certificate; received ext key usage %v", cert.ExtKeyUsage)
+	}
+
+	failing, err := NewCertSigner("echo signing failed >&2; exit 1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GenerateCertWithSigner([]string{""}, certPath, keyPath, CertOptions{}, failing); err == nil {
+		t.Fatal("expected error from a failing signer command")
+	}
+}
+
+func TestNewCertSigner(t *testing.T) {
+	if _, err := NewCertSigner("", ""); err == nil {
+		t.Fatal("expected error without a command or URL")
+	}
+
+	if _, err := NewCertSigner("sign", "http://localhost:8888"); err == nil {
+		t.Fatal("expected error with both a command and a URL")
+	}
+}
+
+func TestCAChain(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	rootCertPath, rootKeyPath := newTestCA(t, tmpDir)
+
+	// an intermediate CA issued by the root
+	opts := CertOptions{Org: "intermediate", KeyAlgorithm: KeyAlgorithmECDSA}
+	template, err := newCertificate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.IsCA = true
+	template.KeyUsage |= x509.KeyUsageCertSign
+
+	_, pub, keyBlock, err := generateKey(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	derBytes, err := signWithCA(template, pub, rootCertPath, rootKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caCertPath := filepath.Join(tmpDir, "intermediate.pem")
+	caKeyPath := filepath.Join(tmpDir, "intermediate-key.pem")
+	if err := writeCertAndKey(caCertPath, caKeyPath, derBytes, keyBlock, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateCAChain(caCertPath, rootCertPath); err != nil {
+		t.Fatal(err)
+	}
+
+	otherDir := filepath.Join(tmpDir, "other")
+	if err := os.Mkdir(otherDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	otherCertPath, _ := newTestCA(t, otherDir)
+	if err := ValidateCAChain(caCertPath, otherCertPath); err == nil {
+		t.Fatal("expected error validating against an unrelated chain")
+	}
+
+	// the bundle verifies server certificates issued by the intermediate
+	certPath := filepath.Join(tmpDir, "server.pem")
+	keyPath := filepath.Join(tmpDir, "server-key.pem")
+	if err := GenerateCert([]string{"1.2.3.4"}, certPath, keyPath, caCertPath, caKeyPath, CertOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := ReadCACertificates(caCertPath, rootCertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		t.Fatal("no certificates in the CA bundle")
+	}
+
+	cert, err := readCertificate(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for block, rest := pem.Decode(bundle); block != nil; block, rest = pem.Decode(rest) {
+		count++
+	}
+	if count != 2 {
+		t.Fatalf("expected the bundle to hold the CA and its chain; found %d certificates", count)
+	}
+}
+
+func TestSignCSRRejectsBadSignature(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath, caKeyPath := newTestCA(t, tmpDir)
+
+	priv, _, _, err := generateKey(CertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{"dev"}}, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flip a bit of the signature, the last field of the request
+	der[len(der)-1] ^= 1
+
+	csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	if _, err := SignCSR(csr, caCertPath, caKeyPath, CertOptions{}); err == nil {
+		t.Fatal("expected error signing a request with a bad signature")
+	}
+}
@@ -43,6 +43,16 @@ func GetMachineCertDir() string {
 	return filepath.Join(GetBaseDir(), "certs")
 }
 
+// GetClientCaDir is where the CAs of the client certificates issued for
+// users are kept
+func GetClientCaDir() string {
+	return filepath.Join(GetMachineCertDir(), "client-cas")
+}
+
+func GetRevocationListPath() string {
+	return filepath.Join(GetMachineCertDir(), "revoked.json")
+}
+
 func GetMachineCacheDir() string {
 	return filepath.Join(GetBaseDir(), "cache")
 }